@@ -0,0 +1,8 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+//go:build !386 && !arm && !mips && !mipsle
+
+package pospop
+
+// int is 64 bits wide on this platform
+type altCounter = uint32
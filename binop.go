@@ -0,0 +1,233 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import "unsafe"
+
+// word is the set of element types supporting bitwise operations
+type word interface {
+	uint8 | uint16 | uint32 | uint64
+}
+
+// a bitwise operation combining two buffers
+type binop int
+
+const (
+	opAnd binop = iota
+	opOr
+	opXor
+	opAndNot
+)
+
+// each platform must provide arrays count8binopfuncs, count16binopfuncs,
+// count32binopfuncs, and count64binopfuncs of type count8binopimpl, ...
+// listing kernels analogous to count8funcs and friends that count the
+// values a[i] op b[i], combining a and b as they are loaded.  The caller
+// ensures that a and b are equally long and that their length in bytes
+// is a multiple of 8.
+
+type count8binopimpl struct {
+	count8binop func(counts *[8]int, a, b []uint8, op binop)
+	name        string
+	available   bool
+}
+
+type count16binopimpl struct {
+	count16binop func(counts *[16]int, a, b []uint16, op binop)
+	name         string
+	available    bool
+}
+
+type count32binopimpl struct {
+	count32binop func(counts *[32]int, a, b []uint32, op binop)
+	name         string
+	available    bool
+}
+
+type count64binopimpl struct {
+	count64binop func(counts *[64]int, a, b []uint64, op binop)
+	name         string
+	available    bool
+}
+
+// optimal count8binop implementation selected at runtime
+var count8binopfunc = func() func(*[8]int, []uint8, []uint8, binop) {
+	for _, f := range count8binopfuncs {
+		if f.available {
+			return f.count8binop
+		}
+	}
+
+	panic("no implementation of count8binop available")
+}()
+
+// optimal count16binop implementation selected at runtime
+var count16binopfunc = func() func(*[16]int, []uint16, []uint16, binop) {
+	for _, f := range count16binopfuncs {
+		if f.available {
+			return f.count16binop
+		}
+	}
+
+	panic("no implementation of count16binop available")
+}()
+
+// optimal count32binop implementation selected at runtime
+var count32binopfunc = func() func(*[32]int, []uint32, []uint32, binop) {
+	for _, f := range count32binopfuncs {
+		if f.available {
+			return f.count32binop
+		}
+	}
+
+	panic("no implementation of count32binop available")
+}()
+
+// optimal count64binop implementation selected at runtime
+var count64binopfunc = func() func(*[64]int, []uint64, []uint64, binop) {
+	for _, f := range count64binopfuncs {
+		if f.available {
+			return f.count64binop
+		}
+	}
+
+	panic("no implementation of count64binop available")
+}()
+
+// count a[i] op b[i] into counts.  The kernels process the leading
+// elements making up a multiple of 8 bytes, the remaining elements are
+// combined and added one at a time.
+func countBinop[T word](counts []int, a, b []T, op binop) {
+	var zero T
+	var tail [7]T
+
+	if len(a) != len(b) {
+		panic("pospop: buffers differ in length")
+	}
+
+	size := int(unsafe.Sizeof(zero))
+	n := len(a) &^ (8/size - 1)
+	x := unsafe.Pointer(unsafe.SliceData(a))
+	y := unsafe.Pointer(unsafe.SliceData(b))
+	switch size {
+	case 1:
+		count8binopfunc((*[8]int)(counts), unsafe.Slice((*uint8)(x), n), unsafe.Slice((*uint8)(y), n), op)
+	case 2:
+		count16binopfunc((*[16]int)(counts), unsafe.Slice((*uint16)(x), n), unsafe.Slice((*uint16)(y), n), op)
+	case 4:
+		count32binopfunc((*[32]int)(counts), unsafe.Slice((*uint32)(x), n), unsafe.Slice((*uint32)(y), n), op)
+	case 8:
+		count64binopfunc((*[64]int)(counts), unsafe.Slice((*uint64)(x), n), unsafe.Slice((*uint64)(y), n), op)
+	}
+
+	k := combine(tail[:], a[n:], b[n:], op)
+	addBits(counts, tail[:k])
+}
+
+// set dst[i] = a[i] op b[i] for as many elements as fit into dst and
+// return their number
+func combine[T word](dst, a, b []T, op binop) int {
+	n := copy(dst, a)
+	dst, b = dst[:n], b[:n]
+
+	switch op {
+	case opAnd:
+		for i := range dst {
+			dst[i] &= b[i]
+		}
+	case opOr:
+		for i := range dst {
+			dst[i] |= b[i]
+		}
+	case opXor:
+		for i := range dst {
+			dst[i] ^= b[i]
+		}
+	case opAndNot:
+		for i := range dst {
+			dst[i] &^= b[i]
+		}
+	}
+
+	return n
+}
+
+// Like Count8, but count a[i] & b[i]; panics if a and b differ in length.
+func CountAnd8(counts *[8]int, a, b []uint8) {
+	countBinop(counts[:], a, b, opAnd)
+}
+
+// Like Count8, but count a[i] | b[i]; panics if a and b differ in length.
+func CountOr8(counts *[8]int, a, b []uint8) {
+	countBinop(counts[:], a, b, opOr)
+}
+
+// Like Count8, but count a[i] ^ b[i]; panics if a and b differ in length.
+func CountXor8(counts *[8]int, a, b []uint8) {
+	countBinop(counts[:], a, b, opXor)
+}
+
+// Like Count8, but count a[i] &^ b[i]; panics if a and b differ in length.
+func CountAndNot8(counts *[8]int, a, b []uint8) {
+	countBinop(counts[:], a, b, opAndNot)
+}
+
+// Like Count16, but count a[i] & b[i]; panics if a and b differ in length.
+func CountAnd16(counts *[16]int, a, b []uint16) {
+	countBinop(counts[:], a, b, opAnd)
+}
+
+// Like Count16, but count a[i] | b[i]; panics if a and b differ in length.
+func CountOr16(counts *[16]int, a, b []uint16) {
+	countBinop(counts[:], a, b, opOr)
+}
+
+// Like Count16, but count a[i] ^ b[i]; panics if a and b differ in length.
+func CountXor16(counts *[16]int, a, b []uint16) {
+	countBinop(counts[:], a, b, opXor)
+}
+
+// Like Count16, but count a[i] &^ b[i]; panics if a and b differ in length.
+func CountAndNot16(counts *[16]int, a, b []uint16) {
+	countBinop(counts[:], a, b, opAndNot)
+}
+
+// Like Count32, but count a[i] & b[i]; panics if a and b differ in length.
+func CountAnd32(counts *[32]int, a, b []uint32) {
+	countBinop(counts[:], a, b, opAnd)
+}
+
+// Like Count32, but count a[i] | b[i]; panics if a and b differ in length.
+func CountOr32(counts *[32]int, a, b []uint32) {
+	countBinop(counts[:], a, b, opOr)
+}
+
+// Like Count32, but count a[i] ^ b[i]; panics if a and b differ in length.
+func CountXor32(counts *[32]int, a, b []uint32) {
+	countBinop(counts[:], a, b, opXor)
+}
+
+// Like Count32, but count a[i] &^ b[i]; panics if a and b differ in length.
+func CountAndNot32(counts *[32]int, a, b []uint32) {
+	countBinop(counts[:], a, b, opAndNot)
+}
+
+// Like Count64, but count a[i] & b[i]; panics if a and b differ in length.
+func CountAnd64(counts *[64]int, a, b []uint64) {
+	countBinop(counts[:], a, b, opAnd)
+}
+
+// Like Count64, but count a[i] | b[i]; panics if a and b differ in length.
+func CountOr64(counts *[64]int, a, b []uint64) {
+	countBinop(counts[:], a, b, opOr)
+}
+
+// Like Count64, but count a[i] ^ b[i]; panics if a and b differ in length.
+func CountXor64(counts *[64]int, a, b []uint64) {
+	countBinop(counts[:], a, b, opXor)
+}
+
+// Like Count64, but count a[i] &^ b[i]; panics if a and b differ in length.
+func CountAndNot64(counts *[64]int, a, b []uint64) {
+	countBinop(counts[:], a, b, opAndNot)
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/rand"
+	"testing"
+	"unsafe"
+)
+
+// test the correctness of CountAnd64, CountOr64, CountXor64, and
+// CountAndNot64
+func TestCountBinop64(t *testing.T) {
+	funcs := []struct {
+		name  string
+		count func(*[64]int, []uint64, []uint64)
+		op    func(uint64, uint64) uint64
+	}{
+		{"And", CountAnd64, func(x, y uint64) uint64 { return x & y }},
+		{"Or", CountOr64, func(x, y uint64) uint64 { return x | y }},
+		{"Xor", CountXor64, func(x, y uint64) uint64 { return x ^ y }},
+		{"AndNot", CountAndNot64, func(x, y uint64) uint64 { return x &^ y }},
+	}
+
+	for _, f := range funcs {
+		for _, len := range testLengths {
+			a := make([]uint64, len)
+			b := make([]uint64, len)
+			c := make([]uint64, len)
+			for i := range a {
+				a[i], b[i] = rand.Uint64(), rand.Uint64()
+				c[i] = f.op(a[i], b[i])
+			}
+
+			var counts, refCounts [64]int
+			randomCounts(counts[:])
+			refCounts = counts
+
+			f.count(&counts, a, b)
+			count64safe(&refCounts, c)
+
+			if counts != refCounts {
+				t.Errorf("%s, length %d: counts don't match: %v\n", f.name, len, countDiff(counts[:], refCounts[:]))
+			}
+		}
+	}
+}
+
+// test the correctness of CountXor8
+func TestCountXor8(t *testing.T) {
+	a := []uint8{0x0f, 0xff, 0x00}
+	b := []uint8{0xf0, 0xff, 0x81}
+
+	var counts [8]int
+	CountXor8(&counts, a, b)
+	if counts != [8]int{2, 1, 1, 1, 1, 1, 1, 2} {
+		t.Errorf("wrong counts: %v", counts)
+	}
+}
+
+// test the correctness of a count#binop kernel for elements of type T
+// with a and b differently misaligned
+func testCountBinopKernel[T word](t *testing.T, count func(counts []int, a, b []T, op binop)) {
+	var zero T
+	nbits := 8 * int(unsafe.Sizeof(zero))
+
+	for op := opAnd; op <= opAndNot; op++ {
+		for _, len := range testLengths {
+			len &^= 8/int(unsafe.Sizeof(zero)) - 1 // whole qwords only
+			a := make([]T, len+1)[1:]
+			b := make([]T, len+3)[3:]
+			for i := range a {
+				a[i], b[i] = T(rand.Uint64()), T(rand.Uint64())
+			}
+
+			counts := make([]int, nbits)
+			randomCounts(counts)
+			refCounts := append([]int(nil), counts...)
+
+			c := make([]T, len)
+			combine(c, a, b, op)
+			count(counts, a, b, op)
+			for _, x := range c {
+				for j := range refCounts {
+					refCounts[j] += int(uint64(x) >> j & 1)
+				}
+			}
+
+			if !equalCounts(counts, refCounts) {
+				t.Errorf("op %d, length %d: counts don't match: %v\n", op, len, countDiff(counts, refCounts))
+			}
+		}
+	}
+}
+
+// test the correctness of all count#binop implementations
+func TestCountBinopKernels(t *testing.T) {
+	for i := range count8binopfuncs {
+		t.Run("8/"+count8binopfuncs[i].name, func(tt *testing.T) {
+			if !count8binopfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountBinopKernel(tt, func(counts []int, a, b []uint8, op binop) {
+				count8binopfuncs[i].count8binop((*[8]int)(counts), a, b, op)
+			})
+		})
+	}
+
+	for i := range count16binopfuncs {
+		t.Run("16/"+count16binopfuncs[i].name, func(tt *testing.T) {
+			if !count16binopfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountBinopKernel(tt, func(counts []int, a, b []uint16, op binop) {
+				count16binopfuncs[i].count16binop((*[16]int)(counts), a, b, op)
+			})
+		})
+	}
+
+	for i := range count32binopfuncs {
+		t.Run("32/"+count32binopfuncs[i].name, func(tt *testing.T) {
+			if !count32binopfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountBinopKernel(tt, func(counts []int, a, b []uint32, op binop) {
+				count32binopfuncs[i].count32binop((*[32]int)(counts), a, b, op)
+			})
+		})
+	}
+
+	for i := range count64binopfuncs {
+		t.Run("64/"+count64binopfuncs[i].name, func(tt *testing.T) {
+			if !count64binopfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountBinopKernel(tt, func(counts []int, a, b []uint64, op binop) {
+				count64binopfuncs[i].count64binop((*[64]int)(counts), a, b, op)
+			})
+		})
+	}
+}
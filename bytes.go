@@ -0,0 +1,86 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"unsafe"
+)
+
+// Determine where order places the bytes of a value of size bytes:
+// byte k of the encoding is byte perm[k] of the value, where byte 0 is
+// the least significant byte.
+func byteOrderPerm(order binary.ByteOrder, size int) (perm [8]int) {
+	var buf [8]byte
+
+	for k := 0; k < size; k++ {
+		buf[k] = 1
+
+		var v uint64
+		switch size {
+		case 2:
+			v = uint64(order.Uint16(buf[:]))
+		case 4:
+			v = uint64(order.Uint32(buf[:]))
+		case 8:
+			v = order.Uint64(buf[:])
+		}
+
+		perm[k] = bits.TrailingZeros64(v) / 8
+		buf[k] = 0
+	}
+
+	return
+}
+
+// count the whole words of type T in data, encoded in byte order
+// order, and return the trailing partial word.  The words are counted
+// in place as a stream of bytes with a period of one word, then the
+// counters for byte k of the encoding are added to the counters for
+// byte perm[k] of the decoded value.
+func countBytes[T uint16 | uint32 | uint64](counts []int, data []byte, order binary.ByteOrder) []byte {
+	var zero T
+	var slots [64]int
+	size := int(unsafe.Sizeof(zero))
+	n := len(data) / size
+
+	countByteSlots(slots[:8*size], data[:n*size], size)
+
+	perm := byteOrderPerm(order, size)
+	for k := 0; k < size; k++ {
+		addCounts(counts[8*perm[k]:8*perm[k]+8], slots[8*k:8*k+8])
+	}
+
+	return data[n*size:]
+}
+
+// Count the number of corresponding set bits of the 16 bit words
+// encoded in data in byte order order and add the results to counts
+// as with Count16.  Only whole words are counted; the trailing bytes
+// of a partial word at the end of data are returned.  The words are
+// counted in place regardless of the alignment of data, with the
+// counters permuted afterwards to match order.
+func CountBytes16(counts *[16]int, data []byte, order binary.ByteOrder) (rest []byte) {
+	return countBytes[uint16](counts[:], data, order)
+}
+
+// Count the number of corresponding set bits of the 32 bit words
+// encoded in data in byte order order and add the results to counts
+// as with Count32.  Only whole words are counted; the trailing bytes
+// of a partial word at the end of data are returned.  The words are
+// counted in place regardless of the alignment of data, with the
+// counters permuted afterwards to match order.
+func CountBytes32(counts *[32]int, data []byte, order binary.ByteOrder) (rest []byte) {
+	return countBytes[uint32](counts[:], data, order)
+}
+
+// Count the number of corresponding set bits of the 64 bit words
+// encoded in data in byte order order and add the results to counts
+// as with Count64.  Only whole words are counted; the trailing bytes
+// of a partial word at the end of data are returned.  The words are
+// counted in place regardless of the alignment of data, with the
+// counters permuted afterwards to match order.
+func CountBytes64(counts *[64]int, data []byte, order binary.ByteOrder) (rest []byte) {
+	return countBytes[uint64](counts[:], data, order)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+// test the correctness of CountBytes32 for both byte orders,
+// misaligned data, and trailing partial words
+func TestCountBytes32(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for _, len := range testLengths {
+			for _, offset := range []int{0, 1, 2, 3} {
+				raw := make([]byte, len+offset)
+				rand.Read(raw)
+				data := raw[offset:]
+
+				words := make([]uint32, len/4)
+				for i := range words {
+					words[i] = order.Uint32(data[4*i:])
+				}
+
+				var counts, refCounts [32]int
+				randomCounts(counts[:])
+				refCounts = counts
+
+				rest := CountBytes32(&counts, data, order)
+				count32safe(&refCounts, words)
+
+				if counts != refCounts {
+					t.Errorf("%v, length %d, offset %d: counts don't match: %v\n",
+						order, len, offset, countDiff(counts[:], refCounts[:]))
+				}
+
+				if string(rest) != string(data[4*(len/4):]) {
+					t.Errorf("%v, length %d, offset %d: wrong rest %v", order, len, offset, rest)
+				}
+			}
+		}
+	}
+}
+
+// test the correctness of CountBytes16 and CountBytes64
+func TestCountBytes(t *testing.T) {
+	data := make([]byte, 8*1000+7)
+	rand.Read(data)
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		var counts16, refCounts16 [16]int
+		var counts64, refCounts64 [64]int
+
+		rest16 := CountBytes16(&counts16, data[1:], order)
+		rest64 := CountBytes64(&counts64, data[1:], order)
+		for i := 1; i+2 <= len(data); i += 2 {
+			count16safe(&refCounts16, []uint16{order.Uint16(data[i:])})
+		}
+
+		for i := 1; i+8 <= len(data); i += 8 {
+			count64safe(&refCounts64, []uint64{order.Uint64(data[i:])})
+		}
+
+		if counts16 != refCounts16 || len(rest16) != 0 {
+			t.Errorf("%v: CountBytes16: counts don't match: %v\n", order, countDiff(counts16[:], refCounts16[:]))
+		}
+
+		if counts64 != refCounts64 || len(rest64) != 6 {
+			t.Errorf("%v: CountBytes64: counts don't match: %v\n", order, countDiff(counts64[:], refCounts64[:]))
+		}
+	}
+}
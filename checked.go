@@ -0,0 +1,65 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"errors"
+	"math"
+	"unsafe"
+)
+
+// ErrOverflow is returned by the Checked family of functions if a
+// counter would overflow.
+var ErrOverflow = errors.New("pospop: counter overflow")
+
+// Count buf into zeroed counters, then add the result to counts if
+// none of the counters overflow.  As no counter can exceed len(buf),
+// the intermediate counts never overflow.  The check is done once per
+// call and not once per element.
+func countChecked[T Element](counts []int, buf []T) error {
+	var local [64]int
+
+	Count(local[:len(counts)], buf)
+	for i := range counts {
+		if counts[i] > math.MaxInt-local[i] {
+			return ErrOverflow
+		}
+	}
+
+	for i := range counts {
+		counts[i] += local[i]
+	}
+
+	return nil
+}
+
+// Like CountString, but check for overflow.  If any counter would
+// overflow, counts is left unchanged and ErrOverflow is returned.
+func CountStringChecked(counts *[8]int, str string) error {
+	buf := unsafe.Slice(unsafe.StringData(str), len(str))
+	return countChecked(counts[:], buf)
+}
+
+// Like Count8, but check for overflow.  If any counter would overflow,
+// counts is left unchanged and ErrOverflow is returned.
+func Count8Checked(counts *[8]int, buf []uint8) error {
+	return countChecked(counts[:], buf)
+}
+
+// Like Count16, but check for overflow.  If any counter would
+// overflow, counts is left unchanged and ErrOverflow is returned.
+func Count16Checked(counts *[16]int, buf []uint16) error {
+	return countChecked(counts[:], buf)
+}
+
+// Like Count32, but check for overflow.  If any counter would
+// overflow, counts is left unchanged and ErrOverflow is returned.
+func Count32Checked(counts *[32]int, buf []uint32) error {
+	return countChecked(counts[:], buf)
+}
+
+// Like Count64, but check for overflow.  If any counter would
+// overflow, counts is left unchanged and ErrOverflow is returned.
+func Count64Checked(counts *[64]int, buf []uint64) error {
+	return countChecked(counts[:], buf)
+}
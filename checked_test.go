@@ -0,0 +1,101 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// test that Count64Checked computes the right counts
+func TestCount64Checked(t *testing.T) {
+	for _, len := range testLengths {
+		buf := make([]uint64, len)
+		for i := range buf {
+			buf[i] = rand.Uint64()
+		}
+
+		var counts, refCounts [64]int
+		count64safe(&refCounts, buf)
+
+		err := Count64Checked(&counts, buf)
+		if err != nil {
+			t.Errorf("length %d: unexpected error: %v", len, err)
+		}
+
+		if counts != refCounts {
+			t.Errorf("length %d: counts don't match: %v\n", len, countDiff(counts[:], refCounts[:]))
+		}
+	}
+}
+
+// test that overflow is detected and leaves the counters unchanged
+func TestCountChecked(t *testing.T) {
+	buf := make([]uint64, 1000)
+	for i := range buf {
+		buf[i] = ^uint64(0)
+	}
+
+	// fill counters right up to the limit
+	var counts [64]int
+	for i := range counts {
+		counts[i] = math.MaxInt - len(buf)
+	}
+
+	counts[42]--
+	err := Count64Checked(&counts, buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if counts[0] != math.MaxInt || counts[42] != math.MaxInt-1 {
+		t.Fatalf("wrong counts: %v", counts)
+	}
+
+	// all counters but counts[42] overflow now
+	refCounts := counts
+	err = Count64Checked(&counts, buf[:1])
+	if err != ErrOverflow {
+		t.Errorf("expected ErrOverflow, got %v", err)
+	}
+
+	if counts != refCounts {
+		t.Errorf("counts modified despite overflow: %v\n", countDiff(counts[:], refCounts[:]))
+	}
+
+	// no overflow if the bits are clear
+	buf[0] = 1 << 42
+	err = Count64Checked(&counts, buf[:1])
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if counts[42] != math.MaxInt {
+		t.Errorf("counts[42] = %d, expected %d", counts[42], math.MaxInt)
+	}
+
+	// also check the other widths
+	var counts8 [8]int
+	var counts16 [16]int
+	var counts32 [32]int
+	counts8[7] = math.MaxInt
+	counts16[15] = math.MaxInt
+	counts32[31] = math.MaxInt
+
+	if err := Count8Checked(&counts8, []uint8{0x80}); err != ErrOverflow {
+		t.Errorf("Count8Checked: expected ErrOverflow, got %v", err)
+	}
+
+	if err := CountStringChecked(&counts8, "\x7f"); err != nil {
+		t.Errorf("CountStringChecked: unexpected error: %v", err)
+	}
+
+	if err := Count16Checked(&counts16, []uint16{0x8000}); err != ErrOverflow {
+		t.Errorf("Count16Checked: expected ErrOverflow, got %v", err)
+	}
+
+	if err := Count32Checked(&counts32, []uint32{0x80000000}); err != ErrOverflow {
+		t.Errorf("Count32Checked: expected ErrOverflow, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import "unsafe"
+
+// Add the number of elements of buf with both bit i and bit j set to
+// m[i*bits+j].  The buffer is processed in chunks of stageLen
+// elements.  For each bit i, the elements of the chunk with bit i clear
+// are masked out onto a stage and the result is counted with the
+// regular kernels into row i of m.
+func coCount[T word](m []int, buf []T) {
+	var s stage[T]
+	var zero T
+	bits := 8 * int(unsafe.Sizeof(zero))
+
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > stageLen {
+			n = stageLen
+		}
+
+		chunk := buf[:n]
+
+		// bits set in any element of the chunk
+		var seen T
+		for _, x := range chunk {
+			seen |= x
+		}
+
+		for i := 0; i < bits; i++ {
+			if seen>>i&1 == 0 {
+				continue
+			}
+
+			masked := s.buf[:n]
+			for k, x := range chunk {
+				masked[k] = x & -(x >> i & 1)
+			}
+
+			Count(m[i*bits:(i+1)*bits], masked)
+		}
+
+		buf = buf[n:]
+	}
+}
+
+// Compute the bit co-occurrence matrix of the values in buf and add
+// the results to m: m[i][j] is incremented for every value with both
+// bit i and bit j set.  The matrix is symmetric and its diagonal is
+// the positional population count as computed by Count8.
+func CoCount8(m *[8][8]int, buf []uint8) {
+	coCount(unsafe.Slice(&m[0][0], 8*8), buf)
+}
+
+// Compute the bit co-occurrence matrix of the values in buf and add
+// the results to m: m[i][j] is incremented for every value with both
+// bit i and bit j set.  The matrix is symmetric and its diagonal is
+// the positional population count as computed by Count16.
+func CoCount16(m *[16][16]int, buf []uint16) {
+	coCount(unsafe.Slice(&m[0][0], 16*16), buf)
+}
+
+// Compute the bit co-occurrence matrix of the values in buf and add
+// the results to m: m[i][j] is incremented for every value with both
+// bit i and bit j set.  The matrix is symmetric and its diagonal is
+// the positional population count as computed by Count32.
+func CoCount32(m *[32][32]int, buf []uint32) {
+	coCount(unsafe.Slice(&m[0][0], 32*32), buf)
+}
+
+// Compute the bit co-occurrence matrix of the values in buf and add
+// the results to m: m[i][j] is incremented for every value with both
+// bit i and bit j set.  The matrix is symmetric and its diagonal is
+// the positional population count as computed by Count64.
+func CoCount64(m *[64][64]int, buf []uint64) {
+	coCount(unsafe.Slice(&m[0][0], 64*64), buf)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// test the correctness of CoCount16
+func TestCoCount16(t *testing.T) {
+	for _, len := range testLengths {
+		if len > minimizationThreshold {
+			continue
+		}
+
+		buf := make([]uint16, len)
+		for i := range buf {
+			// make some bits rare to exercise skipping them
+			buf[i] = uint16(rand.Int()) & uint16(rand.Int()) & uint16(rand.Int())
+		}
+
+		var m, refM [16][16]int
+		for i := range m {
+			randomCounts(m[i][:])
+		}
+
+		refM = m
+		CoCount16(&m, buf)
+		for _, x := range buf {
+			for i := 0; i < 16; i++ {
+				for j := 0; j < 16; j++ {
+					refM[i][j] += int((x >> i) & (x >> j) & 1)
+				}
+			}
+		}
+
+		for i := range m {
+			if m[i] != refM[i] {
+				t.Errorf("length %d, row %d: counts don't match: %v\n", len, i, countDiff(m[i][:], refM[i][:]))
+			}
+		}
+	}
+}
+
+// test that the diagonal of CoCount64 is the positional population count
+func TestCoCount64(t *testing.T) {
+	buf := make([]uint64, 5000)
+	for i := range buf {
+		buf[i] = rand.Uint64()
+	}
+
+	var m [64][64]int
+	var diag, refCounts [64]int
+	CoCount64(&m, buf)
+	count64safe(&refCounts, buf)
+	for i := range diag {
+		diag[i] = m[i][i]
+		for j := range m {
+			if m[i][j] != m[j][i] {
+				t.Errorf("matrix not symmetric at %d, %d", i, j)
+			}
+		}
+	}
+
+	if diag != refCounts {
+		t.Errorf("diagonal doesn't match: %v\n", countDiff(diag[:], refCounts[:]))
+	}
+}
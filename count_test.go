@@ -3,8 +3,10 @@
 package pospop
 
 import (
+	"math"
 	"math/rand"
 	"testing"
+	"unsafe"
 )
 
 // standard test lengths to try
@@ -49,6 +51,17 @@ func countDiff(a []int, b []int) []int {
 	return res
 }
 
+// check if two equally long integer slices are equal
+func equalCounts(a []int, b []int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
 // test the correctness of a count8 implementation
 func testCount8(t *testing.T, count8 func(*[8]int, []uint8)) {
 	for _, len := range testLengths {
@@ -211,3 +224,94 @@ func TestCount64(t *testing.T) {
 		})
 	}
 }
+
+// test the correctness of Count for an element type T, using conv to
+// turn the random words into elements of type T.
+func testCountGeneric[T Element](t *testing.T, conv func(uint64) T, ref func([]int, []T)) {
+	var zero T
+	nbits := 8 * int(unsafe.Sizeof(zero))
+
+	for _, len := range testLengths {
+		buf := make([]T, len+1)
+		buf = buf[1 : len+1] // ensure misalignment
+		for i := range buf {
+			buf[i] = conv(rand.Uint64())
+		}
+
+		counts := make([]int, nbits)
+		randomCounts(counts)
+		refCounts := append([]int(nil), counts...)
+
+		Count(counts, buf)
+		ref(refCounts, buf)
+
+		if !equalCounts(counts, refCounts) {
+			t.Errorf("length %d: counts don't match: %v\n", len, countDiff(counts, refCounts))
+		}
+	}
+}
+
+// named types to check that Count accepts them
+type flags16 uint16
+type flags32 int32
+
+// test the correctness of Count for various element types
+func TestCount(t *testing.T) {
+	t.Run("int8", func(tt *testing.T) {
+		testCountGeneric(tt, func(x uint64) int8 { return int8(x) }, func(counts []int, buf []int8) {
+			for _, x := range buf {
+				count8safe((*[8]int)(counts), []uint8{uint8(x)})
+			}
+		})
+	})
+
+	t.Run("flags16", func(tt *testing.T) {
+		testCountGeneric(tt, func(x uint64) flags16 { return flags16(x) }, func(counts []int, buf []flags16) {
+			for _, x := range buf {
+				count16safe((*[16]int)(counts), []uint16{uint16(x)})
+			}
+		})
+	})
+
+	t.Run("flags32", func(tt *testing.T) {
+		testCountGeneric(tt, func(x uint64) flags32 { return flags32(x) }, func(counts []int, buf []flags32) {
+			for _, x := range buf {
+				count32safe((*[32]int)(counts), []uint32{uint32(x)})
+			}
+		})
+	})
+
+	t.Run("float32", func(tt *testing.T) {
+		testCountGeneric(tt, func(x uint64) float32 { return math.Float32frombits(uint32(x)) }, func(counts []int, buf []float32) {
+			for _, x := range buf {
+				count32safe((*[32]int)(counts), []uint32{math.Float32bits(x)})
+			}
+		})
+	})
+
+	t.Run("int64", func(tt *testing.T) {
+		testCountGeneric(tt, func(x uint64) int64 { return int64(x) }, func(counts []int, buf []int64) {
+			for _, x := range buf {
+				count64safe((*[64]int)(counts), []uint64{uint64(x)})
+			}
+		})
+	})
+
+	t.Run("float64", func(tt *testing.T) {
+		testCountGeneric(tt, math.Float64frombits, func(counts []int, buf []float64) {
+			for _, x := range buf {
+				count64safe((*[64]int)(counts), []uint64{math.Float64bits(x)})
+			}
+		})
+	})
+
+	t.Run("uint", func(tt *testing.T) {
+		testCountGeneric(tt, func(x uint64) uint { return uint(x) }, func(counts []int, buf []uint) {
+			for _, x := range buf {
+				for j := range counts {
+					counts[j] += int(x >> j & 1)
+				}
+			}
+		})
+	})
+}
@@ -326,7 +326,11 @@ tail1:	SUBL $-8, BP			// anything left to process?
 	BYTE $0x2e
 	MOVL $window<>+32(SB), AX	// load window address
 	SUBL BP, AX			// adjust mask pointer
-	VMOVQ (AX), X6			// load window mask
+//	VMOVQ (AX), X6			// load window mask
+	BYTE $0xc5
+	BYTE $0xfa
+	BYTE $0x7e
+	BYTE $0x30
 	VPANDN X5, X6, X5		// and mask out the desired bytes
 
 	VPBROADCASTD X5, Y4
@@ -501,3 +505,137 @@ TEXT ·count64avx2(SB), 0, $0-16
 	SHLL $3, BP			// count in bytes
 	CALL countavx<>(SB)
 	RET
+
+// zero-extend the dwords in Y to qwords and add them to a*8(DI) to
+// (a+7)*8(DI).  X is the low half of Y.  Trashes Y6 and Y7.
+#define ACCUMQ(a, Y, X) \
+	VEXTRACTI128 $1, Y, X7 \
+	VPMOVZXDQ X, Y6 \
+	VPMOVZXDQ X7, Y7 \
+	VPADDQ (a)*8(DI), Y6, Y6 \
+	VPADDQ (a+4)*8(DI), Y7, Y7 \
+	VMOVDQU Y6, (a)*8(DI) \
+	VMOVDQU Y7, (a+4)*8(DI)
+
+// Count8 accumulation function.  Accumulates words
+// into 8 qword counters at (DI).  Trashes Y0--Y7.
+TEXT accum8u64<>(SB), NOSPLIT, $0-0
+	VPMOVZXWD 0*16(DX), Y0
+	VPMOVZXWD 1*16(DX), Y2
+	VPMOVZXWD 2*16(DX), Y1
+	VPMOVZXWD 3*16(DX), Y3
+	VPMOVZXWD 4*16(DX), Y4
+	VPMOVZXWD 5*16(DX), Y6
+	VPMOVZXWD 6*16(DX), Y5
+	VPMOVZXWD 7*16(DX), Y7
+	VPADDD Y0, Y4, Y0
+	VPADDD Y1, Y5, Y1
+	VPADDD Y2, Y6, Y2
+	VPADDD Y3, Y7, Y3
+	VPADDD Y0, Y2, Y0
+	VPADDD Y1, Y3, Y1
+	VPADDD Y1, Y0, Y0
+	ACCUMQ(0, Y0, X0)
+	RET
+
+// Count16 accumulation function.  Accumulates words
+// into 16 qword counters at (DI).  Trashes Y0--Y7.
+TEXT accum16u64<>(SB), NOSPLIT, $0-0
+	VPMOVZXWD 0*16(DX), Y0
+	VPMOVZXWD 1*16(DX), Y2
+	VPMOVZXWD 2*16(DX), Y1
+	VPMOVZXWD 3*16(DX), Y3
+	VPMOVZXWD 4*16(DX), Y4
+	VPMOVZXWD 5*16(DX), Y6
+	VPMOVZXWD 6*16(DX), Y5
+	VPMOVZXWD 7*16(DX), Y7
+	VPADDD Y0, Y4, Y0
+	VPADDD Y1, Y5, Y1
+	VPADDD Y2, Y6, Y2
+	VPADDD Y3, Y7, Y3
+	VPADDD Y0, Y2, Y0
+	VPADDD Y1, Y3, Y1
+	ACCUMQ(0, Y0, X0)
+	ACCUMQ(8, Y1, X1)
+	RET
+
+// Count32 accumulation function.  Accumulates words
+// into 32 qword counters at (DI).  Trashes Y0--Y7.
+TEXT accum32u64<>(SB), NOSPLIT, $0-0
+	VPMOVZXWD 0*16(DX), Y0
+	VPMOVZXWD 1*16(DX), Y2
+	VPMOVZXWD 2*16(DX), Y1
+	VPMOVZXWD 3*16(DX), Y3
+	VPMOVZXWD 4*16(DX), Y4
+	VPMOVZXWD 5*16(DX), Y6
+	VPMOVZXWD 6*16(DX), Y5
+	VPMOVZXWD 7*16(DX), Y7
+	VPADDD Y0, Y4, Y0
+	VPADDD Y1, Y5, Y1
+	VPADDD Y2, Y6, Y2
+	VPADDD Y3, Y7, Y3
+	ACCUMQ(0, Y0, X0)
+	ACCUMQ(8, Y1, X1)
+	ACCUMQ(16, Y2, X2)
+	ACCUMQ(24, Y3, X3)
+	RET
+
+// Count64 accumulation function.  Accumulates words
+// into 64 qword counters at (DI).  Trashes Y0--Y7.
+TEXT accum64u64<>(SB), NOSPLIT, $0-0
+	VPMOVZXWD 0*16(DX), Y0
+	VPMOVZXWD 1*16(DX), Y2
+	VPMOVZXWD 2*16(DX), Y1
+	VPMOVZXWD 3*16(DX), Y3
+	ACCUMQ(0, Y0, X0)
+	ACCUMQ(8, Y1, X1)
+	ACCUMQ(16, Y2, X2)
+	ACCUMQ(24, Y3, X3)
+	VPMOVZXWD 4*16(DX), Y0
+	VPMOVZXWD 5*16(DX), Y2
+	VPMOVZXWD 6*16(DX), Y1
+	VPMOVZXWD 7*16(DX), Y3
+	ACCUMQ(32, Y0, X0)
+	ACCUMQ(40, Y1, X1)
+	ACCUMQ(48, Y2, X2)
+	ACCUMQ(56, Y3, X3)
+	RET
+
+// func count8avx2u64(counts *[8]uint64, buf []uint8)
+TEXT ·count8avx2u64(SB), 0, $0-16
+	MOVL counts+0(FP), DI
+	MOVL buf_base+4(FP), SI		// SI = &buf[0]
+	MOVL buf_len+8(FP), BP		// BP = len(buf)
+	MOVL $accum8u64<>(SB), BX
+	CALL countavx<>(SB)
+	RET
+
+// func count16avx2u64(counts *[16]uint64, buf []uint16)
+TEXT ·count16avx2u64(SB), 0, $0-16
+	MOVL counts+0(FP), DI
+	MOVL buf_base+4(FP), SI		// SI = &buf[0]
+	MOVL buf_len+8(FP), BP		// BP = len(buf)
+	MOVL $accum16u64<>(SB), BX
+	SHLL $1, BP			// count in bytes
+	CALL countavx<>(SB)
+	RET
+
+// func count32avx2u64(counts *[32]uint64, buf []uint32)
+TEXT ·count32avx2u64(SB), 0, $0-16
+	MOVL counts+0(FP), DI
+	MOVL buf_base+4(FP), SI		// SI = &buf[0]
+	MOVL buf_len+8(FP), BP		// BP = len(buf)
+	MOVL $accum32u64<>(SB), BX
+	SHLL $2, BP			// count in bytes
+	CALL countavx<>(SB)
+	RET
+
+// func count64avx2u64(counts *[64]uint64, buf []uint64)
+TEXT ·count64avx2u64(SB), 0, $0-16
+	MOVL counts+0(FP), DI
+	MOVL buf_base+4(FP), SI		// SI = &buf[0]
+	MOVL buf_len+8(FP), BP		// BP = len(buf)
+	MOVL $accum64u64<>(SB), BX
+	SHLL $3, BP			// count in bytes
+	CALL countavx<>(SB)
+	RET
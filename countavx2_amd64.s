@@ -1,4 +1,5 @@
 #include "textflag.h"
+#include "go_asm.h"
 
 // An AVX2 based kernel first doing a 15-fold CSA reduction and then
 // a 16-fold CSA reduction, carrying over place-value vectors between
@@ -528,3 +529,796 @@ TEXT ·count64avx2(SB), 0, $0-32
 	SHLQ $3, CX			// count in bytes
 	CALL countavx2<>(SB)
 	RET
+
+// add the dwords in the low half of Y to a*4(DI) to (a+3)*4(DI) and
+// those in the high half to b*4(DI) to (b+3)*4(DI).  X is the low half
+// of Y.  Trashes Y and Y4.
+#define ACCUMD(a, b, Y, X) \
+	VEXTRACTI128 $1, Y, X4 \
+	VPADDD (a)*4(DI), X, X \
+	VPADDD (b)*4(DI), X4, X4 \
+	VMOVDQU X, (a)*4(DI) \
+	VMOVDQU X4, (b)*4(DI)
+
+// Count8 accumulation function.  Accumulates words Y8--Y11
+// into 8 dword counters at (DI).  Trashes Y0--Y12.
+TEXT accum8u32<>(SB), NOSPLIT, $0-0
+	FOLD32
+
+	VPADDD Y14, Y12, Y12		// 0- 3,  0- 3
+	VPADDD Y9, Y8, Y8		// 4- 7,  4- 7
+	VPERM2I128 $0x20, Y8, Y12, Y14
+	VPERM2I128 $0x31, Y8, Y12, Y4
+	VPADDD Y4, Y14, Y12		// 0- 3,  4- 7
+	VPADDD 0*32(DI), Y12, Y12
+	VMOVDQU Y12, 0*32(DI)
+	RET
+
+// Count16 accumulation function.  Accumulates words Y8--Y11
+// into 16 dword counters at (DI).  Trashes Y0--Y12.
+TEXT accum16u32<>(SB), NOSPLIT, $0-0
+	FOLD32
+
+	// fold over upper 16 bit over lower 32 counters
+	VPERM2I128 $0x20, Y8, Y12, Y4	//  0- 3,  4- 7
+	VPERM2I128 $0x31, Y8, Y12, Y10	// 16-19, 20-23
+	VPADDD Y4, Y10, Y12		//  0- 7
+	VPERM2I128 $0x20, Y9, Y14, Y5	//  8-11, 12-15
+	VPERM2I128 $0x31, Y9, Y14, Y11	// 24-27, 29-31
+	VPADDD Y5, Y11, Y4		//  8-15
+
+	// add to counters
+	VPADDD 0*32(DI), Y12, Y12
+	VPADDD 1*32(DI), Y4, Y4
+	VMOVDQU Y12, 0*32(DI)
+	VMOVDQU Y4, 1*32(DI)
+
+	RET
+
+// Count32 accumulation function.  Accumulates words Y8--Y11
+// int 32 dword counters at (DI).  Trashes Y0--Y12
+TEXT accum32u32<>(SB), NOSPLIT, $0-0
+	FOLD32
+
+	ACCUMD( 0, 16, Y12, X12)
+	ACCUMD( 4, 20, Y8, X8)
+	ACCUMD( 8, 24, Y14, X14)
+	ACCUMD(12, 28, Y9, X9)
+
+	RET
+
+// accumulate the 16 counters in Y into k*4(DI) to (k+15)*4(DI)
+// trashes Y4, Y12, and Y14.  Assumes Y7 == 0
+#define ACCUM64D(k, Y) \
+	VPUNPCKLWD Y7, Y, Y12 \
+	VPUNPCKHWD Y7, Y, Y14 \
+	ACCUMD(k, k+16, Y12, X12) \
+	ACCUMD(k+4, k+20, Y14, X14)
+
+// Count64 accumulation function.  Accumulates words Y8--Y11
+// into 64 dword counters at (DI).  Trashes Y0--Y12.
+TEXT accum64u32<>(SB), NOSPLIT, $0-0
+	ACCUM64D(0, Y8)
+	ACCUM64D(8, Y9)
+	ACCUM64D(32, Y10)
+	ACCUM64D(40, Y11)
+	RET
+
+// func count8avx2u32(counts *[8]uint32, buf []uint8)
+TEXT ·count8avx2u32(SB), 0, $0-32
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum8u32<>(SB), BX
+	CALL countavx2<>(SB)
+	RET
+
+// func count16avx2u32(counts *[16]uint32, buf []uint16)
+TEXT ·count16avx2u32(SB), 0, $0-32
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum16u32<>(SB), BX
+	SHLQ $1, CX			// count in bytes
+	CALL countavx2<>(SB)
+	RET
+
+// func count32avx2u32(counts *[32]uint32, buf []uint32)
+TEXT ·count32avx2u32(SB), 0, $0-32
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum32u32<>(SB), BX
+	SHLQ $2, CX			// count in bytes
+	CALL countavx2<>(SB)
+	RET
+
+// func count64avx2u32(counts *[64]uint32, buf []uint64)
+TEXT ·count64avx2u32(SB), 0, $0-32
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum64u32<>(SB), BX
+	SHLQ $3, CX			// count in bytes
+	CALL countavx2<>(SB)
+	RET
+
+// Fused kernels counting a[i] op b[i] for the bitwise operations op.
+// The input buffers a and b are in SI and R8.
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	ADDQ $(n), R8
+
+#define KERNEL countandavx2<>
+#define LOAD(k, Y) \
+	VMOVDQU (k)*32(R8), Y \
+	VPAND (k)*32(SI), Y, Y
+#define LOADQ(R) \
+	MOVQ (R8), R \
+	ANDQ (SI), R \
+	ADVANCE(8)
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL countoravx2<>
+#define LOAD(k, Y) \
+	VMOVDQU (k)*32(R8), Y \
+	VPOR (k)*32(SI), Y, Y
+#define LOADQ(R) \
+	MOVQ (R8), R \
+	ORQ (SI), R \
+	ADVANCE(8)
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL countxoravx2<>
+#define LOAD(k, Y) \
+	VMOVDQU (k)*32(R8), Y \
+	VPXOR (k)*32(SI), Y, Y
+#define LOADQ(R) \
+	MOVQ (R8), R \
+	XORQ (SI), R \
+	ADVANCE(8)
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+// a &^ b = ~b & a
+#define KERNEL countandnotavx2<>
+#define LOAD(k, Y) \
+	VMOVDQU (k)*32(R8), Y \
+	VPANDN (k)*32(SI), Y, Y
+#define LOADQ(R) \
+	MOVQ (R8), R11 \
+	ANDNQ (SI), R11, R \
+	ADVANCE(8)
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+// Call the fused kernel for the bitwise operation in DX.
+TEXT binopavx2<>(SB), NOSPLIT, $0-0
+	CMPQ DX, $const_opOr
+	JEQ or
+	CMPQ DX, $const_opXor
+	JEQ xor
+	CMPQ DX, $const_opAndNot
+	JEQ andnot
+	JMP countandavx2<>(SB)
+or:	JMP countoravx2<>(SB)
+xor:	JMP countxoravx2<>(SB)
+andnot:	JMP countandnotavx2<>(SB)
+
+// func count8avx2binop(counts *[8]int, a, b []uint8, op binop)
+TEXT ·count8avx2binop(SB), 0, $0-64
+	MOVQ counts+0(FP), DI
+	MOVQ a_base+8(FP), SI		// SI = &a[0]
+	MOVQ a_len+16(FP), CX		// CX = len(a)
+	MOVQ b_base+32(FP), R8		// R8 = &b[0]
+	MOVQ op+56(FP), DX
+	MOVQ $accum8<>(SB), BX
+	CALL binopavx2<>(SB)
+	RET
+
+// func count16avx2binop(counts *[16]int, a, b []uint16, op binop)
+TEXT ·count16avx2binop(SB), 0, $0-64
+	MOVQ counts+0(FP), DI
+	MOVQ a_base+8(FP), SI		// SI = &a[0]
+	MOVQ a_len+16(FP), CX		// CX = len(a)
+	MOVQ b_base+32(FP), R8		// R8 = &b[0]
+	MOVQ op+56(FP), DX
+	MOVQ $accum16<>(SB), BX
+	SHLQ $1, CX			// count in bytes
+	CALL binopavx2<>(SB)
+	RET
+
+// func count32avx2binop(counts *[32]int, a, b []uint32, op binop)
+TEXT ·count32avx2binop(SB), 0, $0-64
+	MOVQ counts+0(FP), DI
+	MOVQ a_base+8(FP), SI		// SI = &a[0]
+	MOVQ a_len+16(FP), CX		// CX = len(a)
+	MOVQ b_base+32(FP), R8		// R8 = &b[0]
+	MOVQ op+56(FP), DX
+	MOVQ $accum32<>(SB), BX
+	SHLQ $2, CX			// count in bytes
+	CALL binopavx2<>(SB)
+	RET
+
+// func count64avx2binop(counts *[64]int, a, b []uint64, op binop)
+TEXT ·count64avx2binop(SB), 0, $0-64
+	MOVQ counts+0(FP), DI
+	MOVQ a_base+8(FP), SI		// SI = &a[0]
+	MOVQ a_len+16(FP), CX		// CX = len(a)
+	MOVQ b_base+32(FP), R8		// R8 = &b[0]
+	MOVQ op+56(FP), DX
+	MOVQ $accum64<>(SB), BX
+	SHLQ $3, CX			// count in bytes
+	CALL binopavx2<>(SB)
+	RET
+
+// Fused kernels counting the elements of buf whose bits are set in
+// the validity bitmap valid, zeroing the others as they are loaded.
+// The buffer is in SI, the bitmap in R9.  The vector loads broadcast
+// the bits of the bitmap for each vector to all lanes, pick one bit
+// per lane, and compare to obtain the lane mask.  The tail is handled
+// by the macros from countmasked_amd64.h.
+#include "countmasked_amd64.h"
+
+// bit of each lane for 8, 16, 32, and 64 bit lanes
+DATA maskbits<>+  0(SB)/8, $0x8040201008040201
+DATA maskbits<>+  8(SB)/8, $0x8040201008040201
+DATA maskbits<>+ 16(SB)/8, $0x8040201008040201
+DATA maskbits<>+ 24(SB)/8, $0x8040201008040201
+DATA maskbits<>+ 32(SB)/8, $0x0008000400020001
+DATA maskbits<>+ 40(SB)/8, $0x0080004000200010
+DATA maskbits<>+ 48(SB)/8, $0x0800040002000100
+DATA maskbits<>+ 56(SB)/8, $0x8000400020001000
+DATA maskbits<>+ 64(SB)/8, $0x0000000200000001
+DATA maskbits<>+ 72(SB)/8, $0x0000000800000004
+DATA maskbits<>+ 80(SB)/8, $0x0000002000000010
+DATA maskbits<>+ 88(SB)/8, $0x0000008000000040
+DATA maskbits<>+ 96(SB)/8, $0x0000000000000001	// low nibble
+DATA maskbits<>+104(SB)/8, $0x0000000000000002
+DATA maskbits<>+112(SB)/8, $0x0000000000000004
+DATA maskbits<>+120(SB)/8, $0x0000000000000008
+DATA maskbits<>+128(SB)/8, $0x0000000000000010	// high nibble
+DATA maskbits<>+136(SB)/8, $0x0000000000000020
+DATA maskbits<>+144(SB)/8, $0x0000000000000040
+DATA maskbits<>+152(SB)/8, $0x0000000000000080
+GLOBL maskbits<>(SB), RODATA|NOPTR, $160
+
+// spread the 4 bytes of the bitmap to the 8 byte groups of the vector
+#define KERNEL countmasked8avx2<>
+#define LOAD(k, Y) \
+	VPBROADCASTD (k)*4(R9), Y7 \
+	VPSHUFB magic<>+0(SB), Y7, Y7 \
+	VPAND maskbits<>+0(SB), Y7, Y7 \
+	VPCMPEQB maskbits<>+0(SB), Y7, Y7 \
+	VPAND (k)*32(SI), Y7, Y
+#define LOADQ(R) MASKEDQ8(R)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	ADDQ $(n)/8, R9
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+#define KERNEL countmasked16avx2<>
+#define LOAD(k, Y) \
+	VPBROADCASTW (k)*2(R9), Y7 \
+	VPAND maskbits<>+32(SB), Y7, Y7 \
+	VPCMPEQW maskbits<>+32(SB), Y7, Y7 \
+	VPAND (k)*32(SI), Y7, Y
+#define LOADQ(R) MASKEDQ16(R)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	ADDQ $(n)/16, R9
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+#define KERNEL countmasked32avx2<>
+#define LOAD(k, Y) \
+	VPBROADCASTB (k)(R9), Y7 \
+	VPAND maskbits<>+64(SB), Y7, Y7 \
+	VPCMPEQD maskbits<>+64(SB), Y7, Y7 \
+	VPAND (k)*32(SI), Y7, Y
+#define LOADQ(R) MASKEDQ32(R)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	ADDQ $(n)/32, R9
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+// each vector takes one nibble of the bitmap
+#define KERNEL countmasked64avx2<>
+#define LOAD(k, Y) \
+	VPBROADCASTB (k)/2(R9), Y7 \
+	VPAND maskbits<>+96+((k)&1)*32(SB), Y7, Y7 \
+	VPCMPEQQ maskbits<>+96+((k)&1)*32(SB), Y7, Y7 \
+	VPAND (k)*32(SI), Y7, Y
+#define LOADQ(R) MASKEDQ64(R)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	ADDQ $(n)/64, R9
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+// func count8avx2masked(counts *[8]int, buf []uint8, valid []byte)
+TEXT ·count8avx2masked(SB), 0, $0-56
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ valid_base+32(FP), R9	// R9 = &valid[0]
+	XORL R12, R12			// R12 = bit index into the tail of valid
+	MOVQ $accum8<>(SB), BX
+	CALL countmasked8avx2<>(SB)
+	RET
+
+// func count16avx2masked(counts *[16]int, buf []uint16, valid []byte)
+TEXT ·count16avx2masked(SB), 0, $0-56
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ valid_base+32(FP), R9	// R9 = &valid[0]
+	XORL R12, R12			// R12 = bit index into the tail of valid
+	MOVQ $accum16<>(SB), BX
+	SHLQ $1, CX			// count in bytes
+	CALL countmasked16avx2<>(SB)
+	RET
+
+// func count32avx2masked(counts *[32]int, buf []uint32, valid []byte)
+TEXT ·count32avx2masked(SB), 0, $0-56
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ valid_base+32(FP), R9	// R9 = &valid[0]
+	XORL R12, R12			// R12 = bit index into the tail of valid
+	MOVQ $accum32<>(SB), BX
+	SHLQ $2, CX			// count in bytes
+	CALL countmasked32avx2<>(SB)
+	RET
+
+// func count64avx2masked(counts *[64]int, buf []uint64, valid []byte)
+TEXT ·count64avx2masked(SB), 0, $0-56
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ valid_base+32(FP), R9	// R9 = &valid[0]
+	XORL R12, R12			// R12 = bit index into the tail of valid
+	MOVQ $accum64<>(SB), BX
+	SHLQ $3, CX			// count in bytes
+	CALL countmasked64avx2<>(SB)
+	RET
+
+// Fused kernels counting the highest (lz) or lowest (tz) set bit of
+// each element of buf, from which the histograms of leading and
+// trailing zeros follow.  The buffer is in SI.  The tail is handled by
+// the macros from countonehot_amd64.h.
+#include "countonehot_amd64.h"
+
+// lane masks for smearing bytes with word shifts
+DATA onehot<>+ 0(SB)/8, $0x7f7f7f7f7f7f7f7f
+DATA onehot<>+ 8(SB)/8, $0x7f7f7f7f7f7f7f7f
+DATA onehot<>+16(SB)/8, $0x7f7f7f7f7f7f7f7f
+DATA onehot<>+24(SB)/8, $0x7f7f7f7f7f7f7f7f
+DATA onehot<>+32(SB)/8, $0x3f3f3f3f3f3f3f3f
+DATA onehot<>+40(SB)/8, $0x3f3f3f3f3f3f3f3f
+DATA onehot<>+48(SB)/8, $0x3f3f3f3f3f3f3f3f
+DATA onehot<>+56(SB)/8, $0x3f3f3f3f3f3f3f3f
+DATA onehot<>+64(SB)/8, $0x0f0f0f0f0f0f0f0f
+DATA onehot<>+72(SB)/8, $0x0f0f0f0f0f0f0f0f
+DATA onehot<>+80(SB)/8, $0x0f0f0f0f0f0f0f0f
+DATA onehot<>+88(SB)/8, $0x0f0f0f0f0f0f0f0f
+GLOBL onehot<>(SB), RODATA|NOPTR, $96
+
+#define ADVANCE(n) \
+	ADDQ $(n), SI
+
+#define KERNEL countlz8avx2<>
+#define LOAD(k, Y) \
+	VMOVDQU (k)*32(SI), Y \
+	VPSRLW $1, Y, Y7 \
+	VPAND onehot<>+0(SB), Y7, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLW $2, Y, Y7 \
+	VPAND onehot<>+32(SB), Y7, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLW $4, Y, Y7 \
+	VPAND onehot<>+64(SB), Y7, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLW $1, Y, Y7 \
+	VPAND onehot<>+0(SB), Y7, Y7 \
+	VPXOR Y7, Y, Y
+#define LOADQ(R) HIGHESTQ8(R)
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL counttz8avx2<>
+#define LOAD(k, Y) \
+	VMOVDQU (k)*32(SI), Y \
+	VPXOR Y7, Y7, Y7 \
+	VPSUBB Y, Y7, Y7 \
+	VPAND Y7, Y, Y
+#define LOADQ(R) LOWESTQ8(R)
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL countlz16avx2<>
+#define LOAD(k, Y) \
+	VMOVDQU (k)*32(SI), Y \
+	VPSRLW $1, Y, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLW $2, Y, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLW $4, Y, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLW $8, Y, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLW $1, Y, Y7 \
+	VPXOR Y7, Y, Y
+#define LOADQ(R) HIGHESTQ16(R)
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL counttz16avx2<>
+#define LOAD(k, Y) \
+	VMOVDQU (k)*32(SI), Y \
+	VPXOR Y7, Y7, Y7 \
+	VPSUBW Y, Y7, Y7 \
+	VPAND Y7, Y, Y
+#define LOADQ(R) LOWESTQ16(R)
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL countlz32avx2<>
+#define LOAD(k, Y) \
+	VMOVDQU (k)*32(SI), Y \
+	VPSRLD $1, Y, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLD $2, Y, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLD $4, Y, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLD $8, Y, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLD $16, Y, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLD $1, Y, Y7 \
+	VPXOR Y7, Y, Y
+#define LOADQ(R) HIGHESTQ32(R)
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL counttz32avx2<>
+#define LOAD(k, Y) \
+	VMOVDQU (k)*32(SI), Y \
+	VPXOR Y7, Y7, Y7 \
+	VPSUBD Y, Y7, Y7 \
+	VPAND Y7, Y, Y
+#define LOADQ(R) LOWESTQ32(R)
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL countlz64avx2<>
+#define LOAD(k, Y) \
+	VMOVDQU (k)*32(SI), Y \
+	VPSRLQ $1, Y, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLQ $2, Y, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLQ $4, Y, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLQ $8, Y, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLQ $16, Y, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLQ $32, Y, Y7 \
+	VPOR Y7, Y, Y \
+	VPSRLQ $1, Y, Y7 \
+	VPXOR Y7, Y, Y
+#define LOADQ(R) HIGHESTQ64(R)
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL counttz64avx2<>
+#define LOAD(k, Y) \
+	VMOVDQU (k)*32(SI), Y \
+	VPXOR Y7, Y7, Y7 \
+	VPSUBQ Y, Y7, Y7 \
+	VPAND Y7, Y, Y
+#define LOADQ(R) LOWESTQ64(R)
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#undef ADVANCE
+
+// func count8avx2onehot(counts *[8]int, buf []uint8, leading bool)
+TEXT ·count8avx2onehot(SB), 0, $0-33
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum8<>(SB), BX
+	CMPB leading+32(FP), $0
+	JNE lz
+	CALL counttz8avx2<>(SB)
+	RET
+
+lz:	CALL countlz8avx2<>(SB)
+	RET
+
+// func count16avx2onehot(counts *[16]int, buf []uint16, leading bool)
+TEXT ·count16avx2onehot(SB), 0, $0-33
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum16<>(SB), BX
+	SHLQ $1, CX			// count in bytes
+	CMPB leading+32(FP), $0
+	JNE lz
+	CALL counttz16avx2<>(SB)
+	RET
+
+lz:	CALL countlz16avx2<>(SB)
+	RET
+
+// func count32avx2onehot(counts *[32]int, buf []uint32, leading bool)
+TEXT ·count32avx2onehot(SB), 0, $0-33
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum32<>(SB), BX
+	SHLQ $2, CX			// count in bytes
+	CMPB leading+32(FP), $0
+	JNE lz
+	CALL counttz32avx2<>(SB)
+	RET
+
+lz:	CALL countlz32avx2<>(SB)
+	RET
+
+// func count64avx2onehot(counts *[64]int, buf []uint64, leading bool)
+TEXT ·count64avx2onehot(SB), 0, $0-33
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum64<>(SB), BX
+	SHLQ $3, CX			// count in bytes
+	CMPB leading+32(FP), $0
+	JNE lz
+	CALL counttz64avx2<>(SB)
+	RET
+
+lz:	CALL countlz64avx2<>(SB)
+	RET
+
+// Segmented counting.  The buffer in SI is split into segments of R8
+// bytes each, which are counted with a fused kernel using plain loads
+// into consecutive counter arrays at DI, flushing the accumulators at
+// the end of each segment.  As the kernel has no head processing, the
+// segments need not be aligned.
+
+#define KERNEL countsegavx2<>
+#define LOAD(k, Y) \
+	VMOVDQU (k)*32(SI), Y
+#define LOADQ(R) \
+	MOVQ (SI), R \
+	ADDQ $8, SI
+#define ADVANCE(n) \
+	ADDQ $(n), SI
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+// Count DX bytes at SI in segments of R8 bytes each into consecutive
+// counter arrays of R9 bytes each at DI.  DX must be a multiple of R8
+// and R8 a multiple of 8.
+TEXT segmentsavx2<>(SB), NOSPLIT, $0-0
+	SUBQ R8, DX
+	JLT end
+
+loop:	MOVQ R8, CX
+	CALL countsegavx2<>(SB)
+	ADDQ R9, DI			// advance to the next counter array
+	SUBQ R8, DX
+	JGE loop
+
+end:	RET
+
+// func count8avx2segments(out [][8]int, buf []uint8, segLen int)
+TEXT ·count8avx2segments(SB), 0, $0-56
+	MOVQ out_base+0(FP), DI
+	MOVQ buf_base+24(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+32(FP), DX		// DX = len(buf)
+	MOVQ segLen+48(FP), R8		// R8 = segLen
+	MOVQ $8*8, R9			// size of a counter array
+	MOVQ $accum8<>(SB), BX
+	CALL segmentsavx2<>(SB)
+	RET
+
+// func count16avx2segments(out [][16]int, buf []uint16, segLen int)
+TEXT ·count16avx2segments(SB), 0, $0-56
+	MOVQ out_base+0(FP), DI
+	MOVQ buf_base+24(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+32(FP), DX		// DX = len(buf)
+	MOVQ segLen+48(FP), R8		// R8 = segLen
+	MOVQ $16*8, R9			// size of a counter array
+	MOVQ $accum16<>(SB), BX
+	SHLQ $1, DX			// count in bytes
+	SHLQ $1, R8
+	CALL segmentsavx2<>(SB)
+	RET
+
+// func count32avx2segments(out [][32]int, buf []uint32, segLen int)
+TEXT ·count32avx2segments(SB), 0, $0-56
+	MOVQ out_base+0(FP), DI
+	MOVQ buf_base+24(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+32(FP), DX		// DX = len(buf)
+	MOVQ segLen+48(FP), R8		// R8 = segLen
+	MOVQ $32*8, R9			// size of a counter array
+	MOVQ $accum32<>(SB), BX
+	SHLQ $2, DX			// count in bytes
+	SHLQ $2, R8
+	CALL segmentsavx2<>(SB)
+	RET
+
+// func count64avx2segments(out [][64]int, buf []uint64, segLen int)
+TEXT ·count64avx2segments(SB), 0, $0-56
+	MOVQ out_base+0(FP), DI
+	MOVQ buf_base+24(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+32(FP), DX		// DX = len(buf)
+	MOVQ segLen+48(FP), R8		// R8 = segLen
+	MOVQ $64*8, R9			// size of a counter array
+	MOVQ $accum64<>(SB), BX
+	SHLQ $3, DX			// count in bytes
+	SHLQ $3, R8
+	CALL segmentsavx2<>(SB)
+	RET
+
+// Fused kernels computing the popcount histogram of buf alongside the
+// positional counts.  The buffer is in SI and the histogram in R9.
+// Each block is histogrammed by the helpers from counthist_amd64.h as
+// the input stream is advanced past it.
+#include "counthist_amd64.h"
+
+#define KERNEL counthist8avx2<>
+#define LOAD(k, Y) \
+	VMOVDQU (k)*32(SI), Y
+#define LOADQ(R) \
+	MOVQ (SI), R \
+	ADVANCE(8)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	MOVQ $-(n), R11 \
+	CALL hist8<>(SB)
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+#define KERNEL counthist16avx2<>
+#define LOAD(k, Y) \
+	VMOVDQU (k)*32(SI), Y
+#define LOADQ(R) \
+	MOVQ (SI), R \
+	ADVANCE(8)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	MOVQ $-(n), R11 \
+	CALL hist16<>(SB)
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+#define KERNEL counthist32avx2<>
+#define LOAD(k, Y) \
+	VMOVDQU (k)*32(SI), Y
+#define LOADQ(R) \
+	MOVQ (SI), R \
+	ADVANCE(8)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	MOVQ $-(n), R11 \
+	CALL hist32<>(SB)
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+#define KERNEL counthist64avx2<>
+#define LOAD(k, Y) \
+	VMOVDQU (k)*32(SI), Y
+#define LOADQ(R) \
+	MOVQ (SI), R \
+	ADVANCE(8)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	MOVQ $-(n), R11 \
+	CALL hist64<>(SB)
+#include "countavx2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+// func count8avx2hist(counts *[8]int, hist *[9]int, buf []uint8)
+TEXT ·count8avx2hist(SB), 0, $0-40
+	MOVQ counts+0(FP), DI
+	MOVQ hist+8(FP), R9
+	MOVQ buf_base+16(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+24(FP), CX		// CX = len(buf)
+	MOVQ $accum8<>(SB), BX
+	CALL counthist8avx2<>(SB)
+	RET
+
+// func count16avx2hist(counts *[16]int, hist *[17]int, buf []uint16)
+TEXT ·count16avx2hist(SB), 0, $0-40
+	MOVQ counts+0(FP), DI
+	MOVQ hist+8(FP), R9
+	MOVQ buf_base+16(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+24(FP), CX		// CX = len(buf)
+	MOVQ $accum16<>(SB), BX
+	SHLQ $1, CX			// count in bytes
+	CALL counthist16avx2<>(SB)
+	RET
+
+// func count32avx2hist(counts *[32]int, hist *[33]int, buf []uint32)
+TEXT ·count32avx2hist(SB), 0, $0-40
+	MOVQ counts+0(FP), DI
+	MOVQ hist+8(FP), R9
+	MOVQ buf_base+16(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+24(FP), CX		// CX = len(buf)
+	MOVQ $accum32<>(SB), BX
+	SHLQ $2, CX			// count in bytes
+	CALL counthist32avx2<>(SB)
+	RET
+
+// func count64avx2hist(counts *[64]int, hist *[65]int, buf []uint64)
+TEXT ·count64avx2hist(SB), 0, $0-40
+	MOVQ counts+0(FP), DI
+	MOVQ hist+8(FP), R9
+	MOVQ buf_base+16(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+24(FP), CX		// CX = len(buf)
+	MOVQ $accum64<>(SB), BX
+	SHLQ $3, CX			// count in bytes
+	CALL counthist64avx2<>(SB)
+	RET
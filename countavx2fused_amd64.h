@@ -0,0 +1,257 @@
+// Fused AVX2 kernel template.  A fused kernel works like countavx2<>,
+// but computes each vector from one or more input streams as it loads
+// it, e.g. by combining two buffers with a bitwise operation.  As the
+// input streams may differ in alignment, all loads are unaligned and
+// there is no head processing.  Before including this file, define
+//
+//     KERNEL      the name of the kernel
+//     LOAD(k, Y)  load the k-th 32 byte vector of the current block
+//                 into Y, trashing at most Y7 and R11
+//     LOADQ(R)    load the next 8 bytes into R and advance the input
+//                 streams, trashing at most R11 and R13
+//     ADVANCE(n)  advance the input streams by n bytes, trashing at
+//                 most R11 and R13
+//
+// This function expects a pointer to a width-specific accumulation
+// function in BX, counters in DI and the remaining length in CX.  The
+// length must be a multiple of 8 bytes.
+TEXT KERNEL(SB), NOSPLIT, $0-0
+	VPBROADCASTD magic<>+72(SB), Y15 // 0x55555555
+	VPBROADCASTD magic<>+76(SB), Y13 // 0x33333333
+	VPXOR Y0, Y0, Y0		// initialise place-value vectors
+	VPXOR Y1, Y1, Y1
+	VPXOR Y2, Y2, Y2
+	VPXOR Y3, Y3, Y3
+	VPXOR Y8, Y8, Y8		// initialise counters
+	VPXOR Y9, Y9, Y9
+	VPXOR Y10, Y10, Y10
+	VPXOR Y11, Y11, Y11
+
+	SUBQ $16*32, CX			// enough data left to process?
+	JLT endvec
+
+	MOVL $65535, AX			// space left til overflow could occur in Y8--Y11
+
+	// load 512 bytes, add them to Y0..Y3 into Y0..Y4
+vec:	LOAD(0, Y4)
+	LOAD(1, Y5)
+	LOAD(2, Y6)
+	LOAD(3, Y12)
+	LOAD(4, Y14)
+	CSA(Y0, Y4, Y5, Y7)
+	LOAD(5, Y5)
+	CSA(Y6, Y12, Y14, Y7)
+	LOAD(6, Y14)
+	CSA(Y1, Y4, Y12, Y7)
+	LOAD(7, Y12)
+	CSA(Y0, Y5, Y6, Y7)
+	LOAD(8, Y6)
+	CSA(Y6, Y12, Y14, Y7)
+	LOAD(9, Y14)
+	CSA(Y1, Y5, Y12, Y7)
+	LOAD(10, Y12)
+	CSA(Y0, Y12, Y14, Y7)
+	LOAD(11, Y14)
+	CSA(Y2, Y4, Y5, Y7)
+	LOAD(12, Y5)
+	CSA(Y0, Y6, Y14, Y7)
+	LOAD(13, Y14)
+	CSA(Y1, Y6, Y12, Y7)
+	LOAD(14, Y12)
+	CSA(Y5, Y12, Y14, Y7)
+	LOAD(15, Y14)
+	CSA(Y0, Y5, Y14, Y7)
+	ADVANCE(16*32)
+	CSA(Y1, Y5, Y12, Y7)
+	CSA(Y2, Y5, Y6, Y7)
+	CSA(Y3, Y4, Y5, Y7)
+
+	VPBROADCASTD magic<>+84(SB), Y12 // 0x00ff00ff
+	VPBROADCASTD magic<>+80(SB), Y14 // 0x0f0f0f0f
+
+	// now Y0..Y4 hold counters; preserve Y0..Y4 for the next round
+	// and add Y4 to the counters.
+
+	// split into even/odd and reduce into crumbs
+	VPAND Y4, Y15, Y5		// Y5 = 02468ace x16
+	VPANDN Y4, Y15, Y6		// Y6 = 13579bdf x16
+	VPSRLD $1, Y6, Y6
+	VPERM2I128 $0x20, Y6, Y5, Y4
+	VPERM2I128 $0x31, Y6, Y5, Y5
+	VPADDD Y5, Y4, Y4		// Y4 = 02468ace x8 13579bdf x8
+
+	// split again and reduce into nibbles
+	VPAND Y4, Y13, Y5		// Y5 = 048c x8 159d x8
+	VPANDN Y4, Y13, Y6		// Y6 = 26ae x8 37bf x8
+	VPSRLD $2, Y6, Y6
+	VPUNPCKLQDQ Y6, Y5, Y4
+	VPUNPCKHQDQ Y6, Y5, Y5
+	VPADDD Y5, Y4, Y4		// Y4 = 048c x4 26ae x4 159d x4 37bf x4
+
+	// split again into bytes and shuffle into order
+	VPAND Y4, Y14, Y5		// Y5 = 08 x4 2a x4 19 x4 3b x4
+	VPANDN Y4, Y14, Y6		// Y4 = 4c x4 6e x4 5d x4 7f x4
+	VPSLLD $4, Y5, Y5
+	VPERM2I128 $0x20, Y6, Y5, Y4	// Y4 = 08 x4 2a x4 4c x4 6e x4
+	VPERM2I128 $0x31, Y6, Y5, Y5	// Y5 = 19 x4 3b x4 5d x4 7f x4
+	VPUNPCKLWD Y5, Y4, Y6		// Y6 = 0819 x4 4c5d x4
+	VPUNPCKHWD Y5, Y4, Y7		// Y7 = 2a3b x4 6e7f x4
+	VPUNPCKLDQ Y7, Y6, Y4		// Y4 = 08192a3b[0:1] 4c5d6e7f[0:1]
+	VPUNPCKHDQ Y7, Y6, Y5		// Y5 = 08192a3b[2:3] 4c5d6e7f[2:3]
+	VPERMQ $0xd8, Y4, Y4		// Y4 = 08192a3b4c5d6e7f[0:1]
+	VPERMQ $0xd8, Y5, Y5		// Y5 = 08192a3b4c5d6e7f[2:3]
+
+	// split again into words and add to counters
+	VPAND Y4, Y12, Y6		// Y6 = 01234567[0:1]
+	VPAND Y5, Y12, Y7		// Y7 = 01234567[2:3]
+	VPADDW Y6, Y8, Y8
+	VPADDW Y7, Y10, Y10
+	VPSRLW $8, Y4, Y4		// Y4 = 89abcdef[0:1]
+	VPSRLW $8, Y5, Y5		// Y5 = 89abcdef[2:3]
+	VPADDW Y4, Y9, Y9
+	VPADDW Y5, Y11, Y11
+
+	SUBL $16*4, AX			// account for possible overflow
+	CMPL AX, $(15+15)*4		// enough space left in the counters?
+	JGE have_space
+
+	// flush accumulators into counters
+	VPXOR Y7, Y7, Y7
+	CALL *BX			// call accumulation function
+	VPXOR Y8, Y8, Y8		// clear accumulators for next round
+	VPXOR Y9, Y9, Y9
+	VPXOR Y10, Y10, Y10
+	VPXOR Y11, Y11, Y11
+
+	MOVL $65535, AX			// space left til overflow could occur
+
+have_space:
+	SUBQ $16*32, CX			// account for bytes consumed
+	JGE vec
+
+	// group nibbles in Y0, Y1, Y2, and Y3 into Y4, Y5, Y6, and Y7
+	VPBROADCASTD magic<>+80(SB), Y14 // 0x0f0f0f0f
+
+	VPAND Y1, Y15, Y5
+	VPADDD Y5, Y5, Y5
+	VPAND Y3, Y15, Y7
+	VPADDD Y7, Y7, Y7
+	VPAND Y0, Y15, Y4
+	VPAND Y2, Y15, Y6
+	VPOR Y4, Y5, Y4			// Y4 = eca86420 (low crumbs)
+	VPOR Y6, Y7, Y5			// Y5 = eca86420 (high crumbs)
+
+	VPANDN Y0, Y15, Y0
+	VPSRLD $1, Y0, Y0
+	VPANDN Y2, Y15, Y2
+	VPSRLD $1, Y2, Y2
+	VPANDN Y1, Y15, Y1
+	VPANDN Y3, Y15, Y3
+	VPOR Y0, Y1, Y6			// Y6 = fdb97531 (low crumbs)
+	VPOR Y2, Y3, Y7			// Y7 = fdb97531 (high crumbs)
+
+	VPAND Y5, Y13, Y1
+	VPSLLD $2, Y1, Y1
+	VPAND Y7, Y13, Y3
+	VPSLLD $2, Y3, Y3
+	VPAND Y4, Y13, Y0
+	VPAND Y6, Y13, Y2
+	VPOR Y0, Y1, Y0			// Y0 = c840
+	VPOR Y2, Y3, Y1			// Y1 = d951
+
+	VPANDN Y4, Y13, Y4
+	VPSRLD $2, Y4, Y4
+	VPANDN Y6, Y13, Y6
+	VPSRLD $2, Y6, Y6
+	VPANDN Y5, Y13, Y5
+	VPANDN Y7, Y13, Y7
+	VPOR Y4, Y5, Y2			// Y2 = ea62
+	VPOR Y6, Y7, Y3			// Y3 = fb73
+
+	// pre-shuffle nibbles
+	VPUNPCKLBW Y1, Y0, Y5		// Y5 = d9c85140         (3:2:1:0)
+	VPUNPCKHBW Y1, Y0, Y0		// Y0 = d9c85140         (7:6:5:4)
+	VPUNPCKLBW Y3, Y2, Y6		// Y6 = fbea7362         (3:2:1:0)
+	VPUNPCKHBW Y3, Y2, Y1		// Y1 = fbea7362         (3:2:1:0)
+	VPUNPCKLWD Y6, Y5, Y4		// Y4 = fbead9c873625140 (1:0)
+	VPUNPCKHWD Y6, Y5, Y5		// Y5 = fbead9c873625140 (3:2)
+	VPUNPCKLWD Y1, Y0, Y6		// Y6 = fbead9c873624150 (5:4)
+	VPUNPCKHWD Y1, Y0, Y7		// Y7 = fbead9c873624150 (7:6)
+
+	// pull out high and low nibbles
+	VPAND Y4, Y14, Y0
+	VPSRLD $4, Y4, Y4
+	VPAND Y4, Y14, Y4
+	VPAND Y5, Y14, Y1
+	VPSRLD $4, Y5, Y5
+	VPAND Y5, Y14, Y5
+	VPAND Y6, Y14, Y2
+	VPSRLD $4, Y6, Y6
+	VPAND Y6, Y14, Y6
+	VPAND Y7, Y14, Y3
+	VPSRLD $4, Y7, Y7
+	VPAND Y7, Y14, Y7
+
+	// reduce common values
+	VPADDB Y2, Y0, Y0		// Y0 = ba98:3210:ba98:3210 (1:0)
+	VPADDB Y3, Y1, Y1		// Y1 = ba98:3210:ba98:3210 (3:2)
+	VPADDB Y6, Y4, Y2		// Y2 = fedc:7654:fedc:7654 (1:0)
+	VPADDB Y7, Y5, Y3		// Y3 = fedc:7654:fedc:7654 (3:2)
+
+	// shuffle dwords and group them
+	VPUNPCKLDQ Y2, Y0, Y4
+	VPUNPCKHDQ Y2, Y0, Y5
+	VPUNPCKLDQ Y3, Y1, Y6
+	VPUNPCKHDQ Y3, Y1, Y7
+	VPERM2I128 $0x20, Y5, Y4, Y0
+	VPERM2I128 $0x31, Y5, Y4, Y2
+	VPERM2I128 $0x20, Y7, Y6, Y1
+	VPERM2I128 $0x31, Y7, Y6, Y3
+	VPADDB Y2, Y0, Y0		// Y0 = fedc:ba98:7654:3210 (1:0)
+	VPADDB Y3, Y1, Y1		// Y1 = fedc:ba98:7654:3210 (3:2)
+
+	// zero-extend and add to Y8--Y11
+	VPXOR Y7, Y7, Y7
+	VPUNPCKLBW Y7, Y0, Y4
+	VPUNPCKHBW Y7, Y0, Y5
+	VPUNPCKLBW Y7, Y1, Y6
+	VPUNPCKHBW Y7, Y1, Y1
+
+	VPADDW Y4, Y8, Y8
+	VPADDW Y5, Y9, Y9
+	VPADDW Y6, Y10, Y10
+	VPADDW Y1, Y11, Y11
+
+endvec:	ADDQ $16*32, CX			// any bytes left to process?
+	JEQ end
+
+	VPBROADCASTQ magic<>+64(SB), Y2	// byte mask
+	VMOVDQU magic<>+0(SB), Y3	// permutation mask
+	VMOVDQU magic<>+32(SB), Y7
+	VPXOR Y0, Y0, Y0		// lower counter register
+	VPXOR Y1, Y1, Y1		// upper counter register
+
+	// process tail, 8 bytes at a time
+tail8:	LOADQ(R10)
+	VMOVQ R10, X6
+	COUNT8(X6)
+	SUBQ $8, CX
+	JGT tail8
+
+	// add tail to counters
+	VPXOR Y7, Y7, Y7
+	VPUNPCKLBW Y7, Y0, Y4
+	VPUNPCKHBW Y7, Y0, Y5
+	VPUNPCKLBW Y7, Y1, Y6
+	VPUNPCKHBW Y7, Y1, Y7
+
+	VPADDW Y4, Y8, Y8
+	VPADDW Y5, Y9, Y9
+	VPADDW Y6, Y10, Y10
+	VPADDW Y7, Y11, Y11
+
+	// and perform a final accumulation
+end:	VPXOR Y7, Y7, Y7
+	CALL *BX
+	VZEROUPPER
+	RET
@@ -1,4 +1,5 @@
 #include "textflag.h"
+#include "go_asm.h"
 
 // An AVX512 based kernel first doing a 15-fold CSA reduction
 // and then a 16-fold CSA reduction, carrying over place-value
@@ -509,3 +510,754 @@ TEXT ·count64avx512(SB), 0, $0-32
 	SHLQ $3, CX
 	CALL countavx512<>(SB)
 	RET
+
+// zero-extend the words in Y to dwords and add the low half to
+// a*32(DI) and the high half to b*32(DI).  Trashes Z12 and Z13.
+#define ACCUMD(a, b, Y) \
+	VPMOVZXWD Y, Z12 \
+	VEXTRACTI64X4 $1, Z12, Y13 \
+	VPADDD (a)*32(DI), Y12, Y12 \
+	VPADDD (b)*32(DI), Y13, Y13 \
+	VMOVDQU Y12, (a)*32(DI) \
+	VMOVDQU Y13, (b)*32(DI)
+
+TEXT accum8u32<>(SB), NOSPLIT, $0-0
+	// unpack and zero-extend
+	VPMOVZXWD Y8, Z10
+	VEXTRACTI64X4 $1, Z8, Y11
+	VPMOVZXWD Y11, Z11
+	VPMOVZXWD Y9, Z12
+	VEXTRACTI64X4 $1, Z9, Y13
+	VPMOVZXWD Y13, Z13
+
+	// fold over thrice
+	VPADDD Z11, Z10, Z10
+	VPADDD Z13, Z12, Z12
+	VPADDD Z12, Z10, Z10
+	VEXTRACTI64X4 $1, Z10, Y11
+	VPADDD Y11, Y10, Y10
+
+	// add to counters
+	VPADDD 0*32(DI), Y10, Y10
+	VMOVDQU Y10, 0*32(DI)
+
+	RET
+
+TEXT accum16u32<>(SB), NOSPLIT, $0-0
+	// unpack and zero-extend
+	VPMOVZXWD Y8, Z10
+	VEXTRACTI64X4 $1, Z8, Y11
+	VPMOVZXWD Y11, Z11
+	VPMOVZXWD Y9, Z12
+	VEXTRACTI64X4 $1, Z9, Y13
+	VPMOVZXWD Y13, Z13
+
+	// fold over twice
+	VPADDD Z11, Z10, Z10
+	VPADDD Z13, Z12, Z12
+	VEXTRACTI64X4 $1, Z10, Y11
+	VEXTRACTI64X4 $1, Z12, Y13
+	VPADDD Y11, Y10, Y10
+	VPADDD Y13, Y12, Y12
+
+	// add to counters
+	VPADDD 0*32(DI), Y10, Y10
+	VPADDD 1*32(DI), Y12, Y12
+	VMOVDQU Y10, 0*32(DI)
+	VMOVDQU Y12, 1*32(DI)
+
+	RET
+
+TEXT accum32u32<>(SB), NOSPLIT, $0-0
+	VEXTRACTI64X4 $1, Z8, Y10
+	VEXTRACTI64X4 $1, Z9, Y11
+	ACCUMD(0, 2, Y8)
+	ACCUMD(1, 3, Y9)
+	ACCUMD(0, 2, Y10)
+	ACCUMD(1, 3, Y11)
+
+	RET
+
+TEXT accum64u32<>(SB), NOSPLIT, $0-0
+	VEXTRACTI64X4 $1, Z8, Y10
+	VEXTRACTI64X4 $1, Z9, Y11
+	ACCUMD(0, 2, Y8)
+	ACCUMD(1, 3, Y9)
+	ACCUMD(4, 6, Y10)
+	ACCUMD(5, 7, Y11)
+
+	RET
+
+// func count8avx512u32(counts *[8]uint32, buf []uint8)
+TEXT ·count8avx512u32(SB), 0, $0-32
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI
+	MOVQ buf_len+16(FP), CX
+	MOVQ $accum8u32<>(SB), BX
+	CALL countavx512<>(SB)
+	RET
+
+// func count16avx512u32(counts *[16]uint32, buf []uint16)
+TEXT ·count16avx512u32(SB), 0, $0-32
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI
+	MOVQ buf_len+16(FP), CX
+	MOVQ $accum16u32<>(SB), BX
+	SHLQ $1, CX
+	CALL countavx512<>(SB)
+	RET
+
+// func count32avx512u32(counts *[32]uint32, buf []uint32)
+TEXT ·count32avx512u32(SB), 0, $0-32
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI
+	MOVQ buf_len+16(FP), CX
+	MOVQ $accum32u32<>(SB), BX
+	SHLQ $2, CX
+	CALL countavx512<>(SB)
+	RET
+
+// func count64avx512u32(counts *[64]uint32, buf []uint64)
+TEXT ·count64avx512u32(SB), 0, $0-32
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI
+	MOVQ buf_len+16(FP), CX
+	MOVQ $accum64u32<>(SB), BX
+	SHLQ $3, CX
+	CALL countavx512<>(SB)
+	RET
+
+// Fused kernels counting a[i] op b[i] for the bitwise operations op.
+// The input buffers a and b are in SI and R8.
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	ADDQ $(n), R8
+
+#define KERNEL countandavx512<>
+#define LOAD(k, Z) \
+	VMOVDQU64 (k)*64(R8), Z \
+	VPANDQ (k)*64(SI), Z, Z
+#define LOADQ(R) \
+	MOVQ (R8), R \
+	ANDQ (SI), R \
+	ADVANCE(8)
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL countoravx512<>
+#define LOAD(k, Z) \
+	VMOVDQU64 (k)*64(R8), Z \
+	VPORQ (k)*64(SI), Z, Z
+#define LOADQ(R) \
+	MOVQ (R8), R \
+	ORQ (SI), R \
+	ADVANCE(8)
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL countxoravx512<>
+#define LOAD(k, Z) \
+	VMOVDQU64 (k)*64(R8), Z \
+	VPXORQ (k)*64(SI), Z, Z
+#define LOADQ(R) \
+	MOVQ (R8), R \
+	XORQ (SI), R \
+	ADVANCE(8)
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+// a &^ b = ~b & a
+#define KERNEL countandnotavx512<>
+#define LOAD(k, Z) \
+	VMOVDQU64 (k)*64(R8), Z \
+	VPANDNQ (k)*64(SI), Z, Z
+#define LOADQ(R) \
+	MOVQ (R8), R11 \
+	ANDNQ (SI), R11, R \
+	ADVANCE(8)
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+// Call the fused kernel for the bitwise operation in DX.
+TEXT binopavx512<>(SB), NOSPLIT, $0-0
+	CMPQ DX, $const_opOr
+	JEQ or
+	CMPQ DX, $const_opXor
+	JEQ xor
+	CMPQ DX, $const_opAndNot
+	JEQ andnot
+	JMP countandavx512<>(SB)
+or:	JMP countoravx512<>(SB)
+xor:	JMP countxoravx512<>(SB)
+andnot:	JMP countandnotavx512<>(SB)
+
+// func count8avx512binop(counts *[8]int, a, b []uint8, op binop)
+TEXT ·count8avx512binop(SB), 0, $0-64
+	MOVQ counts+0(FP), DI
+	MOVQ a_base+8(FP), SI		// SI = &a[0]
+	MOVQ a_len+16(FP), CX		// CX = len(a)
+	MOVQ b_base+32(FP), R8		// R8 = &b[0]
+	MOVQ op+56(FP), DX
+	MOVQ $accum8<>(SB), BX
+	CALL binopavx512<>(SB)
+	RET
+
+// func count16avx512binop(counts *[16]int, a, b []uint16, op binop)
+TEXT ·count16avx512binop(SB), 0, $0-64
+	MOVQ counts+0(FP), DI
+	MOVQ a_base+8(FP), SI		// SI = &a[0]
+	MOVQ a_len+16(FP), CX		// CX = len(a)
+	MOVQ b_base+32(FP), R8		// R8 = &b[0]
+	MOVQ op+56(FP), DX
+	MOVQ $accum16<>(SB), BX
+	SHLQ $1, CX			// count in bytes
+	CALL binopavx512<>(SB)
+	RET
+
+// func count32avx512binop(counts *[32]int, a, b []uint32, op binop)
+TEXT ·count32avx512binop(SB), 0, $0-64
+	MOVQ counts+0(FP), DI
+	MOVQ a_base+8(FP), SI		// SI = &a[0]
+	MOVQ a_len+16(FP), CX		// CX = len(a)
+	MOVQ b_base+32(FP), R8		// R8 = &b[0]
+	MOVQ op+56(FP), DX
+	MOVQ $accum32<>(SB), BX
+	SHLQ $2, CX			// count in bytes
+	CALL binopavx512<>(SB)
+	RET
+
+// func count64avx512binop(counts *[64]int, a, b []uint64, op binop)
+TEXT ·count64avx512binop(SB), 0, $0-64
+	MOVQ counts+0(FP), DI
+	MOVQ a_base+8(FP), SI		// SI = &a[0]
+	MOVQ a_len+16(FP), CX		// CX = len(a)
+	MOVQ b_base+32(FP), R8		// R8 = &b[0]
+	MOVQ op+56(FP), DX
+	MOVQ $accum64<>(SB), BX
+	SHLQ $3, CX			// count in bytes
+	CALL binopavx512<>(SB)
+	RET
+
+// Fused kernels counting the elements of buf whose bits are set in
+// the validity bitmap valid, zeroing the others as they are loaded.
+// The buffer is in SI, the bitmap in R9.  The vector loads take their
+// masks straight from the bitmap, the tail is handled by the macros
+// from countmasked_amd64.h.
+#include "countmasked_amd64.h"
+
+#define KERNEL countmasked8avx512<>
+#define LOAD(k, V) \
+	KMOVQ (k)*8(R9), K1 \
+	VMOVDQU8.Z (k)*64(SI), K1, V
+#define LOADQ(R) MASKEDQ8(R)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	ADDQ $(n)/8, R9
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+#define KERNEL countmasked16avx512<>
+#define LOAD(k, V) \
+	KMOVD (k)*4(R9), K1 \
+	VMOVDQU16.Z (k)*64(SI), K1, V
+#define LOADQ(R) MASKEDQ16(R)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	ADDQ $(n)/16, R9
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+#define KERNEL countmasked32avx512<>
+#define LOAD(k, V) \
+	KMOVW (k)*2(R9), K1 \
+	VMOVDQU32.Z (k)*64(SI), K1, V
+#define LOADQ(R) MASKEDQ32(R)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	ADDQ $(n)/32, R9
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+// KMOVB needs AVX-512 DQ, so go through R11
+#define KERNEL countmasked64avx512<>
+#define LOAD(k, V) \
+	MOVBLZX (k)(R9), R11 \
+	KMOVW R11, K1 \
+	VMOVDQU64.Z (k)*64(SI), K1, V
+#define LOADQ(R) MASKEDQ64(R)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	ADDQ $(n)/64, R9
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+// func count8avx512masked(counts *[8]int, buf []uint8, valid []byte)
+TEXT ·count8avx512masked(SB), 0, $0-56
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ valid_base+32(FP), R9	// R9 = &valid[0]
+	XORL R12, R12			// R12 = bit index into the tail of valid
+	MOVQ $accum8<>(SB), BX
+	CALL countmasked8avx512<>(SB)
+	RET
+
+// func count16avx512masked(counts *[16]int, buf []uint16, valid []byte)
+TEXT ·count16avx512masked(SB), 0, $0-56
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ valid_base+32(FP), R9	// R9 = &valid[0]
+	XORL R12, R12			// R12 = bit index into the tail of valid
+	MOVQ $accum16<>(SB), BX
+	SHLQ $1, CX			// count in bytes
+	CALL countmasked16avx512<>(SB)
+	RET
+
+// func count32avx512masked(counts *[32]int, buf []uint32, valid []byte)
+TEXT ·count32avx512masked(SB), 0, $0-56
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ valid_base+32(FP), R9	// R9 = &valid[0]
+	XORL R12, R12			// R12 = bit index into the tail of valid
+	MOVQ $accum32<>(SB), BX
+	SHLQ $2, CX			// count in bytes
+	CALL countmasked32avx512<>(SB)
+	RET
+
+// func count64avx512masked(counts *[64]int, buf []uint64, valid []byte)
+TEXT ·count64avx512masked(SB), 0, $0-56
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ valid_base+32(FP), R9	// R9 = &valid[0]
+	XORL R12, R12			// R12 = bit index into the tail of valid
+	MOVQ $accum64<>(SB), BX
+	SHLQ $3, CX			// count in bytes
+	CALL countmasked64avx512<>(SB)
+	RET
+
+// Fused kernels counting the highest (lz) or lowest (tz) set bit of
+// each element of buf, from which the histograms of leading and
+// trailing zeros follow.  The buffer is in SI.  The tail is handled by
+// the macros from countonehot_amd64.h.
+#include "countonehot_amd64.h"
+
+// lane masks for smearing bytes with word shifts, broadcast to all
+// lanes; the smearing steps merge the shifted bits in with VPTERNLOGD
+DATA onehot<>+0(SB)/4, $0x7f7f7f7f
+DATA onehot<>+4(SB)/4, $0x3f3f3f3f
+DATA onehot<>+8(SB)/4, $0x0f0f0f0f
+GLOBL onehot<>(SB), RODATA|NOPTR, $12
+
+#define ADVANCE(n) \
+	ADDQ $(n), SI
+
+#define KERNEL countlz8avx512<>
+#define LOAD(k, V) \
+	VMOVDQU64 (k)*64(SI), V \
+	VPSRLW $1, V, Z18 \
+	VPTERNLOGD.BCST $0xf8, onehot<>+0(SB), Z18, V \
+	VPSRLW $2, V, Z18 \
+	VPTERNLOGD.BCST $0xf8, onehot<>+4(SB), Z18, V \
+	VPSRLW $4, V, Z18 \
+	VPTERNLOGD.BCST $0xf8, onehot<>+8(SB), Z18, V \
+	VPSRLW $1, V, Z18 \
+	VPTERNLOGD.BCST $0x78, onehot<>+0(SB), Z18, V
+#define LOADQ(R) HIGHESTQ8(R)
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL counttz8avx512<>
+#define LOAD(k, V) \
+	VMOVDQU64 (k)*64(SI), V \
+	VPXORQ Z18, Z18, Z18 \
+	VPSUBB V, Z18, Z18 \
+	VPANDQ Z18, V, V
+#define LOADQ(R) LOWESTQ8(R)
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL countlz16avx512<>
+#define LOAD(k, V) \
+	VMOVDQU64 (k)*64(SI), V \
+	VPSRLW $1, V, Z18 \
+	VPORQ Z18, V, V \
+	VPSRLW $2, V, Z18 \
+	VPORQ Z18, V, V \
+	VPSRLW $4, V, Z18 \
+	VPORQ Z18, V, V \
+	VPSRLW $8, V, Z18 \
+	VPORQ Z18, V, V \
+	VPSRLW $1, V, Z18 \
+	VPXORQ Z18, V, V
+#define LOADQ(R) HIGHESTQ16(R)
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL counttz16avx512<>
+#define LOAD(k, V) \
+	VMOVDQU64 (k)*64(SI), V \
+	VPXORQ Z18, Z18, Z18 \
+	VPSUBW V, Z18, Z18 \
+	VPANDQ Z18, V, V
+#define LOADQ(R) LOWESTQ16(R)
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL countlz32avx512<>
+#define LOAD(k, V) \
+	VMOVDQU64 (k)*64(SI), V \
+	VPSRLD $1, V, Z18 \
+	VPORQ Z18, V, V \
+	VPSRLD $2, V, Z18 \
+	VPORQ Z18, V, V \
+	VPSRLD $4, V, Z18 \
+	VPORQ Z18, V, V \
+	VPSRLD $8, V, Z18 \
+	VPORQ Z18, V, V \
+	VPSRLD $16, V, Z18 \
+	VPORQ Z18, V, V \
+	VPSRLD $1, V, Z18 \
+	VPXORQ Z18, V, V
+#define LOADQ(R) HIGHESTQ32(R)
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL counttz32avx512<>
+#define LOAD(k, V) \
+	VMOVDQU64 (k)*64(SI), V \
+	VPXORQ Z18, Z18, Z18 \
+	VPSUBD V, Z18, Z18 \
+	VPANDQ Z18, V, V
+#define LOADQ(R) LOWESTQ32(R)
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL countlz64avx512<>
+#define LOAD(k, V) \
+	VMOVDQU64 (k)*64(SI), V \
+	VPSRLQ $1, V, Z18 \
+	VPORQ Z18, V, V \
+	VPSRLQ $2, V, Z18 \
+	VPORQ Z18, V, V \
+	VPSRLQ $4, V, Z18 \
+	VPORQ Z18, V, V \
+	VPSRLQ $8, V, Z18 \
+	VPORQ Z18, V, V \
+	VPSRLQ $16, V, Z18 \
+	VPORQ Z18, V, V \
+	VPSRLQ $32, V, Z18 \
+	VPORQ Z18, V, V \
+	VPSRLQ $1, V, Z18 \
+	VPXORQ Z18, V, V
+#define LOADQ(R) HIGHESTQ64(R)
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL counttz64avx512<>
+#define LOAD(k, V) \
+	VMOVDQU64 (k)*64(SI), V \
+	VPXORQ Z18, Z18, Z18 \
+	VPSUBQ V, Z18, Z18 \
+	VPANDQ Z18, V, V
+#define LOADQ(R) LOWESTQ64(R)
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#undef ADVANCE
+
+// func count8avx512onehot(counts *[8]int, buf []uint8, leading bool)
+TEXT ·count8avx512onehot(SB), 0, $0-33
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum8<>(SB), BX
+	CMPB leading+32(FP), $0
+	JNE lz
+	CALL counttz8avx512<>(SB)
+	RET
+
+lz:	CALL countlz8avx512<>(SB)
+	RET
+
+// func count16avx512onehot(counts *[16]int, buf []uint16, leading bool)
+TEXT ·count16avx512onehot(SB), 0, $0-33
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum16<>(SB), BX
+	SHLQ $1, CX			// count in bytes
+	CMPB leading+32(FP), $0
+	JNE lz
+	CALL counttz16avx512<>(SB)
+	RET
+
+lz:	CALL countlz16avx512<>(SB)
+	RET
+
+// func count32avx512onehot(counts *[32]int, buf []uint32, leading bool)
+TEXT ·count32avx512onehot(SB), 0, $0-33
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum32<>(SB), BX
+	SHLQ $2, CX			// count in bytes
+	CMPB leading+32(FP), $0
+	JNE lz
+	CALL counttz32avx512<>(SB)
+	RET
+
+lz:	CALL countlz32avx512<>(SB)
+	RET
+
+// func count64avx512onehot(counts *[64]int, buf []uint64, leading bool)
+TEXT ·count64avx512onehot(SB), 0, $0-33
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum64<>(SB), BX
+	SHLQ $3, CX			// count in bytes
+	CMPB leading+32(FP), $0
+	JNE lz
+	CALL counttz64avx512<>(SB)
+	RET
+
+lz:	CALL countlz64avx512<>(SB)
+	RET
+
+// Segmented counting.  The buffer in SI is split into segments of R8
+// bytes each, which are counted with a fused kernel using plain loads
+// into consecutive counter arrays at DI, flushing the accumulators at
+// the end of each segment.  As the kernel has no head processing, the
+// segments need not be aligned.
+
+#define KERNEL countsegavx512<>
+#define LOAD(k, Z) \
+	VMOVDQU64 (k)*64(SI), Z
+#define LOADQ(R) \
+	MOVQ (SI), R \
+	ADDQ $8, SI
+#define ADVANCE(n) \
+	ADDQ $(n), SI
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+// Count DX bytes at SI in segments of R8 bytes each into consecutive
+// counter arrays of R9 bytes each at DI.  DX must be a multiple of R8
+// and R8 a multiple of 8.
+TEXT segmentsavx512<>(SB), NOSPLIT, $0-0
+	SUBQ R8, DX
+	JLT end
+
+loop:	MOVQ R8, CX
+	CALL countsegavx512<>(SB)
+	ADDQ R9, DI			// advance to the next counter array
+	SUBQ R8, DX
+	JGE loop
+
+end:	RET
+
+// func count8avx512segments(out [][8]int, buf []uint8, segLen int)
+TEXT ·count8avx512segments(SB), 0, $0-56
+	MOVQ out_base+0(FP), DI
+	MOVQ buf_base+24(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+32(FP), DX		// DX = len(buf)
+	MOVQ segLen+48(FP), R8		// R8 = segLen
+	MOVQ $8*8, R9			// size of a counter array
+	MOVQ $accum8<>(SB), BX
+	CALL segmentsavx512<>(SB)
+	RET
+
+// func count16avx512segments(out [][16]int, buf []uint16, segLen int)
+TEXT ·count16avx512segments(SB), 0, $0-56
+	MOVQ out_base+0(FP), DI
+	MOVQ buf_base+24(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+32(FP), DX		// DX = len(buf)
+	MOVQ segLen+48(FP), R8		// R8 = segLen
+	MOVQ $16*8, R9			// size of a counter array
+	MOVQ $accum16<>(SB), BX
+	SHLQ $1, DX			// count in bytes
+	SHLQ $1, R8
+	CALL segmentsavx512<>(SB)
+	RET
+
+// func count32avx512segments(out [][32]int, buf []uint32, segLen int)
+TEXT ·count32avx512segments(SB), 0, $0-56
+	MOVQ out_base+0(FP), DI
+	MOVQ buf_base+24(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+32(FP), DX		// DX = len(buf)
+	MOVQ segLen+48(FP), R8		// R8 = segLen
+	MOVQ $32*8, R9			// size of a counter array
+	MOVQ $accum32<>(SB), BX
+	SHLQ $2, DX			// count in bytes
+	SHLQ $2, R8
+	CALL segmentsavx512<>(SB)
+	RET
+
+// func count64avx512segments(out [][64]int, buf []uint64, segLen int)
+TEXT ·count64avx512segments(SB), 0, $0-56
+	MOVQ out_base+0(FP), DI
+	MOVQ buf_base+24(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+32(FP), DX		// DX = len(buf)
+	MOVQ segLen+48(FP), R8		// R8 = segLen
+	MOVQ $64*8, R9			// size of a counter array
+	MOVQ $accum64<>(SB), BX
+	SHLQ $3, DX			// count in bytes
+	SHLQ $3, R8
+	CALL segmentsavx512<>(SB)
+	RET
+
+// Fused kernels computing the popcount histogram of buf alongside the
+// positional counts.  The buffer is in SI and the histogram in R9.
+// Each block is histogrammed by the helpers from counthist_amd64.h as
+// the input stream is advanced past it.
+#include "counthist_amd64.h"
+
+#define KERNEL counthist8avx512<>
+#define LOAD(k, Z) \
+	VMOVDQU64 (k)*64(SI), Z
+#define LOADQ(R) \
+	MOVQ (SI), R \
+	ADVANCE(8)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	MOVQ $-(n), R11 \
+	CALL hist8<>(SB)
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+#define KERNEL counthist16avx512<>
+#define LOAD(k, Z) \
+	VMOVDQU64 (k)*64(SI), Z
+#define LOADQ(R) \
+	MOVQ (SI), R \
+	ADVANCE(8)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	MOVQ $-(n), R11 \
+	CALL hist16<>(SB)
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+#define KERNEL counthist32avx512<>
+#define LOAD(k, Z) \
+	VMOVDQU64 (k)*64(SI), Z
+#define LOADQ(R) \
+	MOVQ (SI), R \
+	ADVANCE(8)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	MOVQ $-(n), R11 \
+	CALL hist32<>(SB)
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+#define KERNEL counthist64avx512<>
+#define LOAD(k, Z) \
+	VMOVDQU64 (k)*64(SI), Z
+#define LOADQ(R) \
+	MOVQ (SI), R \
+	ADVANCE(8)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	MOVQ $-(n), R11 \
+	CALL hist64<>(SB)
+#include "countavx512fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+// func count8avx512hist(counts *[8]int, hist *[9]int, buf []uint8)
+TEXT ·count8avx512hist(SB), 0, $0-40
+	MOVQ counts+0(FP), DI
+	MOVQ hist+8(FP), R9
+	MOVQ buf_base+16(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+24(FP), CX		// CX = len(buf)
+	MOVQ $accum8<>(SB), BX
+	CALL counthist8avx512<>(SB)
+	RET
+
+// func count16avx512hist(counts *[16]int, hist *[17]int, buf []uint16)
+TEXT ·count16avx512hist(SB), 0, $0-40
+	MOVQ counts+0(FP), DI
+	MOVQ hist+8(FP), R9
+	MOVQ buf_base+16(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+24(FP), CX		// CX = len(buf)
+	MOVQ $accum16<>(SB), BX
+	SHLQ $1, CX			// count in bytes
+	CALL counthist16avx512<>(SB)
+	RET
+
+// func count32avx512hist(counts *[32]int, hist *[33]int, buf []uint32)
+TEXT ·count32avx512hist(SB), 0, $0-40
+	MOVQ counts+0(FP), DI
+	MOVQ hist+8(FP), R9
+	MOVQ buf_base+16(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+24(FP), CX		// CX = len(buf)
+	MOVQ $accum32<>(SB), BX
+	SHLQ $2, CX			// count in bytes
+	CALL counthist32avx512<>(SB)
+	RET
+
+// func count64avx512hist(counts *[64]int, hist *[65]int, buf []uint64)
+TEXT ·count64avx512hist(SB), 0, $0-40
+	MOVQ counts+0(FP), DI
+	MOVQ hist+8(FP), R9
+	MOVQ buf_base+16(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+24(FP), CX		// CX = len(buf)
+	MOVQ $accum64<>(SB), BX
+	SHLQ $3, CX			// count in bytes
+	CALL counthist64avx512<>(SB)
+	RET
@@ -0,0 +1,227 @@
+// Fused AVX-512 kernel template.  A fused kernel works like
+// countavx512<>, but computes each vector from one or more input
+// streams as it loads it, e.g. by combining two buffers with a bitwise
+// operation.  As the input streams may differ in alignment, all loads
+// are unaligned and there is no head processing.  Before including
+// this file, define
+//
+//     KERNEL      the name of the kernel
+//     LOAD(k, Z)  load the k-th 64 byte vector of the current block
+//                 into Z, trashing at most Z18--Z21, K1, and R11
+//     LOADQ(R)    load the next 8 bytes into R and advance the input
+//                 streams, trashing at most R11 and R13
+//     ADVANCE(n)  advance the input streams by n bytes, trashing at
+//                 most R11 and R13
+//
+// This function expects a pointer to a width-specific accumulation
+// function in BX, counters in DI and the remaining length in CX.  The
+// length must be a multiple of 8 bytes.
+TEXT KERNEL(SB), NOSPLIT, $0-0
+	VPTERNLOGD $0xff, Z30, Z30, Z30	// ffffffff
+	VPXORD Y25, Y25, Y25		// zero register
+	VPXOR Y0, Y0, Y0		// initialise place-value vectors
+	VPXOR Y1, Y1, Y1
+	VPXOR Y2, Y2, Y2
+	VPXOR Y3, Y3, Y3
+	VPXOR Y8, Y8, Y8		// initialise counters
+	VPXOR Y9, Y9, Y9
+
+	SUBQ $16*64, CX			// enough data left to process?
+	JLT endvec
+
+	VPBROADCASTD magic<>+0(SB), Z28 // 0x55555555 for transposition
+	VPBROADCASTD magic<>+4(SB), Z27 // 0x33333333 for transposition
+	VPBROADCASTD magic<>+8(SB), Z26 // 0x0f0f0f0f for transposition
+	VPBROADCASTD magic<>+12(SB), Z24 // 0x00ff00ff
+	VPMOVZXBW magic<>+16(SB), Z23	// transposition vector
+	MOVL $65535, AX			// space left til overflow could occur in Z8, Z9
+
+	// load 1024 bytes, add them to Z0..Z3 into Z0..Z4
+vec:	LOAD(0, Z4)
+	LOAD(1, Z5)
+	LOAD(2, Z6)
+	LOAD(3, Z7)
+	LOAD(4, Z10)
+	CSA(Z0, Z4, Z5, Z22)
+	LOAD(5, Z5)
+	LOAD(6, Z11)
+	LOAD(7, Z12)
+	CSA(Z6, Z7, Z10, Z22)
+	LOAD(8, Z10)
+	LOAD(9, Z13)
+	LOAD(10, Z14)
+	CSA(Z5, Z11, Z12, Z22)
+	LOAD(11, Z12)
+	LOAD(12, Z15)
+	LOAD(13, Z16)
+	CSA(Z10, Z13, Z14, Z22)
+	LOAD(14, Z14)
+	LOAD(15, Z17)
+	CSA(Z12, Z15, Z16, Z22)
+	ADVANCE(16*64)
+	CSA(Z0, Z5, Z6, Z22)
+	CSA(Z1, Z4, Z7, Z22)
+	CSA(Z10, Z12, Z14, Z22)
+	CSA(Z11, Z13, Z15, Z22)
+	CSA(Z0, Z10, Z17, Z22)
+	CSA(Z1, Z5, Z11, Z22)
+	CSA(Z2, Z4, Z13, Z22)
+	CSA(Z1, Z10, Z12, Z22)
+	CSA(Z2, Z5, Z10, Z22)
+	CSA(Z3, Z4, Z5, Z22)
+
+	// now Z0..Z4 hold counters; preserve Z0..Z3 for next round and
+	// add Z4 to counters.
+
+	// split into even/odd and reduce into crumbs
+	VPANDD Z4, Z28, Z5		// Z5 = bits 02468ace x32
+	VPANDND Z4, Z28, Z6		// Z6 = bits 13579bdf x32
+	VPSRLD $1, Z6, Z6
+	VSHUFI64X2 $0x44, Z6, Z5, Z10
+	VSHUFI64X2 $0xee, Z6, Z5, Z11
+	VPADDD Z10, Z11, Z4		// Z4 = 02468ace x16 ... 13579bdf x16
+
+	// split again and reduce into nibbles
+	VPANDD Z4, Z27, Z5		// Z5 = 048c x16 ... 159d x16
+	VPANDND Z4, Z27, Z6		// Z6 = 26ae x16 ... 37bf x16
+	VPSRLD $2, Z6, Z6
+	VSHUFI64X2 $0x88, Z6, Z5, Z10
+	VSHUFI64X2 $0xdd, Z6, Z5, Z11
+	VPADDD Z10, Z11, Z4		// Z4 = 048c x8  159d x8  26ae x8  37bf x8
+
+	// split again and reduce into bytes (shifted left by 4)
+	VPANDD Z4, Z26, Z5		// Z5 = 08 x8  19 x8  2a x8  3b x8
+	VPANDND Z4, Z26, Z6		// Z6 = 4c x8  5d x8  6e x8  7f x8
+	VPSLLD $4, Z5, Z5
+	VPERMQ $0xd8, Z5, Z5		// Z5 = 08x4 19x4 08x4 19x4  2ax4 3bx4 2ax4 3bx4
+	VPERMQ $0xd8, Z6, Z6		// Z6 = 4cx4 5dx4 4cx4 5dx4  6ex4 7fx4 6ex4 7fx4
+	VSHUFI64X2 $0x88, Z6, Z5, Z10
+	VSHUFI64X2 $0xdd, Z6, Z5, Z11
+	VPADDD Z10, Z11, Z4		// Z4 = 08x4 19x4 2ax4 3bx4 4cx4 5dx4 6ex4 7fx4
+
+	// split again into 16 bit counters
+	VPSRLW $8, Z4, Z6		// Z6 = 8888 9999 aaaa bbbb cccc dddd eeee ffff
+	VPANDD Z4, Z24, Z5		// Z5 = 0000 1111 2222 3333 4444 5555 6666 7777
+
+	// accumulate in permuted order
+	VPADDW Z5, Z8, Z8
+	VPADDW Z6, Z9, Z9
+
+	SUBL $16*8, AX			// account for possible overflow
+	CMPL AX, $(15+15)*8		// enough space left in the counters?
+	JGE have_space
+
+	// fix permutation and flush into counters
+	VPERMW Z8, Z23, Z8		// Z5 = 0123 4567 0123 4567 0123 4567 0123 4567
+	VPERMW Z9, Z23, Z9		// Z6 = 89ab cdef 89ab cdef 89ab cdef 89ab cdef
+	CALL *BX			// call accumulation function
+	VPXOR Y8, Y8, Y8		// clear accumulators for next round
+	VPXOR Y9, Y9, Y9
+	MOVL $65535, AX			// space left til overflow could occur
+
+have_space:
+	SUBQ $16*64, CX			// account for bytes consumed
+	JGE vec
+
+	// fix permutation for final step
+	VPERMW Z8, Z23, Z8		// Z5 = 0123 4567 0123 4567 0123 4567 0123 4567
+	VPERMW Z9, Z23, Z9		// Z6 = 89ab cdef 89ab cdef 89ab cdef 89ab cdef
+
+	// sum up Z0..Z3 into the counter registers
+	VPSRLD $1, Z0, Z4		// group nibbles in Z0--Z3 into Z4--Z7
+	VPADDD Z1, Z1, Z5
+	VPSRLD $1, Z2, Z6
+	VPADDD Z3, Z3, Z7
+	VPTERNLOGD $0xe4, Z28, Z5, Z0	// Z0 = eca86420 (low crumbs)
+	VPTERNLOGD $0xd8, Z28, Z4, Z1	// Z1 = fdb97531 (high crumbs)
+	VPTERNLOGD $0xe4, Z28, Z7, Z2	// Z2 = eca86420 (low crumbs)
+	VPTERNLOGD $0xd8, Z28, Z6, Z3	// Z3 = fdb97531 (high crumbs)
+
+	VPSRLD $2, Z0, Z4
+	VPSRLD $2, Z1, Z6
+	VPSLLD $2, Z2, Z5
+	VPSLLD $2, Z3, Z7
+	VPTERNLOGD $0xd8, Z27, Z4, Z2	// Z2 = ea63
+	VPTERNLOGD $0xd8, Z27, Z6, Z3	// Z3 = fb73
+	VPTERNLOGD $0xe4, Z27, Z5, Z0	// Z0 = c840
+	VPTERNLOGD $0xe4, Z27, Z7, Z1	// Z1 = d951
+
+	// pre-shuffle nibbles (within 128 bit lanes)!
+	VPUNPCKLBW Z3, Z2, Z6		// Z6 = fbea7362 (3:2:1:0)
+	VPUNPCKHBW Z3, Z2, Z3		// Z3 = fbea7362 (7:6:5:4)
+	VPUNPCKLBW Z1, Z0, Z5		// Z5 = d9c85140 (3:2:1:0)
+	VPUNPCKHBW Z1, Z0, Z2		// Z2 = d9c85140 (7:6:5:4)
+	VPUNPCKLWD Z6, Z5, Z4		// Z4 = fbead9c873625140 (1:0)
+	VPUNPCKHWD Z6, Z5, Z5		// Z5 = fbead9c873625140 (3:2)
+	VPUNPCKLWD Z3, Z2, Z6		// Z6 = fbead9c873625140 (5:4)
+	VPUNPCKHWD Z3, Z2, Z7		// Z7 = fbead9c873625140 (7:6)
+
+	// pull out high and low nibbles
+	VPANDD Z26, Z4, Z0
+	VPSRLD $4, Z4, Z4
+	VPANDD Z26, Z4, Z4
+
+	VPANDD Z26, Z5, Z1
+	VPSRLD $4, Z5, Z5
+	VPANDD Z26, Z5, Z5
+
+	VPANDD Z26, Z6, Z2
+	VPSRLD $4, Z6, Z6
+	VPANDD Z26, Z6, Z6
+
+	VPANDD Z26, Z7, Z3
+	VPSRLD $4, Z7, Z7
+	VPANDD Z26, Z7, Z7
+
+	// reduce once
+	VPADDB Z2, Z0, Z0		// Z0 = ba983210 (1:0)
+	VPADDB Z3, Z1, Z1		// Z1 = ba983210 (3:2)
+	VPADDB Z6, Z4, Z2		// Z2 = fedc7654 (1:0)
+	VPADDB Z7, Z5, Z3		// Z3 = fedc7654 (3:2)
+
+	// shuffle again to form ordered groups of 16 counters in each lane
+	VPUNPCKLDQ Z2, Z0, Z4		// Z4 = fedcba9876543210 (0)
+	VPUNPCKHDQ Z2, Z0, Z5		// Z5 = fedcba9876543210 (1)
+	VPUNPCKLDQ Z3, Z1, Z6		// Z6 = fedcba9876543210 (2)
+	VPUNPCKHDQ Z3, Z1, Z7		// Z7 = fedcba9876543210 (3)
+
+	// reduce lanes once (4x1 lane -> 2x2 lanes)
+	VSHUFI64X2 $0x44, Z5, Z4, Z0	// Z0 = fedcba9876543210 (1:1:0:0)
+	VSHUFI64X2 $0xee, Z5, Z4, Z1	// Z1 = fedcba9876543210 (1:1:0:0)
+	VSHUFI64X2 $0x44, Z7, Z6, Z2	// Z2 = fedcba9876543210 (3:3:2:2)
+	VSHUFI64X2 $0xee, Z7, Z6, Z3	// Z2 = fedcba9876543210 (3:3:2:2)
+	VPADDB Z1, Z0, Z0
+	VPADDB Z3, Z2, Z2
+
+	// reduce lanes again (2x2 lanes -> 1x4 lane)
+	VSHUFI64X2 $0x88, Z2, Z0, Z1	// Z1 = fedcba9876543210 (3:2:1:0)
+	VSHUFI64X2 $0xdd, Z2, Z0, Z0	// Z0 = fedcba9876543210 (3:2:1:0)
+	VPADDB Z1, Z0, Z0
+
+	// Zero extend and add to Z8, Z9
+	VPUNPCKLBW Z25, Z0, Z1		// Z1 = 76543210 (3:2:1:0)
+	VPUNPCKHBW Z25, Z0, Z2		// Z2 = fedcba98 (3:2:1:0)
+	VPADDW Z1, Z8, Z8
+	VPADDW Z2, Z9, Z9
+
+endvec:	VPXOR Y0, Y0, Y0		// counter register
+	ADDQ $16*64, CX			// any bytes left to process?
+	JEQ end
+
+	// process tail, 8 bytes at a time
+tail8:	LOADQ(R10)
+	KMOVQ R10, K1
+	VPSUBB Z30, Z0, K1, Z0
+	SUBQ $8, CX
+	JGT tail8
+
+	// add tail to counters
+	VPUNPCKLBW Z25, Z0, Z1
+	VPUNPCKHBW Z25, Z0, Z2
+	VPADDW Z1, Z8, Z8
+	VPADDW Z2, Z9, Z9
+
+	// and perform a final accumulation
+end:	CALL *BX
+	VZEROUPPER
+	RET
@@ -0,0 +1,154 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import "unsafe"
+
+// Counter is the set of types usable as counters with the Count8Into,
+// Count16Into, Count32Into, Count64Into, and CountStringInto functions.
+type Counter interface {
+	~int | ~int32 | ~int64 | ~uint | ~uint32 | ~uint64
+}
+
+// each platform must provide arrays count8altfuncs, count16altfuncs,
+// count32altfuncs, and count64altfuncs of type count8altimpl, ...
+// listing kernels analogous to count8funcs and friends that accumulate
+// into counters of type altCounter instead of int.  altCounter is the
+// one of uint32 and uint64 that does not have the same width as int.
+
+type count8altimpl struct {
+	count8    func(*[8]altCounter, []uint8)
+	name      string
+	available bool
+}
+
+type count16altimpl struct {
+	count16   func(*[16]altCounter, []uint16)
+	name      string
+	available bool
+}
+
+type count32altimpl struct {
+	count32   func(*[32]altCounter, []uint32)
+	name      string
+	available bool
+}
+
+type count64altimpl struct {
+	count64   func(*[64]altCounter, []uint64)
+	name      string
+	available bool
+}
+
+// optimal count8alt implementation selected at runtime
+var count8altfunc = func() func(*[8]altCounter, []uint8) {
+	for _, f := range count8altfuncs {
+		if f.available {
+			return f.count8
+		}
+	}
+
+	panic("no implementation of count8alt available")
+}()
+
+// optimal count16alt implementation selected at runtime
+var count16altfunc = func() func(*[16]altCounter, []uint16) {
+	for _, f := range count16altfuncs {
+		if f.available {
+			return f.count16
+		}
+	}
+
+	panic("no implementation of count16alt available")
+}()
+
+// optimal count32alt implementation selected at runtime
+var count32altfunc = func() func(*[32]altCounter, []uint32) {
+	for _, f := range count32altfuncs {
+		if f.available {
+			return f.count32
+		}
+	}
+
+	panic("no implementation of count32alt available")
+}()
+
+// optimal count64alt implementation selected at runtime
+var count64altfunc = func() func(*[64]altCounter, []uint64) {
+	for _, f := range count64altfuncs {
+		if f.available {
+			return f.count64
+		}
+	}
+
+	panic("no implementation of count64alt available")
+}()
+
+// Count buf into counts.  Counters as wide as int are counted into by
+// the regular kernels, all others by the kernels for altCounter.  As
+// the counters wrap around, their signedness does not matter.
+func countInto[C Counter, T Element](counts []C, buf []T) {
+	var zero C
+
+	data := unsafe.Pointer(unsafe.SliceData(counts))
+	if unsafe.Sizeof(zero) == unsafe.Sizeof(int(0)) {
+		Count(unsafe.Slice((*int)(data), len(counts)), buf)
+	} else {
+		countAlt(unsafe.Slice((*altCounter)(data), len(counts)), buf)
+	}
+}
+
+// Like Count, but for altCounter counters.
+func countAlt[T Element](counts []altCounter, buf []T) {
+	var zero T
+
+	data := unsafe.Pointer(unsafe.SliceData(buf))
+	switch unsafe.Sizeof(zero) {
+	case 1:
+		count8altfunc((*[8]altCounter)(counts), unsafe.Slice((*uint8)(data), len(buf)))
+	case 2:
+		count16altfunc((*[16]altCounter)(counts), unsafe.Slice((*uint16)(data), len(buf)))
+	case 4:
+		count32altfunc((*[32]altCounter)(counts), unsafe.Slice((*uint32)(data), len(buf)))
+	case 8:
+		count64altfunc((*[64]altCounter)(counts), unsafe.Slice((*uint64)(data), len(buf)))
+	default:
+		panic("pospop: unsupported element size")
+	}
+}
+
+// Like CountString, but add the results to counters of type C.  Unlike
+// int, the counter types uint64 and int64 do not overflow on 32 bit
+// platforms.  The counters wrap around on overflow.
+func CountStringInto[C Counter](counts *[8]C, str string) {
+	buf := unsafe.Slice(unsafe.StringData(str), len(str))
+	countInto(counts[:], buf)
+}
+
+// Like Count8, but add the results to counters of type C.  Unlike
+// int, the counter types uint64 and int64 do not overflow on 32 bit
+// platforms.  The counters wrap around on overflow.
+func Count8Into[C Counter](counts *[8]C, buf []uint8) {
+	countInto(counts[:], buf)
+}
+
+// Like Count16, but add the results to counters of type C.  Unlike
+// int, the counter types uint64 and int64 do not overflow on 32 bit
+// platforms.  The counters wrap around on overflow.
+func Count16Into[C Counter](counts *[16]C, buf []uint16) {
+	countInto(counts[:], buf)
+}
+
+// Like Count32, but add the results to counters of type C.  Unlike
+// int, the counter types uint64 and int64 do not overflow on 32 bit
+// platforms.  The counters wrap around on overflow.
+func Count32Into[C Counter](counts *[32]C, buf []uint32) {
+	countInto(counts[:], buf)
+}
+
+// Like Count64, but add the results to counters of type C.  Unlike
+// int, the counter types uint64 and int64 do not overflow on 32 bit
+// platforms.  The counters wrap around on overflow.
+func Count64Into[C Counter](counts *[64]C, buf []uint64) {
+	countInto(counts[:], buf)
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"unsafe"
+)
+
+// test the correctness of Count64Into for counter type C
+func testCount64Into[C Counter](t *testing.T) {
+	for _, len := range testLengths {
+		buf := make([]uint64, len)
+		for i := range buf {
+			buf[i] = rand.Uint64()
+		}
+
+		var counts, refCounts [64]C
+		var local [64]int
+		for i := range counts {
+			counts[i] = C(rand.Uint32())
+		}
+
+		refCounts = counts
+		Count64Into(&counts, buf)
+		count64safe(&local, buf)
+		for i := range refCounts {
+			refCounts[i] += C(local[i])
+		}
+
+		for i := range counts {
+			if counts[i] != refCounts[i] {
+				t.Errorf("length %d: counts[%d] = %d, expected %d", len, i, counts[i], refCounts[i])
+			}
+		}
+	}
+}
+
+// test the correctness of Count64Into
+func TestCount64Into(t *testing.T) {
+	t.Run("uint32", testCount64Into[uint32])
+	t.Run("int64", testCount64Into[int64])
+	t.Run("uint64", testCount64Into[uint64])
+}
+
+// test that 64 bit counters keep counting past 2^31 and 2^32
+func TestCount64IntoLarge(t *testing.T) {
+	buf := make([]uint64, 1000)
+	for i := range buf {
+		buf[i] = ^uint64(0)
+	}
+
+	for _, start := range []uint64{1<<31 - 500, 1<<32 - 500} {
+		var counts [64]uint64
+		var scounts [64]int64
+		for i := range counts {
+			counts[i] = start
+			scounts[i] = int64(start)
+		}
+
+		Count64Into(&counts, buf)
+		Count64Into(&scounts, buf)
+		for i := range counts {
+			if counts[i] != start+1000 {
+				t.Errorf("uint64 from %d: counts[%d] = %d, expected %d", start, i, counts[i], start+1000)
+			}
+
+			if scounts[i] != int64(start)+1000 {
+				t.Errorf("int64 from %d: counts[%d] = %d, expected %d", start, i, scounts[i], int64(start)+1000)
+			}
+		}
+	}
+}
+
+// test the correctness of the other CountInto functions
+func TestCountInto(t *testing.T) {
+	buf := make([]uint64, 1025)
+	for i := range buf {
+		buf[i] = rand.Uint64()
+	}
+
+	var counts8 [8]uint64
+	var counts16 [16]int64
+	var counts32 [32]uint32
+	var ref8 [8]int
+	var ref16 [16]int
+	var ref32 [32]int
+
+	b8 := make([]uint8, len(buf))
+	b16 := make([]uint16, len(buf))
+	b32 := make([]uint32, len(buf))
+	for i, x := range buf {
+		b8[i], b16[i], b32[i] = uint8(x), uint16(x), uint32(x)
+	}
+
+	Count8Into(&counts8, b8)
+	CountStringInto(&counts8, string(b8))
+	Count16Into(&counts16, b16)
+	Count32Into(&counts32, b32)
+
+	count8safe(&ref8, b8)
+	count8safe(&ref8, b8)
+	count16safe(&ref16, b16)
+	count32safe(&ref32, b32)
+
+	for i := range ref8 {
+		if counts8[i] != uint64(ref8[i]) {
+			t.Errorf("Count8Into: counts[%d] = %d, expected %d", i, counts8[i], ref8[i])
+		}
+	}
+
+	for i := range ref16 {
+		if counts16[i] != int64(ref16[i]) {
+			t.Errorf("Count16Into: counts[%d] = %d, expected %d", i, counts16[i], ref16[i])
+		}
+	}
+
+	for i := range ref32 {
+		if counts32[i] != uint32(ref32[i]) {
+			t.Errorf("Count32Into: counts[%d] = %d, expected %d", i, counts32[i], ref32[i])
+		}
+	}
+}
+
+// test the correctness of an altCounter kernel for elements of type T,
+// starting with counters close to 2^32 to test carries into or wrap
+// around beyond bit 31
+func testCountAlt[T word](t *testing.T, count func(counts []altCounter, buf []T)) {
+	var zero T
+	nbits := 8 * int(unsafe.Sizeof(zero))
+
+	for _, len := range testLengths {
+		buf := make([]T, len)
+		for i := range buf {
+			buf[i] = T(rand.Uint64())
+		}
+
+		counts := make([]altCounter, nbits)
+		for i := range counts {
+			counts[i] = math.MaxUint32 - altCounter(rand.Intn(len+1))
+		}
+
+		refCounts := append([]altCounter(nil), counts...)
+		count(counts, buf)
+		for _, x := range buf {
+			for j := range refCounts {
+				refCounts[j] += altCounter(uint64(x) >> j & 1)
+			}
+		}
+
+		for i := range counts {
+			if counts[i] != refCounts[i] {
+				t.Errorf("length %d: counts[%d] = %d, expected %d", len, i, counts[i], refCounts[i])
+			}
+		}
+	}
+}
+
+// test the correctness of all implementations counting into altCounter
+func TestCountAlt(t *testing.T) {
+	for i := range count8altfuncs {
+		t.Run("8/"+count8altfuncs[i].name, func(tt *testing.T) {
+			if !count8altfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountAlt(tt, func(counts []altCounter, buf []uint8) {
+				count8altfuncs[i].count8((*[8]altCounter)(counts), buf)
+			})
+		})
+	}
+
+	for i := range count16altfuncs {
+		t.Run("16/"+count16altfuncs[i].name, func(tt *testing.T) {
+			if !count16altfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountAlt(tt, func(counts []altCounter, buf []uint16) {
+				count16altfuncs[i].count16((*[16]altCounter)(counts), buf)
+			})
+		})
+	}
+
+	for i := range count32altfuncs {
+		t.Run("32/"+count32altfuncs[i].name, func(tt *testing.T) {
+			if !count32altfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountAlt(tt, func(counts []altCounter, buf []uint32) {
+				count32altfuncs[i].count32((*[32]altCounter)(counts), buf)
+			})
+		})
+	}
+
+	for i := range count64altfuncs {
+		t.Run("64/"+count64altfuncs[i].name, func(tt *testing.T) {
+			if !count64altfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountAlt(tt, func(counts []altCounter, buf []uint64) {
+				count64altfuncs[i].count64((*[64]altCounter)(counts), buf)
+			})
+		})
+	}
+}
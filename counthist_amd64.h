@@ -0,0 +1,38 @@
+// Popcount histogram helpers for the histogramming fused kernels.
+// hist8<>, hist16<>, hist32<>, and hist64<> add the popcounts of the
+// 8, 16, 32, or 64 bit elements of the -R11 bytes preceding SI to the
+// histogram in R9, i.e. increment 8*k(R9) for every element with k
+// bits set.  They are called after the input stream has been advanced
+// past the bytes just loaded, so each element is histogrammed while it
+// is still in the cache.  The helpers trash R11 and R13 and require
+// POPCNT.
+
+TEXT hist8<>(SB), NOSPLIT, $0-0
+loop:	MOVBLZX (SI)(R11*1), R13
+	POPCNTL R13, R13
+	INCQ (R9)(R13*8)
+	INCQ R11
+	JNZ loop
+	RET
+
+TEXT hist16<>(SB), NOSPLIT, $0-0
+loop:	MOVWLZX (SI)(R11*1), R13
+	POPCNTL R13, R13
+	INCQ (R9)(R13*8)
+	ADDQ $2, R11
+	JNZ loop
+	RET
+
+TEXT hist32<>(SB), NOSPLIT, $0-0
+loop:	POPCNTL (SI)(R11*1), R13
+	INCQ (R9)(R13*8)
+	ADDQ $4, R11
+	JNZ loop
+	RET
+
+TEXT hist64<>(SB), NOSPLIT, $0-0
+loop:	POPCNTQ (SI)(R11*1), R13
+	INCQ (R9)(R13*8)
+	ADDQ $8, R11
+	JNZ loop
+	RET
@@ -0,0 +1,68 @@
+// Tail loads for the masked fused kernels.  The masked kernels count
+// the elements of the buffer in SI whose bits are set in the validity
+// bitmap in R9, zeroing the other elements as they are loaded.  When
+// the tail is reached, R9 points to the bitmap byte of the first
+// element of the tail and R12 holds the index of the next bit of the
+// tail, starting at 0.  MASKEDQ8(R), MASKEDQ16(R), MASKEDQ32(R), and
+// MASKEDQ64(R) load the next 8 bytes of 8, 16, 32, or 64 bit elements
+// into R, zero the elements whose bits are clear, and advance SI and
+// R12, trashing R11 and R13, using general purpose instructions only.
+
+// R11 = bits R12 to R12+n-1 of the bitmap, followed by garbage;
+// advance R12 by n.  SHRL needs its count in CL, so CX is stashed in
+// R13 in the meantime.
+#define MASKBITS(n) \
+	MOVQ R12, R11 \
+	SHRQ $3, R11 \
+	MOVBLZX (R9)(R11*1), R11 \
+	MOVQ CX, R13 \
+	MOVL R12, CX \
+	ANDL $7, CX \
+	SHRL CX, R11 \
+	MOVQ R13, CX \
+	ADDQ $(n), R12
+
+// Spread the low bits of R11 to the lanes of width l of R11, setting
+// each lane to all ones if its bit is set and to zero otherwise.  rep
+// replicates R11 into each lane, sel picks the lane's bit, bias carries
+// it into the top bit of the lane, and top isolates the top bits.  The
+// top bits are then turned into lane masks with (R11<<1) - (R11>>l-1).
+#define SPREAD(rep, sel, bias, top, l) \
+	MOVQ $(rep), R13 \
+	IMULQ R13, R11 \
+	MOVQ $(sel), R13 \
+	ANDQ R13, R11 \
+	MOVQ $(bias), R13 \
+	ADDQ R13, R11 \
+	MOVQ $(top), R13 \
+	ANDQ R13, R11 \
+	MOVQ R11, R13 \
+	SHRQ $(l)-1, R13 \
+	ADDQ R11, R11 \
+	SUBQ R13, R11
+
+#define MASKED(R) \
+	MOVQ (SI), R \
+	ANDQ R11, R \
+	ADDQ $8, SI
+
+#define MASKEDQ8(R) \
+	MASKBITS(8) \
+	SPREAD(0x0101010101010101, 0x8040201008040201, 0x7f7f7f7f7f7f7f7f, 0x8080808080808080, 8) \
+	MASKED(R)
+
+#define MASKEDQ16(R) \
+	MASKBITS(4) \
+	SPREAD(0x0001000100010001, 0x0008000400020001, 0x7fff7fff7fff7fff, 0x8000800080008000, 16) \
+	MASKED(R)
+
+#define MASKEDQ32(R) \
+	MASKBITS(2) \
+	SPREAD(0x0000000100000001, 0x0000000200000001, 0x7fffffff7fffffff, 0x8000000080000000, 32) \
+	MASKED(R)
+
+#define MASKEDQ64(R) \
+	MASKBITS(1) \
+	ANDL $1, R11 \
+	NEGQ R11 \
+	MASKED(R)
@@ -1,4 +1,5 @@
 #include "textflag.h"
+#include "go_asm.h"
 
 // A NEON based kernel first doing a 15-fold CSA reduction and then a
 // 16-fold CSA reduction, carrying over place-value vectors between
@@ -553,3 +554,1137 @@ TEXT ·count64neon(SB), 0, $0-32
 	LSL $3, R3, R3			// count in bytes
 	CALL countneon<>(SB)
 	RET
+
+TEXT accum8u32<>(SB), NOSPLIT, $0-0
+	// load counts registers
+	VLD1 (R2), [V4.S4, V5.S4]
+
+	// zero extend into dwords and fold
+//	VUADDL V8.H4, V10.H4, V16.S4
+//	VUADDL2 V8.H8, V10.H8, V17.S4
+//	VUADDL V9.H4, V11.H4, V18.S4
+//	VUADDL2 V9.H8, V11.H8, V19.S4
+//	VUADDL V12.H4, V14.H4, V20.S4
+//	VUADDL2 V12.H8, V14.H8, V21.S4
+//	VUADDL V13.H4, V15.H4, V22.S4
+//	VUADDL2 V13.H8, V15.H8, V23.S4
+	WORD $0x2e680150
+	WORD $0x6e680151
+	WORD $0x2e690172
+	WORD $0x6e690173
+	WORD $0x2e6c01d4
+	WORD $0x6e6c01d5
+	WORD $0x2e6d01f6
+	WORD $0x6e6d01f7
+
+	// reduce integer pairs
+	VADD V18.S4, V16.S4, V16.S4
+	VADD V19.S4, V17.S4, V17.S4
+	VADD V22.S4, V20.S4, V20.S4
+	VADD V23.S4, V21.S4, V21.S4
+	VADD V20.S4, V16.S4, V16.S4
+	VADD V21.S4, V17.S4, V17.S4
+
+	// accumulate
+	VADD V16.S4, V4.S4, V4.S4
+	VADD V17.S4, V5.S4, V5.S4
+
+	// write back counts registers
+	VST1 [V4.S4, V5.S4], (R2)
+	RET
+
+TEXT accum16u32<>(SB), NOSPLIT, $0-0
+	// load counts registers
+	VLD1 (R2), [V4.S4, V5.S4, V6.S4, V7.S4]
+
+	// zero extend into dwords and fold
+//	VUADDL V8.H4, V10.H4, V16.S4
+//	VUADDL2 V8.H8, V10.H8, V17.S4
+//	VUADDL V9.H4, V11.H4, V18.S4
+//	VUADDL2 V9.H8, V11.H8, V19.S4
+//	VUADDL V12.H4, V14.H4, V20.S4
+//	VUADDL2 V12.H8, V14.H8, V21.S4
+//	VUADDL V13.H4, V15.H4, V22.S4
+//	VUADDL2 V13.H8, V15.H8, V23.S4
+	WORD $0x2e680150
+	WORD $0x6e680151
+	WORD $0x2e690172
+	WORD $0x6e690173
+	WORD $0x2e6c01d4
+	WORD $0x6e6c01d5
+	WORD $0x2e6d01f6
+	WORD $0x6e6d01f7
+
+	// reduce integer pairs
+	VADD V20.S4, V16.S4, V16.S4
+	VADD V21.S4, V17.S4, V17.S4
+	VADD V22.S4, V18.S4, V18.S4
+	VADD V23.S4, V19.S4, V19.S4
+
+	// accumulate
+	VADD V16.S4, V4.S4, V4.S4
+	VADD V17.S4, V5.S4, V5.S4
+	VADD V18.S4, V6.S4, V6.S4
+	VADD V19.S4, V7.S4, V7.S4
+
+	// write back counts registers
+	VST1 [V4.S4, V5.S4, V6.S4, V7.S4], (R2)
+	RET
+
+TEXT accum32u32<>(SB), NOSPLIT, $0-0
+	MOVD R2, R8			// destination register
+	MOVD $2, R9			// counter
+
+	// load counts registers
+loop:	VLD1 (R8), [V4.S4, V5.S4, V6.S4, V7.S4]
+
+	SUB $1, R9, R9
+
+	// zero extend into dwords and fold
+//	VUADDL V8.H4, V12.H4, V16.S4
+//	VUADDL2 V8.H8, V12.H8, V17.S4
+//	VUADDL V9.H4, V13.H4, V18.S4
+//	VUADDL2 V9.H8, V13.H8, V19.S4
+	WORD $0x2e680190
+	WORD $0x6e680191
+	WORD $0x2e6901b2
+	WORD $0x6e6901b3
+
+	// shift remaining counters forwards
+	// can't use the VMOV alias because the assembler
+	// doesn't support it.  VORR does the trick though
+	VORR V10.B16, V10.B16, V8.B16
+	VORR V11.B16, V11.B16, V9.B16
+	VORR V14.B16, V14.B16, V12.B16
+	VORR V15.B16, V15.B16, V13.B16
+
+	// accumulate
+	VADD V16.S4, V4.S4, V4.S4
+	VADD V17.S4, V5.S4, V5.S4
+	VADD V18.S4, V6.S4, V6.S4
+	VADD V19.S4, V7.S4, V7.S4
+
+	// write back
+	VST1.P [V4.S4, V5.S4, V6.S4, V7.S4], 4*16(R8)
+
+	CBNZ R9, loop
+
+	RET
+
+TEXT accum64u32<>(SB), NOSPLIT, $0-0
+	MOVD R2, R8			// destination register
+	MOVD $4, R9			// counter
+
+	// load counts registers
+loop:	VLD1 (R8), [V4.S4, V5.S4, V6.S4, V7.S4]
+
+	SUB $1, R9, R9
+
+	// zero extend into dwords
+	VUXTL V8.H4, V16.S4
+	VUXTL2 V8.H8, V17.S4
+	VUXTL V9.H4, V18.S4
+	VUXTL2 V9.H8, V19.S4
+
+	// shift remaining counters forwards
+	// can't use the VMOV alias because the assembler
+	// doesn't support it.  VORR does the trick though
+	VORR V10.B16, V10.B16, V8.B16
+	VORR V11.B16, V11.B16, V9.B16
+	VORR V12.B16, V12.B16, V10.B16
+	VORR V13.B16, V13.B16, V11.B16
+	VORR V14.B16, V14.B16, V12.B16
+	VORR V15.B16, V15.B16, V13.B16
+
+	// accumulate
+	VADD V16.S4, V4.S4, V4.S4
+	VADD V17.S4, V5.S4, V5.S4
+	VADD V18.S4, V6.S4, V6.S4
+	VADD V19.S4, V7.S4, V7.S4
+
+	// write back
+	VST1.P [V4.S4, V5.S4, V6.S4, V7.S4], 4*16(R8)
+
+	CBNZ R9, loop
+
+	RET
+
+TEXT ·count8neonu32(SB), 0, $0-32
+	LDP counts+0(FP), (R2, R1)
+	MOVD buf_len+16(FP), R3
+	MOVD $accum8u32<>(SB), R0
+	CALL countneon<>(SB)
+	RET
+
+TEXT ·count16neonu32(SB), 0, $0-32
+	LDP counts+0(FP), (R2, R1)
+	MOVD buf_len+16(FP), R3
+	MOVD $accum16u32<>(SB), R0
+	LSL $1, R3, R3			// count in bytes
+	CALL countneon<>(SB)
+	RET
+
+TEXT ·count32neonu32(SB), 0, $0-32
+	LDP counts+0(FP), (R2, R1)
+	MOVD buf_len+16(FP), R3
+	MOVD $accum32u32<>(SB), R0
+	LSL $2, R3, R3			// count in bytes
+	CALL countneon<>(SB)
+	RET
+
+TEXT ·count64neonu32(SB), 0, $0-32
+	LDP counts+0(FP), (R2, R1)
+	MOVD buf_len+16(FP), R3
+	MOVD $accum64u32<>(SB), R0
+	LSL $3, R3, R3			// count in bytes
+	CALL countneon<>(SB)
+	RET
+
+// Fused kernels counting a[i] op b[i] for the bitwise operations op.
+// The input buffers a and b are in R1 and R10.
+
+#define KERNEL countandneon<>
+#define LOAD4(A, B, C, D) \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	VLD1.P 4*16(R10), [V28.B16, V29.B16, V30.B16, V31.B16] \
+	VAND V28.B16, A.B16, A.B16 \
+	VAND V29.B16, B.B16, B.B16 \
+	VAND V30.B16, C.B16, C.B16 \
+	VAND V31.B16, D.B16, D.B16
+#define LOADD(R) \
+	MOVD.P 8(R1), R \
+	MOVD.P 8(R10), R11 \
+	AND R11, R, R
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+#define KERNEL countorneon<>
+#define LOAD4(A, B, C, D) \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	VLD1.P 4*16(R10), [V28.B16, V29.B16, V30.B16, V31.B16] \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16
+#define LOADD(R) \
+	MOVD.P 8(R1), R \
+	MOVD.P 8(R10), R11 \
+	ORR R11, R, R
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+#define KERNEL countxorneon<>
+#define LOAD4(A, B, C, D) \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	VLD1.P 4*16(R10), [V28.B16, V29.B16, V30.B16, V31.B16] \
+	VEOR V28.B16, A.B16, A.B16 \
+	VEOR V29.B16, B.B16, B.B16 \
+	VEOR V30.B16, C.B16, C.B16 \
+	VEOR V31.B16, D.B16, D.B16
+#define LOADD(R) \
+	MOVD.P 8(R1), R \
+	MOVD.P 8(R10), R11 \
+	EOR R11, R, R
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+// a &^ b = a ^ (a & b)
+#define KERNEL countandnotneon<>
+#define LOAD4(A, B, C, D) \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	VLD1.P 4*16(R10), [V28.B16, V29.B16, V30.B16, V31.B16] \
+	VAND V28.B16, A.B16, V28.B16 \
+	VEOR V28.B16, A.B16, A.B16 \
+	VAND V29.B16, B.B16, V29.B16 \
+	VEOR V29.B16, B.B16, B.B16 \
+	VAND V30.B16, C.B16, V30.B16 \
+	VEOR V30.B16, C.B16, C.B16 \
+	VAND V31.B16, D.B16, V31.B16 \
+	VEOR V31.B16, D.B16, D.B16
+#define LOADD(R) \
+	MOVD.P 8(R1), R \
+	MOVD.P 8(R10), R11 \
+	BIC R11, R, R
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+// Call the fused kernel for the bitwise operation in R4.
+TEXT binopneon<>(SB), NOSPLIT, $0-0
+	CMP $const_opOr, R4
+	BEQ or
+	CMP $const_opXor, R4
+	BEQ xor
+	CMP $const_opAndNot, R4
+	BEQ andnot
+	JMP countandneon<>(SB)
+or:	JMP countorneon<>(SB)
+xor:	JMP countxorneon<>(SB)
+andnot:	JMP countandnotneon<>(SB)
+
+TEXT ·count8neonbinop(SB), 0, $0-64
+	LDP counts+0(FP), (R2, R1)
+	MOVD a_len+16(FP), R3
+	MOVD b_base+32(FP), R10
+	MOVD op+56(FP), R4
+	MOVD $accum8<>(SB), R0
+	CALL binopneon<>(SB)
+	RET
+
+TEXT ·count16neonbinop(SB), 0, $0-64
+	LDP counts+0(FP), (R2, R1)
+	MOVD a_len+16(FP), R3
+	MOVD b_base+32(FP), R10
+	MOVD op+56(FP), R4
+	MOVD $accum16<>(SB), R0
+	LSL $1, R3, R3			// count in bytes
+	CALL binopneon<>(SB)
+	RET
+
+TEXT ·count32neonbinop(SB), 0, $0-64
+	LDP counts+0(FP), (R2, R1)
+	MOVD a_len+16(FP), R3
+	MOVD b_base+32(FP), R10
+	MOVD op+56(FP), R4
+	MOVD $accum32<>(SB), R0
+	LSL $2, R3, R3			// count in bytes
+	CALL binopneon<>(SB)
+	RET
+
+TEXT ·count64neonbinop(SB), 0, $0-64
+	LDP counts+0(FP), (R2, R1)
+	MOVD a_len+16(FP), R3
+	MOVD b_base+32(FP), R10
+	MOVD op+56(FP), R4
+	MOVD $accum64<>(SB), R0
+	LSL $3, R3, R3			// count in bytes
+	CALL binopneon<>(SB)
+	RET
+
+// Fused kernels counting the elements of buf whose bits are set in
+// the validity bitmap valid, zeroing the others as they are loaded.
+// The buffer is in R1, the bitmap in R10.  The vector loads broadcast
+// the bits of the bitmap for each vector to all lanes and test one
+// bit per lane to obtain the lane mask.  In the tail, R12 holds the
+// index of the next bit of the bitmap, which is spread to the lanes
+// of a general purpose register.
+
+// bit of each lane for 16, 32, and 64 bit lanes
+DATA maskbits<>+ 0(SB)/8, $0x0008000400020001
+DATA maskbits<>+ 8(SB)/8, $0x0080004000200010
+DATA maskbits<>+16(SB)/8, $0x0000000200000001
+DATA maskbits<>+24(SB)/8, $0x0000000800000004
+DATA maskbits<>+32(SB)/8, $0x0000000000000001
+DATA maskbits<>+40(SB)/8, $0x0000000000000002
+GLOBL maskbits<>(SB), RODATA|NOPTR, $48
+
+// R11 = bits R12 to R12+n-1 of the bitmap, followed by garbage;
+// advance R12 by n
+#define MASKBITS(n) \
+	LSR $3, R12, R11 \
+	MOVBU (R10)(R11), R11 \
+	AND $7, R12, R13 \
+	LSR R13, R11, R11 \
+	ADD $(n), R12, R12
+
+// Spread the low bits of R11 to the lanes of width l of R11, setting
+// each lane to all ones if its bit is set and to zero otherwise.  rep
+// replicates R11 into each lane, sel picks the lane's bit, bias carries
+// it into the top bit of the lane, and top isolates the top bits.  The
+// top bits are then turned into lane masks with (R11<<1) - (R11>>l-1).
+#define SPREAD(rep, sel, bias, top, l) \
+	MOVD $(rep), R13 \
+	MUL R13, R11, R11 \
+	MOVD $(sel), R13 \
+	AND R13, R11, R11 \
+	MOVD $(bias), R13 \
+	ADD R13, R11, R11 \
+	MOVD $(top), R13 \
+	AND R13, R11, R11 \
+	LSR $(l)-1, R11, R13 \
+	LSL $1, R11, R11 \
+	SUB R13, R11, R11
+
+#define MASKED(R) \
+	MOVD.P 8(R1), R \
+	AND R11, R, R
+
+// spread the 8 bytes of the bitmap to the 8 byte groups of A--D
+#define KERNEL countmasked8neon<>
+#define LOAD4(A, B, C, D) \
+	MOVD $magic<>(SB), R13 \
+	VLD1R (R13), [V24.D2] \
+	FMOVD.P 8(R10), F28 \
+	VZIP1 V28.B16, V28.B16, V28.B16 \
+	VZIP1 V28.H8, V28.H8, V29.H8 \
+	VZIP2 V28.H8, V28.H8, V30.H8 \
+	VZIP1 V29.S4, V29.S4, V28.S4 \
+	VZIP2 V29.S4, V29.S4, V29.S4 \
+	VZIP1 V30.S4, V30.S4, V31.S4 \
+	VZIP2 V30.S4, V30.S4, V30.S4 \
+	VCMTST V24.B16, V28.B16, V28.B16 \
+	VCMTST V24.B16, V29.B16, V29.B16 \
+	VCMTST V24.B16, V31.B16, V31.B16 \
+	VCMTST V24.B16, V30.B16, V30.B16 \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	VAND V28.B16, A.B16, A.B16 \
+	VAND V29.B16, B.B16, B.B16 \
+	VAND V31.B16, C.B16, C.B16 \
+	VAND V30.B16, D.B16, D.B16
+#define LOADD(R) \
+	MASKBITS(8) \
+	SPREAD(0x0101010101010101, 0x8040201008040201, 0x7f7f7f7f7f7f7f7f, 0x8080808080808080, 8) \
+	MASKED(R)
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+// each of A--D takes one byte of the bitmap
+#define KERNEL countmasked16neon<>
+#define LOAD4(A, B, C, D) \
+	MOVD $maskbits<>+0(SB), R13 \
+	VLD1 (R13), [V24.H8] \
+	MOVWU.P 4(R10), R11 \
+	VDUP R11, V28.H8 \
+	LSR $8, R11, R11 \
+	VDUP R11, V29.H8 \
+	LSR $8, R11, R11 \
+	VDUP R11, V30.H8 \
+	LSR $8, R11, R11 \
+	VDUP R11, V31.H8 \
+	VCMTST V24.H8, V28.H8, V28.H8 \
+	VCMTST V24.H8, V29.H8, V29.H8 \
+	VCMTST V24.H8, V30.H8, V30.H8 \
+	VCMTST V24.H8, V31.H8, V31.H8 \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	VAND V28.B16, A.B16, A.B16 \
+	VAND V29.B16, B.B16, B.B16 \
+	VAND V30.B16, C.B16, C.B16 \
+	VAND V31.B16, D.B16, D.B16
+#define LOADD(R) \
+	MASKBITS(4) \
+	SPREAD(0x0001000100010001, 0x0008000400020001, 0x7fff7fff7fff7fff, 0x8000800080008000, 16) \
+	MASKED(R)
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+// each of A--D takes one nibble of the bitmap
+#define KERNEL countmasked32neon<>
+#define LOAD4(A, B, C, D) \
+	MOVD $maskbits<>+16(SB), R13 \
+	VLD1 (R13), [V24.S4] \
+	MOVHU.P 2(R10), R11 \
+	VDUP R11, V28.S4 \
+	LSR $4, R11, R11 \
+	VDUP R11, V29.S4 \
+	LSR $4, R11, R11 \
+	VDUP R11, V30.S4 \
+	LSR $4, R11, R11 \
+	VDUP R11, V31.S4 \
+	VCMTST V24.S4, V28.S4, V28.S4 \
+	VCMTST V24.S4, V29.S4, V29.S4 \
+	VCMTST V24.S4, V30.S4, V30.S4 \
+	VCMTST V24.S4, V31.S4, V31.S4 \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	VAND V28.B16, A.B16, A.B16 \
+	VAND V29.B16, B.B16, B.B16 \
+	VAND V30.B16, C.B16, C.B16 \
+	VAND V31.B16, D.B16, D.B16
+#define LOADD(R) \
+	MASKBITS(2) \
+	SPREAD(0x0000000100000001, 0x0000000200000001, 0x7fffffff7fffffff, 0x8000000080000000, 32) \
+	MASKED(R)
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+// each of A--D takes one crumb of the bitmap
+#define KERNEL countmasked64neon<>
+#define LOAD4(A, B, C, D) \
+	MOVD $maskbits<>+32(SB), R13 \
+	VLD1 (R13), [V24.D2] \
+	MOVBU.P 1(R10), R11 \
+	VDUP R11, V28.D2 \
+	LSR $2, R11, R11 \
+	VDUP R11, V29.D2 \
+	LSR $2, R11, R11 \
+	VDUP R11, V30.D2 \
+	LSR $2, R11, R11 \
+	VDUP R11, V31.D2 \
+	VCMTST V24.D2, V28.D2, V28.D2 \
+	VCMTST V24.D2, V29.D2, V29.D2 \
+	VCMTST V24.D2, V30.D2, V30.D2 \
+	VCMTST V24.D2, V31.D2, V31.D2 \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	VAND V28.B16, A.B16, A.B16 \
+	VAND V29.B16, B.B16, B.B16 \
+	VAND V30.B16, C.B16, C.B16 \
+	VAND V31.B16, D.B16, D.B16
+#define LOADD(R) \
+	MASKBITS(1) \
+	AND $1, R11, R11 \
+	NEG R11, R11 \
+	MASKED(R)
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+TEXT ·count8neonmasked(SB), 0, $0-56
+	LDP counts+0(FP), (R2, R1)
+	MOVD buf_len+16(FP), R3
+	MOVD valid_base+32(FP), R10
+	MOVD $0, R12			// R12 = bit index into the tail of valid
+	MOVD $accum8<>(SB), R0
+	CALL countmasked8neon<>(SB)
+	RET
+
+TEXT ·count16neonmasked(SB), 0, $0-56
+	LDP counts+0(FP), (R2, R1)
+	MOVD buf_len+16(FP), R3
+	MOVD valid_base+32(FP), R10
+	MOVD $0, R12			// R12 = bit index into the tail of valid
+	MOVD $accum16<>(SB), R0
+	LSL $1, R3, R3			// count in bytes
+	CALL countmasked16neon<>(SB)
+	RET
+
+TEXT ·count32neonmasked(SB), 0, $0-56
+	LDP counts+0(FP), (R2, R1)
+	MOVD buf_len+16(FP), R3
+	MOVD valid_base+32(FP), R10
+	MOVD $0, R12			// R12 = bit index into the tail of valid
+	MOVD $accum32<>(SB), R0
+	LSL $2, R3, R3			// count in bytes
+	CALL countmasked32neon<>(SB)
+	RET
+
+TEXT ·count64neonmasked(SB), 0, $0-56
+	LDP counts+0(FP), (R2, R1)
+	MOVD buf_len+16(FP), R3
+	MOVD valid_base+32(FP), R10
+	MOVD $0, R12			// R12 = bit index into the tail of valid
+	MOVD $accum64<>(SB), R0
+	LSL $3, R3, R3			// count in bytes
+	CALL countmasked64neon<>(SB)
+	RET
+
+// Fused kernels counting the highest (lz) or lowest (tz) set bit of
+// each element of buf, from which the histograms of leading and
+// trailing zeros follow.  The buffer is in R1.  The vector loads reduce
+// each lane directly, the tail processes the lanes of a general purpose
+// register as a SWAR word.
+
+// R &= -R in each lane, with h the top and l the bottom bit of each
+// lane.  With b = ~R & ~h, -R = ~R + l = (b + l) ^ b ^ ~R.
+#define LOWEST(R, h, l) \
+	ORR $(h), R, R11 \
+	MVN R11, R11 \
+	MOVD $(l), R13 \
+	ADD R11, R13, R13 \
+	EOR R11, R13, R13 \
+	EON R, R13, R13 \
+	AND R13, R, R
+
+// R |= R >> k, masked with m to keep bits from crossing lanes
+#define SMEAR(R, k, m) \
+	LSR $(k), R, R11 \
+	AND $(m), R11, R11 \
+	ORR R11, R, R
+
+#define KERNEL countlz8neon<>
+#define LOAD4(A, B, C, D) \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	VUSHR $1, A.B16, V28.B16 \
+	VUSHR $1, B.B16, V29.B16 \
+	VUSHR $1, C.B16, V30.B16 \
+	VUSHR $1, D.B16, V31.B16 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $2, A.B16, V28.B16 \
+	VUSHR $2, B.B16, V29.B16 \
+	VUSHR $2, C.B16, V30.B16 \
+	VUSHR $2, D.B16, V31.B16 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $4, A.B16, V28.B16 \
+	VUSHR $4, B.B16, V29.B16 \
+	VUSHR $4, C.B16, V30.B16 \
+	VUSHR $4, D.B16, V31.B16 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $1, A.B16, V28.B16 \
+	VUSHR $1, B.B16, V29.B16 \
+	VUSHR $1, C.B16, V30.B16 \
+	VUSHR $1, D.B16, V31.B16 \
+	VEOR V28.B16, A.B16, A.B16 \
+	VEOR V29.B16, B.B16, B.B16 \
+	VEOR V30.B16, C.B16, C.B16 \
+	VEOR V31.B16, D.B16, D.B16
+#define LOADD(R) \
+	MOVD.P 8(R1), R \
+	SMEAR(R, 1, 0x7f7f7f7f7f7f7f7f) \
+	SMEAR(R, 2, 0x3f3f3f3f3f3f3f3f) \
+	SMEAR(R, 4, 0x0f0f0f0f0f0f0f0f) \
+	LSR $1, R, R11 \
+	AND $0x7f7f7f7f7f7f7f7f, R11, R11 \
+	EOR R11, R, R
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+#define KERNEL counttz8neon<>
+#define LOAD4(A, B, C, D) \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	VMOVI $0, V24.B16 \
+	VSUB A.B16, V24.B16, V28.B16 \
+	VSUB B.B16, V24.B16, V29.B16 \
+	VSUB C.B16, V24.B16, V30.B16 \
+	VSUB D.B16, V24.B16, V31.B16 \
+	VAND V28.B16, A.B16, A.B16 \
+	VAND V29.B16, B.B16, B.B16 \
+	VAND V30.B16, C.B16, C.B16 \
+	VAND V31.B16, D.B16, D.B16
+#define LOADD(R) \
+	MOVD.P 8(R1), R \
+	LOWEST(R, 0x8080808080808080, 0x0101010101010101)
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+#define KERNEL countlz16neon<>
+#define LOAD4(A, B, C, D) \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	VUSHR $1, A.H8, V28.H8 \
+	VUSHR $1, B.H8, V29.H8 \
+	VUSHR $1, C.H8, V30.H8 \
+	VUSHR $1, D.H8, V31.H8 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $2, A.H8, V28.H8 \
+	VUSHR $2, B.H8, V29.H8 \
+	VUSHR $2, C.H8, V30.H8 \
+	VUSHR $2, D.H8, V31.H8 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $4, A.H8, V28.H8 \
+	VUSHR $4, B.H8, V29.H8 \
+	VUSHR $4, C.H8, V30.H8 \
+	VUSHR $4, D.H8, V31.H8 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $8, A.H8, V28.H8 \
+	VUSHR $8, B.H8, V29.H8 \
+	VUSHR $8, C.H8, V30.H8 \
+	VUSHR $8, D.H8, V31.H8 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $1, A.H8, V28.H8 \
+	VUSHR $1, B.H8, V29.H8 \
+	VUSHR $1, C.H8, V30.H8 \
+	VUSHR $1, D.H8, V31.H8 \
+	VEOR V28.B16, A.B16, A.B16 \
+	VEOR V29.B16, B.B16, B.B16 \
+	VEOR V30.B16, C.B16, C.B16 \
+	VEOR V31.B16, D.B16, D.B16
+#define LOADD(R) \
+	MOVD.P 8(R1), R \
+	SMEAR(R, 1, 0x7fff7fff7fff7fff) \
+	SMEAR(R, 2, 0x3fff3fff3fff3fff) \
+	SMEAR(R, 4, 0x0fff0fff0fff0fff) \
+	SMEAR(R, 8, 0x00ff00ff00ff00ff) \
+	LSR $1, R, R11 \
+	AND $0x7fff7fff7fff7fff, R11, R11 \
+	EOR R11, R, R
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+#define KERNEL counttz16neon<>
+#define LOAD4(A, B, C, D) \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	VMOVI $0, V24.B16 \
+	VSUB A.H8, V24.H8, V28.H8 \
+	VSUB B.H8, V24.H8, V29.H8 \
+	VSUB C.H8, V24.H8, V30.H8 \
+	VSUB D.H8, V24.H8, V31.H8 \
+	VAND V28.B16, A.B16, A.B16 \
+	VAND V29.B16, B.B16, B.B16 \
+	VAND V30.B16, C.B16, C.B16 \
+	VAND V31.B16, D.B16, D.B16
+#define LOADD(R) \
+	MOVD.P 8(R1), R \
+	LOWEST(R, 0x8000800080008000, 0x0001000100010001)
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+#define KERNEL countlz32neon<>
+#define LOAD4(A, B, C, D) \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	VUSHR $1, A.S4, V28.S4 \
+	VUSHR $1, B.S4, V29.S4 \
+	VUSHR $1, C.S4, V30.S4 \
+	VUSHR $1, D.S4, V31.S4 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $2, A.S4, V28.S4 \
+	VUSHR $2, B.S4, V29.S4 \
+	VUSHR $2, C.S4, V30.S4 \
+	VUSHR $2, D.S4, V31.S4 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $4, A.S4, V28.S4 \
+	VUSHR $4, B.S4, V29.S4 \
+	VUSHR $4, C.S4, V30.S4 \
+	VUSHR $4, D.S4, V31.S4 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $8, A.S4, V28.S4 \
+	VUSHR $8, B.S4, V29.S4 \
+	VUSHR $8, C.S4, V30.S4 \
+	VUSHR $8, D.S4, V31.S4 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $16, A.S4, V28.S4 \
+	VUSHR $16, B.S4, V29.S4 \
+	VUSHR $16, C.S4, V30.S4 \
+	VUSHR $16, D.S4, V31.S4 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $1, A.S4, V28.S4 \
+	VUSHR $1, B.S4, V29.S4 \
+	VUSHR $1, C.S4, V30.S4 \
+	VUSHR $1, D.S4, V31.S4 \
+	VEOR V28.B16, A.B16, A.B16 \
+	VEOR V29.B16, B.B16, B.B16 \
+	VEOR V30.B16, C.B16, C.B16 \
+	VEOR V31.B16, D.B16, D.B16
+#define LOADD(R) \
+	MOVD.P 8(R1), R \
+	SMEAR(R, 1, 0x7fffffff7fffffff) \
+	SMEAR(R, 2, 0x3fffffff3fffffff) \
+	SMEAR(R, 4, 0x0fffffff0fffffff) \
+	SMEAR(R, 8, 0x00ffffff00ffffff) \
+	SMEAR(R, 16, 0x0000ffff0000ffff) \
+	LSR $1, R, R11 \
+	AND $0x7fffffff7fffffff, R11, R11 \
+	EOR R11, R, R
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+#define KERNEL counttz32neon<>
+#define LOAD4(A, B, C, D) \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	VMOVI $0, V24.B16 \
+	VSUB A.S4, V24.S4, V28.S4 \
+	VSUB B.S4, V24.S4, V29.S4 \
+	VSUB C.S4, V24.S4, V30.S4 \
+	VSUB D.S4, V24.S4, V31.S4 \
+	VAND V28.B16, A.B16, A.B16 \
+	VAND V29.B16, B.B16, B.B16 \
+	VAND V30.B16, C.B16, C.B16 \
+	VAND V31.B16, D.B16, D.B16
+#define LOADD(R) \
+	MOVD.P 8(R1), R \
+	LOWEST(R, 0x8000000080000000, 0x0000000100000001)
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+#define KERNEL countlz64neon<>
+#define LOAD4(A, B, C, D) \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	VUSHR $1, A.D2, V28.D2 \
+	VUSHR $1, B.D2, V29.D2 \
+	VUSHR $1, C.D2, V30.D2 \
+	VUSHR $1, D.D2, V31.D2 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $2, A.D2, V28.D2 \
+	VUSHR $2, B.D2, V29.D2 \
+	VUSHR $2, C.D2, V30.D2 \
+	VUSHR $2, D.D2, V31.D2 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $4, A.D2, V28.D2 \
+	VUSHR $4, B.D2, V29.D2 \
+	VUSHR $4, C.D2, V30.D2 \
+	VUSHR $4, D.D2, V31.D2 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $8, A.D2, V28.D2 \
+	VUSHR $8, B.D2, V29.D2 \
+	VUSHR $8, C.D2, V30.D2 \
+	VUSHR $8, D.D2, V31.D2 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $16, A.D2, V28.D2 \
+	VUSHR $16, B.D2, V29.D2 \
+	VUSHR $16, C.D2, V30.D2 \
+	VUSHR $16, D.D2, V31.D2 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $32, A.D2, V28.D2 \
+	VUSHR $32, B.D2, V29.D2 \
+	VUSHR $32, C.D2, V30.D2 \
+	VUSHR $32, D.D2, V31.D2 \
+	VORR V28.B16, A.B16, A.B16 \
+	VORR V29.B16, B.B16, B.B16 \
+	VORR V30.B16, C.B16, C.B16 \
+	VORR V31.B16, D.B16, D.B16 \
+	VUSHR $1, A.D2, V28.D2 \
+	VUSHR $1, B.D2, V29.D2 \
+	VUSHR $1, C.D2, V30.D2 \
+	VUSHR $1, D.D2, V31.D2 \
+	VEOR V28.B16, A.B16, A.B16 \
+	VEOR V29.B16, B.B16, B.B16 \
+	VEOR V30.B16, C.B16, C.B16 \
+	VEOR V31.B16, D.B16, D.B16
+#define LOADD(R) \
+	MOVD.P 8(R1), R \
+	ORR R>>1, R, R \
+	ORR R>>2, R, R \
+	ORR R>>4, R, R \
+	ORR R>>8, R, R \
+	ORR R>>16, R, R \
+	ORR R>>32, R, R \
+	EOR R>>1, R, R
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+#define KERNEL counttz64neon<>
+#define LOAD4(A, B, C, D) \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	VMOVI $0, V24.B16 \
+	VSUB A.D2, V24.D2, V28.D2 \
+	VSUB B.D2, V24.D2, V29.D2 \
+	VSUB C.D2, V24.D2, V30.D2 \
+	VSUB D.D2, V24.D2, V31.D2 \
+	VAND V28.B16, A.B16, A.B16 \
+	VAND V29.B16, B.B16, B.B16 \
+	VAND V30.B16, C.B16, C.B16 \
+	VAND V31.B16, D.B16, D.B16
+#define LOADD(R) \
+	MOVD.P 8(R1), R \
+	NEG R, R11 \
+	AND R11, R, R
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+
+TEXT ·count8neononehot(SB), 0, $0-33
+	LDP counts+0(FP), (R2, R1)
+	MOVD buf_len+16(FP), R3
+	MOVBU leading+32(FP), R4
+	MOVD $accum8<>(SB), R0
+	CBNZ R4, lz
+	CALL counttz8neon<>(SB)
+	RET
+
+lz:	CALL countlz8neon<>(SB)
+	RET
+
+TEXT ·count16neononehot(SB), 0, $0-33
+	LDP counts+0(FP), (R2, R1)
+	MOVD buf_len+16(FP), R3
+	MOVBU leading+32(FP), R4
+	MOVD $accum16<>(SB), R0
+	LSL $1, R3, R3			// count in bytes
+	CBNZ R4, lz
+	CALL counttz16neon<>(SB)
+	RET
+
+lz:	CALL countlz16neon<>(SB)
+	RET
+
+TEXT ·count32neononehot(SB), 0, $0-33
+	LDP counts+0(FP), (R2, R1)
+	MOVD buf_len+16(FP), R3
+	MOVBU leading+32(FP), R4
+	MOVD $accum32<>(SB), R0
+	LSL $2, R3, R3			// count in bytes
+	CBNZ R4, lz
+	CALL counttz32neon<>(SB)
+	RET
+
+lz:	CALL countlz32neon<>(SB)
+	RET
+
+TEXT ·count64neononehot(SB), 0, $0-33
+	LDP counts+0(FP), (R2, R1)
+	MOVD buf_len+16(FP), R3
+	MOVBU leading+32(FP), R4
+	MOVD $accum64<>(SB), R0
+	LSL $3, R3, R3			// count in bytes
+	CBNZ R4, lz
+	CALL counttz64neon<>(SB)
+	RET
+
+lz:	CALL countlz64neon<>(SB)
+	RET
+
+// Segmented counting.  The buffer in R1 is split into segments of R15
+// bytes each, which are counted with a fused kernel using plain loads
+// into consecutive counter arrays at R2, flushing the accumulators at
+// the end of each segment.  As the kernel has no head processing, the
+// segments need not be aligned.
+
+#define KERNEL countsegneon<>
+#define LOAD4(A, B, C, D) \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16]
+#define LOADD(R) \
+	MOVD.P 8(R1), R
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+// Count R14 bytes at R1 in segments of R15 bytes each into consecutive
+// counter arrays of R19 bytes each at R2.  R14 must be a multiple of
+// R15 and R15 a multiple of 8.
+TEXT segmentsneon<>(SB), NOSPLIT, $0-0
+	SUBS R15, R14, R14
+	BLT end
+
+loop:	MOVD R15, R3
+	CALL countsegneon<>(SB)
+	ADD R19, R2, R2			// advance to the next counter array
+	SUBS R15, R14, R14
+	BGE loop
+
+end:	RET
+
+TEXT ·count8neonsegments(SB), 0, $0-56
+	MOVD out_base+0(FP), R2
+	MOVD buf_base+24(FP), R1
+	MOVD buf_len+32(FP), R14
+	MOVD segLen+48(FP), R15
+	MOVD $accum8<>(SB), R0
+	MOVD $8*8, R19			// size of a counter array
+	CALL segmentsneon<>(SB)
+	RET
+
+TEXT ·count16neonsegments(SB), 0, $0-56
+	MOVD out_base+0(FP), R2
+	MOVD buf_base+24(FP), R1
+	MOVD buf_len+32(FP), R14
+	MOVD segLen+48(FP), R15
+	MOVD $accum16<>(SB), R0
+	MOVD $16*8, R19			// size of a counter array
+	LSL $1, R14, R14			// count in bytes
+	LSL $1, R15, R15
+	CALL segmentsneon<>(SB)
+	RET
+
+TEXT ·count32neonsegments(SB), 0, $0-56
+	MOVD out_base+0(FP), R2
+	MOVD buf_base+24(FP), R1
+	MOVD buf_len+32(FP), R14
+	MOVD segLen+48(FP), R15
+	MOVD $accum32<>(SB), R0
+	MOVD $32*8, R19			// size of a counter array
+	LSL $2, R14, R14			// count in bytes
+	LSL $2, R15, R15
+	CALL segmentsneon<>(SB)
+	RET
+
+TEXT ·count64neonsegments(SB), 0, $0-56
+	MOVD out_base+0(FP), R2
+	MOVD buf_base+24(FP), R1
+	MOVD buf_len+32(FP), R14
+	MOVD segLen+48(FP), R15
+	MOVD $accum64<>(SB), R0
+	MOVD $64*8, R19			// size of a counter array
+	LSL $3, R14, R14			// count in bytes
+	LSL $3, R15, R15
+	CALL segmentsneon<>(SB)
+	RET
+
+// Fused kernels computing the popcount histogram of buf alongside the
+// positional counts.  The buffer is in R1 and the histogram in R10.
+// After each load, the elements just loaded are histogrammed by the
+// helpers below while they are still in the cache.
+
+// Add the popcounts of the elements of the -R11 bytes preceding R1 to
+// the histogram in R10, i.e. increment 8*k(R10) for every element with
+// k bits set.  Trashes V24 and R11--R13.
+#define HIST(load, size) \
+	load (R1)(R11), R13 \
+	FMOVD R13, F24 \
+	VCNT V24.B8, V24.B8 \
+	VUADDLV V24.B8, V24 \
+	FMOVD F24, R13 \
+	MOVD (R10)(R13<<3), R12 \
+	ADD $1, R12, R12 \
+	MOVD R12, (R10)(R13<<3) \
+	ADDS $(size), R11, R11
+
+TEXT hist8<>(SB), NOSPLIT, $0-0
+loop:	HIST(MOVBU, 1)
+	BNE loop
+	RET
+
+TEXT hist16<>(SB), NOSPLIT, $0-0
+loop:	HIST(MOVHU, 2)
+	BNE loop
+	RET
+
+TEXT hist32<>(SB), NOSPLIT, $0-0
+loop:	HIST(MOVWU, 4)
+	BNE loop
+	RET
+
+TEXT hist64<>(SB), NOSPLIT, $0-0
+loop:	HIST(MOVD, 8)
+	BNE loop
+	RET
+
+#undef HIST
+
+#define KERNEL counthist8neon<>
+#define LOAD4(A, B, C, D) \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	MOVD $-4*16, R11 \
+	CALL hist8<>(SB)
+#define LOADD(R) \
+	MOVD.P 8(R1), R \
+	MOVD $-8, R11 \
+	CALL hist8<>(SB)
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+#define KERNEL counthist16neon<>
+#define LOAD4(A, B, C, D) \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	MOVD $-4*16, R11 \
+	CALL hist16<>(SB)
+#define LOADD(R) \
+	MOVD.P 8(R1), R \
+	MOVD $-8, R11 \
+	CALL hist16<>(SB)
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+#define KERNEL counthist32neon<>
+#define LOAD4(A, B, C, D) \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	MOVD $-4*16, R11 \
+	CALL hist32<>(SB)
+#define LOADD(R) \
+	MOVD.P 8(R1), R \
+	MOVD $-8, R11 \
+	CALL hist32<>(SB)
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+#define KERNEL counthist64neon<>
+#define LOAD4(A, B, C, D) \
+	VLD1.P 4*16(R1), [A.B16, B.B16, C.B16, D.B16] \
+	MOVD $-4*16, R11 \
+	CALL hist64<>(SB)
+#define LOADD(R) \
+	MOVD.P 8(R1), R \
+	MOVD $-8, R11 \
+	CALL hist64<>(SB)
+#include "countneonfused_arm64.h"
+#undef KERNEL
+#undef LOAD4
+#undef LOADD
+
+TEXT ·count8neonhist(SB), 0, $0-40
+	LDP counts+0(FP), (R2, R10)
+	MOVD buf_base+16(FP), R1
+	MOVD buf_len+24(FP), R3
+	MOVD $accum8<>(SB), R0
+	CALL counthist8neon<>(SB)
+	RET
+
+TEXT ·count16neonhist(SB), 0, $0-40
+	LDP counts+0(FP), (R2, R10)
+	MOVD buf_base+16(FP), R1
+	MOVD buf_len+24(FP), R3
+	MOVD $accum16<>(SB), R0
+	LSL $1, R3, R3			// count in bytes
+	CALL counthist16neon<>(SB)
+	RET
+
+TEXT ·count32neonhist(SB), 0, $0-40
+	LDP counts+0(FP), (R2, R10)
+	MOVD buf_base+16(FP), R1
+	MOVD buf_len+24(FP), R3
+	MOVD $accum32<>(SB), R0
+	LSL $2, R3, R3			// count in bytes
+	CALL counthist32neon<>(SB)
+	RET
+
+TEXT ·count64neonhist(SB), 0, $0-40
+	LDP counts+0(FP), (R2, R10)
+	MOVD buf_base+16(FP), R1
+	MOVD buf_len+24(FP), R3
+	MOVD $accum64<>(SB), R0
+	LSL $3, R3, R3			// count in bytes
+	CALL counthist64neon<>(SB)
+	RET
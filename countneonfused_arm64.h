@@ -0,0 +1,225 @@
+// Fused NEON kernel template.  A fused kernel works like countneon<>,
+// but computes each vector from one or more input streams as it loads
+// it, e.g. by combining two buffers with a bitwise operation.  As the
+// input streams may differ in alignment, there is no head processing.
+// Before including this file, define
+//
+//     KERNEL            the name of the kernel
+//     LOAD4(A, B, C, D) load the next 64 bytes into A, B, C, and D and
+//                       advance the input streams, trashing at most
+//                       V24, V28--V31, and R11--R13
+//     LOADD(R)          load the next 8 bytes into R and advance the
+//                       input streams, trashing at most V24 and
+//                       R11--R13
+//
+// This function expects a pointer to a width-specific accumulation
+// function in R0, counters in R2 and the remaining length in R3.  The
+// length must be a multiple of 8 bytes.
+TEXT KERNEL(SB), NOSPLIT, $0-0
+	VMOVI $0, V0.B16		// initialise place-value vectors
+	VMOVI $0, V1.B16
+	VMOVI $0, V2.B16
+	VMOVI $0, V3.B16
+	VMOVI $0, V8.B16		// initialise counters
+	VMOVI $0, V9.B16
+	VMOVI $0, V10.B16
+	VMOVI $0, V11.B16
+	VMOVI $0, V12.B16
+	VMOVI $0, V13.B16
+	VMOVI $0, V14.B16
+	VMOVI $0, V15.B16
+
+	SUBS $16*16, R3, R3		// enough data left to process?
+	BLT endvec
+
+	VMOVI $0x55, V27.B16		// 55555555 for transposition
+	VMOVI $0x33, V26.B16		// 33333333 for transposition
+	VMOVI $0x0f, V25.B16		// 0f0f0f0f for extracting nibbles
+	MOVD $65535, R6			// space left til overflow could occur in V8--V15
+
+	// load 16 registers worth of data and accumulate into V4--V0
+vec:	LOAD4(V4, V5, V6, V7)
+	LOAD4(V16, V17, V18, V19)
+	LOAD4(V20, V21, V22, V23)
+	CSA(V4, V5, V6)
+	CSA(V0, V17, V19)
+	CSA(V7, V16, V18)
+	CSA(V21, V22, V20)
+	CSA(V1, V5, V17)
+	LOAD4(V17, V18, V19, V20)
+	CSA(V0, V4, V7)
+	CSA(V17, V18, V23)
+	CSA(V19, V20, V21)
+	CSA(V16, V18, V22)
+	CSA(V1, V4, V20)
+	CSA(V0, V17, V19)
+	CSA(V2, V5, V18)
+	CSA(V1, V16, V17)
+	CSA(V2, V4, V16)
+	CSA(V3, V4, V5)
+
+	// now V0..V4 hold counters; preserve V0..V3 for the next round and
+	// add V4 to counters.
+
+	// split into even/odd and reduce into crumbs
+	VAND V27.B16, V4.B16, V5.B16	// V5 = bits 02468ace x8
+//	VBIC V27.B16, V4.B16, V6.B16	// V6 = bits 13579bdf x8
+	WORD $0x4e7b1c86
+	VUSHR $1, V6.B16, V6.B16
+	VZIP1 V6.D2, V5.D2, V4.D2
+	VZIP2 V6.D2, V5.D2, V5.D2
+	VADD V5.B16, V4.B16, V4.B16	// V4 = 02468ace x4 13579bdf x4
+
+	// split again into nibbles
+	VAND V26.B16, V4.B16, V5.B16	// V5 = 048c x4 159d x4
+//	VBIC V26.B16, V4.B16, V6.B16	// V6 = 26ae x4 37bf x4
+	WORD $0x4e7a1c86
+	VUSHR $2, V6.B16, V6.B16
+
+	// split again into bytes and shuffle into order (also scale)
+	VAND V25.B16, V5.B16, V4.B16	// V4 = 08 x4 19 x4
+//	VBIC V25.B16, V5.B16, V5.B16	// V5 = 4c x4 5d x4
+	WORD $0x4e791ca5
+//	VBIC V25.B16, V6.B16, V7.B16	// V7 = 6e x4 7f x4
+	WORD $0x4e791cc7
+	VAND V25.B16, V6.B16, V6.B16	// V6 = 2a x4 3b x4
+	VSHL $4, V4.B16, V4.B16
+	VSHL $4, V6.B16, V6.B16
+
+	VZIP1 V6.B16, V4.B16, V16.B16	// V16 = 028a x4
+	VZIP2 V6.B16, V4.B16, V17.B16	// V17 = 139b x4
+	VZIP1 V7.B16, V5.B16, V18.B16	// V18 = 46ce x4
+	VZIP2 V7.B16, V5.B16, V19.B16	// V19 = 57df x4
+
+	VZIP1 V17.B16, V16.B16, V4.B16	// V4 = 012389ab[0:1]
+	VZIP2 V17.B16, V16.B16, V5.B16	// V5 = 012389ab[2:3]
+	VZIP1 V19.B16, V18.B16, V6.B16	// V6 = 4567cdef[0:1]
+	VZIP2 V19.B16, V18.B16, V7.B16	// V7 = 4567cdef[2:3]
+
+	VZIP1 V6.S4, V4.S4, V16.S4	// V16 = 01234567[0:1]
+	VZIP2 V6.S4, V4.S4, V17.S4	// V17 = 89abcdef[0:1]
+	VZIP1 V7.S4, V5.S4, V18.S4	// V18 = 01234567[2:3]
+	VZIP2 V7.S4, V5.S4, V19.S4	// V19 = 89abcdef[2:3]
+
+	// add to counters
+	VUADDW V16.B8, V8.H8, V8.H8
+	VUADDW2 V16.B16, V9.H8, V9.H8
+	VUADDW V17.B8, V10.H8, V10.H8
+	VUADDW2 V17.B16, V11.H8, V11.H8
+	VUADDW V18.B8, V12.H8, V12.H8
+	VUADDW2 V18.B16, V13.H8, V13.H8
+	VUADDW V19.B8, V14.H8, V14.H8
+	VUADDW2 V19.B16, V15.H8, V15.H8
+
+	SUB $16*2, R6, R6		// account for possible overflow
+	CMP $(15+15)*2, R6		// enough space left in the counters?
+
+	BGE have_space
+
+	CALL *R0			// call accumulation function
+	VMOVI $0, V8.B16		// clear counters for next round
+	VMOVI $0, V9.B16
+	VMOVI $0, V10.B16
+	VMOVI $0, V11.B16
+	VMOVI $0, V12.B16
+	VMOVI $0, V13.B16
+	VMOVI $0, V14.B16
+	VMOVI $0, V15.B16
+
+	MOVD $65535, R6			// space left til overflow could occur
+
+have_space:
+	SUBS $16*16, R3, R3		// account for bytes consumed
+	BGE vec
+
+	// group V0--V3 into nibbles in the same register
+	VUSHR $1, V0.B16, V4.B16
+	VADD V1.B16, V1.B16, V5.B16
+	VUSHR $1, V2.B16, V6.B16
+	VADD V3.B16, V3.B16, V7.B16
+	VBIF V27.B16, V5.B16, V0.B16	// V0 = eca86420 (low crumbs)
+	VBIT V27.B16, V4.B16, V1.B16	// V1 = fdb97531 (high crumbs)
+	VBIF V27.B16, V7.B16, V2.B16	// V2 = eca86420 (low crumbs)
+	VBIT V27.B16, V6.B16, V3.B16	// V3 = fdb97531 (high crumbs)
+
+	VUSHR $2, V0.B16, V4.B16
+	VUSHR $2, V1.B16, V6.B16
+	VSHL $2, V2.B16, V5.B16
+	VSHL $2, V3.B16, V7.B16
+	VBIT V26.B16, V4.B16, V2.B16	// V2 = ea62
+	VBIT V26.B16, V6.B16, V3.B16	// V3 = fb73
+	VBIF V26.B16, V5.B16, V0.B16	// V0 = c840
+	VBIF V26.B16, V7.B16, V1.B16	// V1 = d951
+
+	// pre-shuffle nibbles
+	VZIP1 V3.B16, V2.B16, V6.B16	// V6 = fbea7362 (3:2:1:0)
+	VZIP2 V3.B16, V2.B16, V3.B16	// V3 = fbea7362 (7:6:5:4)
+	VZIP1 V1.B16, V0.B16, V5.B16	// V5 = d9c85140 (3:2:1:0)
+	VZIP2 V1.B16, V0.B16, V2.B16	// V2 = d9c85140 (7:6:5:4)
+	VZIP1 V6.H8, V5.H8, V4.H8	// V4 = fbead9c873625140 (1:0)
+	VZIP2 V6.H8, V5.H8, V5.H8	// V5 = fbead9c873625140 (3:2)
+	VZIP1 V3.H8, V2.H8, V6.H8	// V6 = fbead9c873625150 (5:4)
+	VZIP2 V3.H8, V2.H8, V7.H8	// V7 = fbead9c873625150 (7:6)
+
+	// pull out high and low nibbles and reduce once
+	VAND V4.B16, V25.B16, V0.B16
+	VUSHR $4, V4.B16, V4.B16
+	VAND V5.B16, V25.B16, V1.B16
+	VUSHR $4, V5.B16, V5.B16
+	VAND V6.B16, V25.B16, V2.B16
+	VADD V0.B16, V2.B16, V0.B16	// V0 = ba983210 (1:0)
+	VUSRA $4, V6.B16, V4.B16	// V4 = fedc7654 (1:0)
+	VAND V7.B16, V25.B16, V3.B16
+	VADD V1.B16, V3.B16, V1.B16	// V1 = ba983210 (3:2)
+	VUSRA $4, V7.B16, V5.B16	// V5 = fedc7654 (3:2)
+
+	// shuffle one last time
+	VZIP1 V4.S4, V0.S4, V2.S4	// V2 = fedcba987654 (0)
+	VZIP2 V4.S4, V0.S4, V3.S4	// V3 = fedcba987654 (1)
+	VZIP1 V5.S4, V1.S4, V6.S4	// V6 = fedcba987654 (2)
+	VZIP2 V5.S4, V1.S4, V7.S4	// V7 = fedcba987654 (3)
+
+	// add to counters
+	VUADDW V2.B8, V8.H8, V8.H8
+	VUADDW2 V2.B16, V9.H8, V9.H8
+	VUADDW V3.B8, V10.H8, V10.H8
+	VUADDW2 V3.B16, V11.H8, V11.H8
+	VUADDW V6.B8, V12.H8, V12.H8
+	VUADDW2 V6.B16, V13.H8, V13.H8
+	VUADDW V7.B8, V14.H8, V14.H8
+	VUADDW2 V7.B16, V15.H8, V15.H8
+
+endvec:	MOVD $magic<>(SB), R4		// constants for processing the tail
+	VLD1R (R4), [V28.D2]		// 80402010080402018040201008040201
+	VMOVI $1, V30.B8		// 00000000000000000101010101010101
+	VMOVI $2, V29.B16		// 02020202020202020202020202020202
+	VADD V30.B16, V29.B16, V29.B16	// 02020202020202020303030303030303
+	VMOVI $0, V0.B16		// counter registers
+	VMOVI $0, V1.B16
+	VMOVI $0, V2.B16
+	VMOVI $0, V3.B16
+
+	// process tail, 8 bytes at a time
+	ADDS $16*16, R3, R3		// any bytes left to process?
+	BEQ end
+
+tail8:	LOADD(R6)
+	FMOVD R6, F6
+	VEXT $4, V6.B16, V6.B16, V7.B16
+	COUNT4(V0, V1, V6)
+	COUNT4(V2, V3, V7)
+	SUBS $8, R3, R3
+	BGT tail8
+
+	// add tail to counters
+end:	VUADDW V0.B8, V9.H8, V9.H8
+	VUADDW2 V0.B16, V8.H8, V8.H8
+	VUADDW V1.B8, V11.H8, V11.H8
+	VUADDW2 V1.B16, V10.H8, V10.H8
+	VUADDW V2.B8, V13.H8, V13.H8
+	VUADDW2 V2.B16, V12.H8, V12.H8
+	VUADDW V3.B8, V15.H8, V15.H8
+	VUADDW2 V3.B16, V14.H8, V14.H8
+
+	CALL *R0
+	RET
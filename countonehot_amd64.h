@@ -0,0 +1,112 @@
+// Tail loads for the one-hot fused kernels.  The one-hot kernels count
+// the highest or lowest set bit of each element of the buffer in SI,
+// from which the histograms of leading and trailing zeros follow.
+// HIGHESTQ8(R) ... HIGHESTQ64(R) and LOWESTQ8(R) ... LOWESTQ64(R) load
+// the next 8 bytes of 8, 16, 32, or 64 bit elements into R, reduce each
+// element to its highest or lowest set bit, and advance SI, trashing
+// R11 and R13.  The lanes are processed as SWAR words.
+
+// R |= R >> k, masked with m to keep bits from crossing lanes
+#define SMEAR(R, k, m) \
+	MOVQ R, R11 \
+	SHRQ $(k), R11 \
+	MOVQ $(m), R13 \
+	ANDQ R13, R11 \
+	ORQ R11, R
+
+// turn the smeared lanes of R into their highest set bit
+#define TOPBIT(R, m) \
+	MOVQ R, R11 \
+	SHRQ $1, R11 \
+	MOVQ $(m), R13 \
+	ANDQ R13, R11 \
+	XORQ R11, R
+
+// R &= -R in each lane, with h the top and l the bottom bit of each
+// lane.  With b = ~R & ~h, -R = ~R + l = (b + l) ^ b ^ ~R.
+#define LOWEST(R, h, l) \
+	MOVQ R, R11 \
+	MOVQ $(h), R13 \
+	ORQ R13, R11 \
+	NOTQ R11 \
+	MOVQ $(l), R13 \
+	ADDQ R11, R13 \
+	XORQ R11, R13 \
+	XORQ R, R13 \
+	NOTQ R13 \
+	ANDQ R13, R
+
+#define HIGHESTQ8(R) \
+	MOVQ (SI), R \
+	SMEAR(R, 1, 0x7f7f7f7f7f7f7f7f) \
+	SMEAR(R, 2, 0x3f3f3f3f3f3f3f3f) \
+	SMEAR(R, 4, 0x0f0f0f0f0f0f0f0f) \
+	TOPBIT(R, 0x7f7f7f7f7f7f7f7f) \
+	ADDQ $8, SI
+
+#define HIGHESTQ16(R) \
+	MOVQ (SI), R \
+	SMEAR(R, 1, 0x7fff7fff7fff7fff) \
+	SMEAR(R, 2, 0x3fff3fff3fff3fff) \
+	SMEAR(R, 4, 0x0fff0fff0fff0fff) \
+	SMEAR(R, 8, 0x00ff00ff00ff00ff) \
+	TOPBIT(R, 0x7fff7fff7fff7fff) \
+	ADDQ $8, SI
+
+#define HIGHESTQ32(R) \
+	MOVQ (SI), R \
+	SMEAR(R, 1, 0x7fffffff7fffffff) \
+	SMEAR(R, 2, 0x3fffffff3fffffff) \
+	SMEAR(R, 4, 0x0fffffff0fffffff) \
+	SMEAR(R, 8, 0x00ffffff00ffffff) \
+	SMEAR(R, 16, 0x0000ffff0000ffff) \
+	TOPBIT(R, 0x7fffffff7fffffff) \
+	ADDQ $8, SI
+
+// a single lane needs no masking
+#define HIGHESTQ64(R) \
+	MOVQ (SI), R \
+	MOVQ R, R11 \
+	SHRQ $1, R11 \
+	ORQ R11, R \
+	MOVQ R, R11 \
+	SHRQ $2, R11 \
+	ORQ R11, R \
+	MOVQ R, R11 \
+	SHRQ $4, R11 \
+	ORQ R11, R \
+	MOVQ R, R11 \
+	SHRQ $8, R11 \
+	ORQ R11, R \
+	MOVQ R, R11 \
+	SHRQ $16, R11 \
+	ORQ R11, R \
+	MOVQ R, R11 \
+	SHRQ $32, R11 \
+	ORQ R11, R \
+	MOVQ R, R11 \
+	SHRQ $1, R11 \
+	XORQ R11, R \
+	ADDQ $8, SI
+
+#define LOWESTQ8(R) \
+	MOVQ (SI), R \
+	LOWEST(R, 0x8080808080808080, 0x0101010101010101) \
+	ADDQ $8, SI
+
+#define LOWESTQ16(R) \
+	MOVQ (SI), R \
+	LOWEST(R, 0x8000800080008000, 0x0001000100010001) \
+	ADDQ $8, SI
+
+#define LOWESTQ32(R) \
+	MOVQ (SI), R \
+	LOWEST(R, 0x8000000080000000, 0x0000000100000001) \
+	ADDQ $8, SI
+
+#define LOWESTQ64(R) \
+	MOVQ (SI), R \
+	MOVQ R, R11 \
+	NEGQ R11 \
+	ANDQ R11, R \
+	ADDQ $8, SI
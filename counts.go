@@ -0,0 +1,396 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The CountsN types hold the results of a positional population count
+// and provide common operations on them.  They have the same
+// underlying type as the arrays taken by Count8, Count16, Count32, and
+// Count64 and can be converted to and from them at no cost:
+//
+//	var c Counts64
+//	pospop.Count64((*[64]int)(&c), buf)
+//
+// The text form of the counts is a space-separated list of decimal
+// numbers; the JSON form is an array of numbers.
+
+// add d to c element-wise
+func addCounts(c, d []int) {
+	for i := range c {
+		c[i] += d[i]
+	}
+}
+
+// subtract d from c element-wise
+func subCounts(c, d []int) {
+	for i := range c {
+		c[i] -= d[i]
+	}
+}
+
+// sum of all counters in c
+func totalCounts(c []int) int {
+	total := 0
+	for _, x := range c {
+		total += x
+	}
+
+	return total
+}
+
+// given counts c over n elements, compute the counts of clear bits
+func zeroCounts(z, c []int, n int) {
+	for i := range c {
+		z[i] = n - c[i]
+	}
+}
+
+// compute the fraction of set bits in each position
+func fractionCounts(f []float64, c []int, n int) {
+	// no elements were counted, so no bits were set
+	if n == 0 {
+		return
+	}
+
+	for i := range c {
+		f[i] = float64(c[i]) / float64(n)
+	}
+}
+
+// format c as a space-separated list of decimal numbers
+func marshalCounts(c []int) []byte {
+	var buf []byte
+
+	for i, x := range c {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+
+		buf = strconv.AppendInt(buf, int64(x), 10)
+	}
+
+	return buf
+}
+
+// parse a space-separated list of exactly len(c) decimal numbers
+// into c.  Leave c unchanged on error.
+func unmarshalCounts(c []int, text []byte) error {
+	var tmp [64]int
+
+	fields := strings.Fields(string(text))
+	if len(fields) != len(c) {
+		return fmt.Errorf("pospop: expected %d counts, got %d", len(c), len(fields))
+	}
+
+	for i := range fields {
+		x, err := strconv.Atoi(fields[i])
+		if err != nil {
+			return fmt.Errorf("pospop: %w", err)
+		}
+
+		tmp[i] = x
+	}
+
+	copy(c, tmp[:])
+	return nil
+}
+
+// parse a JSON array of exactly len(c) numbers into c.  Leave c
+// unchanged on error.
+func unmarshalCountsJSON(c []int, data []byte) error {
+	var tmp []int
+
+	err := json.Unmarshal(data, &tmp)
+	if err != nil {
+		return err
+	}
+
+	if len(tmp) != len(c) {
+		return fmt.Errorf("pospop: expected %d counts, got %d", len(c), len(tmp))
+	}
+
+	copy(c, tmp)
+	return nil
+}
+
+// Counts8 holds the positional population count of a buffer of uint8.
+// See Count8 for the meaning of the counters.
+type Counts8 [8]int
+
+// Count the number of corresponding set bits of the values in buf
+// and add the results to c.  This is equivalent to Count8.
+func (c *Counts8) Count(buf []uint8) {
+	count8func((*[8]int)(c), buf)
+}
+
+// Add the counts in d to c, as if the buffer counted into d had been
+// counted into c, too.
+func (c *Counts8) Add(d *Counts8) {
+	addCounts(c[:], d[:])
+}
+
+// Subtract the counts in d from c.
+func (c *Counts8) Sub(d *Counts8) {
+	subCounts(c[:], d[:])
+}
+
+// Total returns the total number of set bits counted.
+func (c Counts8) Total() int {
+	return totalCounts(c[:])
+}
+
+// Zeros returns the number of clear bits in each position, given
+// that n elements were counted.
+func (c Counts8) Zeros(n int) Counts8 {
+	var z Counts8
+
+	zeroCounts(z[:], c[:], n)
+	return z
+}
+
+// Fractions returns the fraction of elements with each bit set, given
+// that n elements were counted.  If n is 0, all fractions are 0.
+func (c Counts8) Fractions(n int) [8]float64 {
+	var f [8]float64
+
+	fractionCounts(f[:], c[:], n)
+	return f
+}
+
+// String formats c like an array of 8 integers.
+func (c Counts8) String() string {
+	return "[" + string(marshalCounts(c[:])) + "]"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (c Counts8) MarshalText() ([]byte, error) {
+	return marshalCounts(c[:]), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (c *Counts8) UnmarshalText(text []byte) error {
+	return unmarshalCounts(c[:], text)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c Counts8) MarshalJSON() ([]byte, error) {
+	return json.Marshal([8]int(c))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *Counts8) UnmarshalJSON(data []byte) error {
+	return unmarshalCountsJSON(c[:], data)
+}
+
+// Counts16 holds the positional population count of a buffer of uint16.
+// See Count16 for the meaning of the counters.
+type Counts16 [16]int
+
+// Count the number of corresponding set bits of the values in buf
+// and add the results to c.  This is equivalent to Count16.
+func (c *Counts16) Count(buf []uint16) {
+	count16func((*[16]int)(c), buf)
+}
+
+// Add the counts in d to c, as if the buffer counted into d had been
+// counted into c, too.
+func (c *Counts16) Add(d *Counts16) {
+	addCounts(c[:], d[:])
+}
+
+// Subtract the counts in d from c.
+func (c *Counts16) Sub(d *Counts16) {
+	subCounts(c[:], d[:])
+}
+
+// Total returns the total number of set bits counted.
+func (c Counts16) Total() int {
+	return totalCounts(c[:])
+}
+
+// Zeros returns the number of clear bits in each position, given
+// that n elements were counted.
+func (c Counts16) Zeros(n int) Counts16 {
+	var z Counts16
+
+	zeroCounts(z[:], c[:], n)
+	return z
+}
+
+// Fractions returns the fraction of elements with each bit set, given
+// that n elements were counted.  If n is 0, all fractions are 0.
+func (c Counts16) Fractions(n int) [16]float64 {
+	var f [16]float64
+
+	fractionCounts(f[:], c[:], n)
+	return f
+}
+
+// String formats c like an array of 16 integers.
+func (c Counts16) String() string {
+	return "[" + string(marshalCounts(c[:])) + "]"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (c Counts16) MarshalText() ([]byte, error) {
+	return marshalCounts(c[:]), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (c *Counts16) UnmarshalText(text []byte) error {
+	return unmarshalCounts(c[:], text)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c Counts16) MarshalJSON() ([]byte, error) {
+	return json.Marshal([16]int(c))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *Counts16) UnmarshalJSON(data []byte) error {
+	return unmarshalCountsJSON(c[:], data)
+}
+
+// Counts32 holds the positional population count of a buffer of uint32.
+// See Count32 for the meaning of the counters.
+type Counts32 [32]int
+
+// Count the number of corresponding set bits of the values in buf
+// and add the results to c.  This is equivalent to Count32.
+func (c *Counts32) Count(buf []uint32) {
+	count32func((*[32]int)(c), buf)
+}
+
+// Add the counts in d to c, as if the buffer counted into d had been
+// counted into c, too.
+func (c *Counts32) Add(d *Counts32) {
+	addCounts(c[:], d[:])
+}
+
+// Subtract the counts in d from c.
+func (c *Counts32) Sub(d *Counts32) {
+	subCounts(c[:], d[:])
+}
+
+// Total returns the total number of set bits counted.
+func (c Counts32) Total() int {
+	return totalCounts(c[:])
+}
+
+// Zeros returns the number of clear bits in each position, given
+// that n elements were counted.
+func (c Counts32) Zeros(n int) Counts32 {
+	var z Counts32
+
+	zeroCounts(z[:], c[:], n)
+	return z
+}
+
+// Fractions returns the fraction of elements with each bit set, given
+// that n elements were counted.  If n is 0, all fractions are 0.
+func (c Counts32) Fractions(n int) [32]float64 {
+	var f [32]float64
+
+	fractionCounts(f[:], c[:], n)
+	return f
+}
+
+// String formats c like an array of 32 integers.
+func (c Counts32) String() string {
+	return "[" + string(marshalCounts(c[:])) + "]"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (c Counts32) MarshalText() ([]byte, error) {
+	return marshalCounts(c[:]), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (c *Counts32) UnmarshalText(text []byte) error {
+	return unmarshalCounts(c[:], text)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c Counts32) MarshalJSON() ([]byte, error) {
+	return json.Marshal([32]int(c))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *Counts32) UnmarshalJSON(data []byte) error {
+	return unmarshalCountsJSON(c[:], data)
+}
+
+// Counts64 holds the positional population count of a buffer of uint64.
+// See Count64 for the meaning of the counters.
+type Counts64 [64]int
+
+// Count the number of corresponding set bits of the values in buf
+// and add the results to c.  This is equivalent to Count64.
+func (c *Counts64) Count(buf []uint64) {
+	count64func((*[64]int)(c), buf)
+}
+
+// Add the counts in d to c, as if the buffer counted into d had been
+// counted into c, too.
+func (c *Counts64) Add(d *Counts64) {
+	addCounts(c[:], d[:])
+}
+
+// Subtract the counts in d from c.
+func (c *Counts64) Sub(d *Counts64) {
+	subCounts(c[:], d[:])
+}
+
+// Total returns the total number of set bits counted.
+func (c Counts64) Total() int {
+	return totalCounts(c[:])
+}
+
+// Zeros returns the number of clear bits in each position, given
+// that n elements were counted.
+func (c Counts64) Zeros(n int) Counts64 {
+	var z Counts64
+
+	zeroCounts(z[:], c[:], n)
+	return z
+}
+
+// Fractions returns the fraction of elements with each bit set, given
+// that n elements were counted.  If n is 0, all fractions are 0.
+func (c Counts64) Fractions(n int) [64]float64 {
+	var f [64]float64
+
+	fractionCounts(f[:], c[:], n)
+	return f
+}
+
+// String formats c like an array of 64 integers.
+func (c Counts64) String() string {
+	return "[" + string(marshalCounts(c[:])) + "]"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (c Counts64) MarshalText() ([]byte, error) {
+	return marshalCounts(c[:]), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (c *Counts64) UnmarshalText(text []byte) error {
+	return unmarshalCounts(c[:], text)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c Counts64) MarshalJSON() ([]byte, error) {
+	return json.Marshal([64]int(c))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *Counts64) UnmarshalJSON(data []byte) error {
+	return unmarshalCountsJSON(c[:], data)
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+// test the arithmetic methods of Counts64
+func TestCounts64(t *testing.T) {
+	buf := make([]uint64, 1000)
+	for i := range buf {
+		buf[i] = rand.Uint64()
+	}
+
+	var c, d Counts64
+	var ref [64]int
+	c.Count(buf[:400])
+	d.Count(buf[400:])
+	count64safe(&ref, buf)
+
+	c.Add(&d)
+	if [64]int(c) != ref {
+		t.Errorf("Add: counts don't match: %v\n", countDiff(c[:], ref[:]))
+	}
+
+	total := 0
+	for i := range ref {
+		total += ref[i]
+	}
+
+	if c.Total() != total {
+		t.Errorf("Total: got %d, expected %d", c.Total(), total)
+	}
+
+	z := c.Zeros(len(buf))
+	for i := range z {
+		if z[i]+c[i] != len(buf) {
+			t.Errorf("Zeros: z[%d] = %d does not match c[%d] = %d", i, z[i], i, c[i])
+		}
+	}
+
+	f := c.Fractions(len(buf))
+	for i := range f {
+		if f[i] != float64(c[i])/float64(len(buf)) {
+			t.Errorf("Fractions: f[%d] = %g does not match c[%d] = %d", i, f[i], i, c[i])
+		}
+	}
+
+	if f := (Counts64{1, 2}).Fractions(0); f != [64]float64{} {
+		t.Errorf("Fractions(0): got %v, expected all zeros", f)
+	}
+
+	c.Sub(&d)
+	ref = [64]int{}
+	count64safe(&ref, buf[:400])
+	if [64]int(c) != ref {
+		t.Errorf("Sub: counts don't match: %v\n", countDiff(c[:], ref[:]))
+	}
+}
+
+// test the formatting and marshalling methods of Counts8
+func TestCounts8Marshal(t *testing.T) {
+	c := Counts8{4, 3, 2, 1, 0, 0, 0, -1}
+
+	if s := c.String(); s != "[4 3 2 1 0 0 0 -1]" {
+		t.Errorf("String: got %q", s)
+	}
+
+	text, err := c.MarshalText()
+	if err != nil || string(text) != "4 3 2 1 0 0 0 -1" {
+		t.Errorf("MarshalText: got %q, %v", text, err)
+	}
+
+	var d Counts8
+	err = d.UnmarshalText(text)
+	if err != nil || d != c {
+		t.Errorf("UnmarshalText: got %v, %v", d, err)
+	}
+
+	err = d.UnmarshalText([]byte("1 2 3"))
+	if err == nil || d != c {
+		t.Errorf("UnmarshalText: short input accepted: %v, %v", d, err)
+	}
+
+	data, err := json.Marshal(&c)
+	if err != nil || string(data) != "[4,3,2,1,0,0,0,-1]" {
+		t.Errorf("MarshalJSON: got %q, %v", data, err)
+	}
+
+	d = Counts8{}
+	err = json.Unmarshal(data, &d)
+	if err != nil || d != c {
+		t.Errorf("UnmarshalJSON: got %v, %v", d, err)
+	}
+
+	err = json.Unmarshal([]byte("[1,2,3,4,5,6,7,8,9]"), &d)
+	if err == nil || d != c {
+		t.Errorf("UnmarshalJSON: long input accepted: %v, %v", d, err)
+	}
+}
@@ -508,3 +508,153 @@ TEXT ·count64sse2(SB), 0, $0-16
 	SHLL $3, BP			// count in bytes
 	CALL countsse<>(SB)
 	RET
+
+// zero-extend dwords in X to qwords and add to (a)*8(DI) to
+// (a+3)*8(DI), trashing X, X2, and X3.  Assumes X7 == 0.
+#define ACCUMDQ(a, X) \
+	MOVOA X, X2 \
+	PUNPCKLLQ X7, X \
+	PUNPCKHLQ X7, X2 \
+	MOVOU (a)*8(DI), X3 \
+	PADDQ X, X3 \
+	MOVOU X3, (a)*8(DI) \
+	MOVOU (a+2)*8(DI), X3 \
+	PADDQ X2, X3 \
+	MOVOU X3, (a+2)*8(DI)
+
+// zero-extend words in s*16(DX) to qwords and add to a*8(DI) to
+// (a+7)*8(DI).  Assumes X7 == 0 and trashes X0--X3.
+#define ACCUMOQ(a, s) \
+	MOVOA (s)*16(DX), X0 \
+	MOVOA X0, X1 \
+	PUNPCKLWL X7, X0 \
+	PUNPCKHWL X7, X1 \
+	ACCUMDQ(a, X0) \
+	ACCUMDQ(a+4, X1)
+
+// Count8 accumulation function.  Accumulates words into
+// 8 qword counters at (DI).  Trashes X0--X7.
+TEXT accum8u64<>(SB), NOSPLIT, $0-0
+	MOVOA 0*16(DX), X0
+	MOVOA 4*16(DX), X1
+	MOVOA 2*16(DX), X4
+	MOVOA 6*16(DX), X5
+	FOLDW(X0, X1)
+	FOLDW(X4, X5)
+	PADDL X4, X0
+	PADDL X5, X1
+	ACCUMDQ(0, X0)
+	ACCUMDQ(4, X1)
+	MOVOA 1*16(DX), X0
+	MOVOA 5*16(DX), X1
+	MOVOA 3*16(DX), X4
+	MOVOA 7*16(DX), X5
+	FOLDW(X0, X1)
+	FOLDW(X4, X5)
+	PADDL X4, X0
+	PADDL X5, X1
+	ACCUMDQ(0, X0)
+	ACCUMDQ(4, X1)
+	RET
+
+// Count16 accumulation function.  Accumulates words into
+// 16 qword counters at (DI).  Trashes X0--X7.
+TEXT accum16u64<>(SB), NOSPLIT, $0-0
+	MOVOA 0*16(DX), X0
+	MOVOA 4*16(DX), X1
+	MOVOA 2*16(DX), X4
+	MOVOA 6*16(DX), X5
+	FOLDW(X0, X1)
+	FOLDW(X4, X5)
+	PADDL X4, X0
+	PADDL X5, X1
+	ACCUMDQ(0, X0)
+	ACCUMDQ(4, X1)
+	MOVOA 1*16(DX), X0
+	MOVOA 5*16(DX), X1
+	MOVOA 3*16(DX), X4
+	MOVOA 7*16(DX), X5
+	FOLDW(X0, X1)
+	FOLDW(X4, X5)
+	PADDL X4, X0
+	PADDL X5, X1
+	ACCUMDQ(8, X0)
+	ACCUMDQ(12, X1)
+	RET
+
+// Count32 accumulation function.  Accumulates words into
+// 32 qword counters at (DI).  Trashes X0--X7.
+TEXT accum32u64<>(SB), NOSPLIT, $0-0
+	MOVOA 0*16(DX), X0
+	MOVOA 4*16(DX), X1
+	FOLDW(X0, X1)
+	ACCUMDQ(0, X0)
+	ACCUMDQ(4, X1)
+	MOVOA 1*16(DX), X0
+	MOVOA 5*16(DX), X1
+	FOLDW(X0, X1)
+	ACCUMDQ(8, X0)
+	ACCUMDQ(12, X1)
+	MOVOA 2*16(DX), X0
+	MOVOA 6*16(DX), X1
+	FOLDW(X0, X1)
+	ACCUMDQ(16, X0)
+	ACCUMDQ(20, X1)
+	MOVOA 3*16(DX), X0
+	MOVOA 7*16(DX), X1
+	FOLDW(X0, X1)
+	ACCUMDQ(24, X0)
+	ACCUMDQ(28, X1)
+	RET
+
+// Count64 accumulation function.  Accumulates words into
+// 64 qword counters at (DI).  Trashes X0--X3 and X7.
+TEXT accum64u64<>(SB), NOSPLIT, $0-0
+	ACCUMOQ( 0, 0)
+	ACCUMOQ( 8, 1)
+	ACCUMOQ(16, 2)
+	ACCUMOQ(24, 3)
+	ACCUMOQ(32, 4)
+	ACCUMOQ(40, 5)
+	ACCUMOQ(48, 6)
+	ACCUMOQ(56, 7)
+	RET
+
+// func count8sse2u64(counts *[8]uint64, buf []uint8)
+TEXT ·count8sse2u64(SB), 0, $0-16
+	MOVL counts+0(FP), DI
+	MOVL buf_base+4(FP), SI		// SI = &buf[0]
+	MOVL buf_len+8(FP), BP		// BP = len(buf)
+	MOVL $accum8u64<>(SB), BX
+	CALL countsse<>(SB)
+	RET
+
+// func count16sse2u64(counts *[16]uint64, buf []uint16)
+TEXT ·count16sse2u64(SB), 0, $0-16
+	MOVL counts+0(FP), DI
+	MOVL buf_base+4(FP), SI		// SI = &buf[0]
+	MOVL buf_len+8(FP), BP		// BP = len(buf)
+	MOVL $accum16u64<>(SB), BX
+	SHLL $1, BP			// count in bytes
+	CALL countsse<>(SB)
+	RET
+
+// func count32sse2u64(counts *[32]uint64, buf []uint32)
+TEXT ·count32sse2u64(SB), 0, $0-16
+	MOVL counts+0(FP), DI
+	MOVL buf_base+4(FP), SI		// SI = &buf[0]
+	MOVL buf_len+8(FP), BP		// BP = len(buf)
+	MOVL $accum32u64<>(SB), BX
+	SHLL $2, BP			// count in bytes
+	CALL countsse<>(SB)
+	RET
+
+// func count64sse2u64(counts *[64]uint64, buf []uint64)
+TEXT ·count64sse2u64(SB), 0, $0-16
+	MOVL counts+0(FP), DI
+	MOVL buf_base+4(FP), SI		// SI = &buf[0]
+	MOVL buf_len+8(FP), BP		// BP = len(buf)
+	MOVL $accum64u64<>(SB), BX
+	SHLL $3, BP			// count in bytes
+	CALL countsse<>(SB)
+	RET
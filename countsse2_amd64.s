@@ -1,4 +1,5 @@
 #include "textflag.h"
+#include "go_asm.h"
 
 // An SSE2 based kernel first doing a 15-fold CSA reduction and then
 // a 16-fold CSA reduction, carrying over place-value vectors between
@@ -634,3 +635,841 @@ TEXT ·count64sse2(SB), 0, $0-32
 	SHLQ $3, CX			// count in bytes
 	CALL countsse2<>(SB)
 	RET
+
+// add dwords in X to a*4(DI) to (a+3)*4(DI), trashing X5.
+#define ACCUMD(a, X) \
+	MOVOU (a)*4(DI), X5 \
+	PADDL X, X5 \
+	MOVOU X5, (a)*4(DI)
+
+// zero-extend words in X to dwords and add to a*4(DI) to (a+7)*4(DI).
+// Trashes X5 and X6.  Assumes X7 == 0 an X8 <= X <= X15.
+#define ACCUMOD(a, X) \
+	MOVOA X, X6 \
+	PUNPCKLWL X7, X6 \
+	PUNPCKHWL X7, X \
+	ACCUMD(a, X6) \
+	ACCUMD(a+4, X)
+
+// Count8 accumulation function.  Accumulates words X8--X15 into
+// 8 dword counters at (DI).  Assumes X7 == 0.  Trashes X4--X15.
+TEXT accum8u32<>(SB), NOSPLIT, $0-0
+	FOLDW(X8, X12)
+	FOLDW(X9, X13)
+	FOLDW(X10, X14)
+	FOLDW(X11, X15)
+	PADDL X10, X8
+	PADDL X11, X9
+	PADDL X14, X12
+	PADDL X15, X13
+	PADDL X9, X8
+	ACCUMD(0, X8)
+	PADDL X13, X12
+	ACCUMD(4, X12)
+	RET
+
+// Count16 accumulation function.  Accumulates words X8--X15 into
+// 16 dword counters at (DI).  Assumes X7 == 0.  Trashes X4--X15.
+TEXT accum16u32<>(SB), NOSPLIT, $0-0
+	FOLDW(X8, X12)
+	FOLDW(X9, X13)
+	FOLDW(X10, X14)
+	FOLDW(X11, X15)
+	PADDL X10, X8
+	ACCUMD(0, X8)
+	PADDL X14, X12
+	ACCUMD(4, X12)
+	PADDL X11, X9
+	ACCUMD(8, X9)
+	PADDL X15, X13
+	ACCUMD(12, X13)
+	RET
+
+// Count32 accumulation function.  Accumulates words X8--X15 into
+// 32 dword counters at (DI).  Assumes X7 == 0.  Trashes X4--X15.
+TEXT accum32u32<>(SB), NOSPLIT, $0-0
+	FOLDW(X8, X12)
+	ACCUMD(0, X8)
+	ACCUMD(4, X12)
+	FOLDW(X9, X13)
+	ACCUMD(8, X9)
+	ACCUMD(12, X13)
+	FOLDW(X10, X14)
+	ACCUMD(16, X10)
+	ACCUMD(20, X14)
+	FOLDW(X11, X15)
+	ACCUMD(24, X11)
+	ACCUMD(28, X15)
+	RET
+
+// Count64 accumulation function.  Accumulates words X8--X15 into
+// 64 dword counters at (DI).  Assumes X7 == 0.  Trashes X4--X15.
+TEXT accum64u32<>(SB), NOSPLIT, $0-0
+	ACCUMOD(0, X8)
+	ACCUMOD(8, X9)
+	ACCUMOD(16, X10)
+	ACCUMOD(24, X11)
+	ACCUMOD(32, X12)
+	ACCUMOD(40, X13)
+	ACCUMOD(48, X14)
+	ACCUMOD(56, X15)
+	RET
+
+// func count8sse2u32(counts *[8]uint32, buf []uint8)
+TEXT ·count8sse2u32(SB), 0, $0-32
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum8u32<>(SB), BX
+	CALL countsse2<>(SB)
+	RET
+
+// func count16sse2u32(counts *[16]uint32, buf []uint16)
+TEXT ·count16sse2u32(SB), 0, $0-32
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum16u32<>(SB), BX
+	SHLQ $1, CX			// count in bytes
+	CALL countsse2<>(SB)
+	RET
+
+// func count32sse2u32(counts *[32]uint32, buf []uint32)
+TEXT ·count32sse2u32(SB), 0, $0-32
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum32u32<>(SB), BX
+	SHLQ $2, CX			// count in bytes
+	CALL countsse2<>(SB)
+	RET
+
+// func count64sse2u32(counts *[64]uint32, buf []uint64)
+TEXT ·count64sse2u32(SB), 0, $0-32
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum64u32<>(SB), BX
+	SHLQ $3, CX			// count in bytes
+	CALL countsse2<>(SB)
+	RET
+
+// Fused kernels counting a[i] op b[i] for the bitwise operations op.
+// The input buffers a and b are in SI and R8.
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	ADDQ $(n), R8
+
+#define KERNEL countandsse2<>
+#define LOAD(k, X) \
+	MOVOU (k)*16(R8), X \
+	MOVOU (k)*16(SI), X10 \
+	PAND X10, X
+#define LOADQ(R) \
+	MOVQ (R8), R \
+	ANDQ (SI), R \
+	ADVANCE(8)
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL countorsse2<>
+#define LOAD(k, X) \
+	MOVOU (k)*16(R8), X \
+	MOVOU (k)*16(SI), X10 \
+	POR X10, X
+#define LOADQ(R) \
+	MOVQ (R8), R \
+	ORQ (SI), R \
+	ADVANCE(8)
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL countxorsse2<>
+#define LOAD(k, X) \
+	MOVOU (k)*16(R8), X \
+	MOVOU (k)*16(SI), X10 \
+	PXOR X10, X
+#define LOADQ(R) \
+	MOVQ (R8), R \
+	XORQ (SI), R \
+	ADVANCE(8)
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+// a &^ b = ~b & a
+#define KERNEL countandnotsse2<>
+#define LOAD(k, X) \
+	MOVOU (k)*16(R8), X \
+	MOVOU (k)*16(SI), X10 \
+	PANDN X10, X
+#define LOADQ(R) \
+	MOVQ (R8), R11 \
+	NOTQ R11 \
+	MOVQ (SI), R \
+	ANDQ R11, R \
+	ADVANCE(8)
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+// Call the fused kernel for the bitwise operation in DX.
+TEXT binopsse2<>(SB), NOSPLIT, $0-0
+	CMPQ DX, $const_opOr
+	JEQ or
+	CMPQ DX, $const_opXor
+	JEQ xor
+	CMPQ DX, $const_opAndNot
+	JEQ andnot
+	JMP countandsse2<>(SB)
+or:	JMP countorsse2<>(SB)
+xor:	JMP countxorsse2<>(SB)
+andnot:	JMP countandnotsse2<>(SB)
+
+// func count8sse2binop(counts *[8]int, a, b []uint8, op binop)
+TEXT ·count8sse2binop(SB), 0, $0-64
+	MOVQ counts+0(FP), DI
+	MOVQ a_base+8(FP), SI		// SI = &a[0]
+	MOVQ a_len+16(FP), CX		// CX = len(a)
+	MOVQ b_base+32(FP), R8		// R8 = &b[0]
+	MOVQ op+56(FP), DX
+	MOVQ $accum8<>(SB), BX
+	CALL binopsse2<>(SB)
+	RET
+
+// func count16sse2binop(counts *[16]int, a, b []uint16, op binop)
+TEXT ·count16sse2binop(SB), 0, $0-64
+	MOVQ counts+0(FP), DI
+	MOVQ a_base+8(FP), SI		// SI = &a[0]
+	MOVQ a_len+16(FP), CX		// CX = len(a)
+	MOVQ b_base+32(FP), R8		// R8 = &b[0]
+	MOVQ op+56(FP), DX
+	MOVQ $accum16<>(SB), BX
+	SHLQ $1, CX			// count in bytes
+	CALL binopsse2<>(SB)
+	RET
+
+// func count32sse2binop(counts *[32]int, a, b []uint32, op binop)
+TEXT ·count32sse2binop(SB), 0, $0-64
+	MOVQ counts+0(FP), DI
+	MOVQ a_base+8(FP), SI		// SI = &a[0]
+	MOVQ a_len+16(FP), CX		// CX = len(a)
+	MOVQ b_base+32(FP), R8		// R8 = &b[0]
+	MOVQ op+56(FP), DX
+	MOVQ $accum32<>(SB), BX
+	SHLQ $2, CX			// count in bytes
+	CALL binopsse2<>(SB)
+	RET
+
+// func count64sse2binop(counts *[64]int, a, b []uint64, op binop)
+TEXT ·count64sse2binop(SB), 0, $0-64
+	MOVQ counts+0(FP), DI
+	MOVQ a_base+8(FP), SI		// SI = &a[0]
+	MOVQ a_len+16(FP), CX		// CX = len(a)
+	MOVQ b_base+32(FP), R8		// R8 = &b[0]
+	MOVQ op+56(FP), DX
+	MOVQ $accum64<>(SB), BX
+	SHLQ $3, CX			// count in bytes
+	CALL binopsse2<>(SB)
+	RET
+
+// Fused kernels counting the elements of buf whose bits are set in
+// the validity bitmap valid, zeroing the others as they are loaded.
+// The buffer is in SI, the bitmap in R9.  The vector loads broadcast
+// the bits of the bitmap for each vector to all lanes, pick one bit
+// per lane, and compare to obtain the lane mask, using X as a
+// temporary for the constant.  The tail is handled by the macros from
+// countmasked_amd64.h.
+#include "countmasked_amd64.h"
+
+// bit of each lane for 8, 16, 32, and 64 bit lanes
+DATA maskbits<>+  0(SB)/8, $0x8040201008040201
+DATA maskbits<>+  8(SB)/8, $0x8040201008040201
+DATA maskbits<>+ 16(SB)/8, $0x0008000400020001
+DATA maskbits<>+ 24(SB)/8, $0x0080004000200010
+DATA maskbits<>+ 32(SB)/8, $0x0000000200000001	// low nibble
+DATA maskbits<>+ 40(SB)/8, $0x0000000800000004
+DATA maskbits<>+ 48(SB)/8, $0x0000002000000010	// high nibble
+DATA maskbits<>+ 56(SB)/8, $0x0000008000000040
+DATA maskbits<>+ 64(SB)/8, $0x0000000100000001	// crumb 0
+DATA maskbits<>+ 72(SB)/8, $0x0000000200000002
+DATA maskbits<>+ 80(SB)/8, $0x0000000400000004	// crumb 1
+DATA maskbits<>+ 88(SB)/8, $0x0000000800000008
+DATA maskbits<>+ 96(SB)/8, $0x0000001000000010	// crumb 2
+DATA maskbits<>+104(SB)/8, $0x0000002000000020
+DATA maskbits<>+112(SB)/8, $0x0000004000000040	// crumb 3
+DATA maskbits<>+120(SB)/8, $0x0000008000000080
+GLOBL maskbits<>(SB), RODATA|NOPTR, $128
+
+// spread the 2 bytes of the bitmap to the 8 byte groups of the vector
+#define KERNEL countmasked8sse2<>
+#define LOAD(k, X) \
+	MOVWLZX (k)*2(R9), R11 \
+	MOVL R11, X10 \
+	PUNPCKLBW X10, X10 \
+	PUNPCKLWL X10, X10 \
+	PUNPCKLLQ X10, X10 \
+	MOVOU maskbits<>+0(SB), X \
+	PAND X, X10 \
+	PCMPEQB X, X10 \
+	MOVOU (k)*16(SI), X \
+	PAND X10, X
+#define LOADQ(R) MASKEDQ8(R)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	ADDQ $(n)/8, R9
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+#define KERNEL countmasked16sse2<>
+#define LOAD(k, X) \
+	MOVBLZX (k)(R9), R11 \
+	IMUL3L $0x01010101, R11, R11 \
+	MOVL R11, X10 \
+	PSHUFD $0x00, X10, X10 \
+	MOVOU maskbits<>+16(SB), X \
+	PAND X, X10 \
+	PCMPEQW X, X10 \
+	MOVOU (k)*16(SI), X \
+	PAND X10, X
+#define LOADQ(R) MASKEDQ16(R)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	ADDQ $(n)/16, R9
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+// each vector takes one nibble of the bitmap
+#define KERNEL countmasked32sse2<>
+#define LOAD(k, X) \
+	MOVBLZX (k)/2(R9), R11 \
+	MOVL R11, X10 \
+	PSHUFD $0x00, X10, X10 \
+	MOVOU maskbits<>+32+((k)&1)*16(SB), X \
+	PAND X, X10 \
+	PCMPEQL X, X10 \
+	MOVOU (k)*16(SI), X \
+	PAND X10, X
+#define LOADQ(R) MASKEDQ32(R)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	ADDQ $(n)/32, R9
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+// each vector takes one crumb of the bitmap; SSE2 lacks PCMPEQQ, so
+// both dwords of each qword test the same bit
+#define KERNEL countmasked64sse2<>
+#define LOAD(k, X) \
+	MOVBLZX (k)/4(R9), R11 \
+	MOVL R11, X10 \
+	PSHUFD $0x00, X10, X10 \
+	MOVOU maskbits<>+64+((k)&3)*16(SB), X \
+	PAND X, X10 \
+	PCMPEQL X, X10 \
+	MOVOU (k)*16(SI), X \
+	PAND X10, X
+#define LOADQ(R) MASKEDQ64(R)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	ADDQ $(n)/64, R9
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+// func count8sse2masked(counts *[8]int, buf []uint8, valid []byte)
+TEXT ·count8sse2masked(SB), 0, $0-56
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ valid_base+32(FP), R9	// R9 = &valid[0]
+	XORL R12, R12			// R12 = bit index into the tail of valid
+	MOVQ $accum8<>(SB), BX
+	CALL countmasked8sse2<>(SB)
+	RET
+
+// func count16sse2masked(counts *[16]int, buf []uint16, valid []byte)
+TEXT ·count16sse2masked(SB), 0, $0-56
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ valid_base+32(FP), R9	// R9 = &valid[0]
+	XORL R12, R12			// R12 = bit index into the tail of valid
+	MOVQ $accum16<>(SB), BX
+	SHLQ $1, CX			// count in bytes
+	CALL countmasked16sse2<>(SB)
+	RET
+
+// func count32sse2masked(counts *[32]int, buf []uint32, valid []byte)
+TEXT ·count32sse2masked(SB), 0, $0-56
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ valid_base+32(FP), R9	// R9 = &valid[0]
+	XORL R12, R12			// R12 = bit index into the tail of valid
+	MOVQ $accum32<>(SB), BX
+	SHLQ $2, CX			// count in bytes
+	CALL countmasked32sse2<>(SB)
+	RET
+
+// func count64sse2masked(counts *[64]int, buf []uint64, valid []byte)
+TEXT ·count64sse2masked(SB), 0, $0-56
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ valid_base+32(FP), R9	// R9 = &valid[0]
+	XORL R12, R12			// R12 = bit index into the tail of valid
+	MOVQ $accum64<>(SB), BX
+	SHLQ $3, CX			// count in bytes
+	CALL countmasked64sse2<>(SB)
+	RET
+
+// Fused kernels counting the highest (lz) or lowest (tz) set bit of
+// each element of buf, from which the histograms of leading and
+// trailing zeros follow.  The buffer is in SI.  The tail is handled by
+// the macros from countonehot_amd64.h.
+#include "countonehot_amd64.h"
+
+// lane masks for smearing bytes with word shifts; 16 byte aligned as
+// the linker aligns symbols of this size to at least 16 bytes
+DATA onehot<>+ 0(SB)/8, $0x7f7f7f7f7f7f7f7f
+DATA onehot<>+ 8(SB)/8, $0x7f7f7f7f7f7f7f7f
+DATA onehot<>+16(SB)/8, $0x3f3f3f3f3f3f3f3f
+DATA onehot<>+24(SB)/8, $0x3f3f3f3f3f3f3f3f
+DATA onehot<>+32(SB)/8, $0x0f0f0f0f0f0f0f0f
+DATA onehot<>+40(SB)/8, $0x0f0f0f0f0f0f0f0f
+GLOBL onehot<>(SB), RODATA|NOPTR, $48
+
+#define ADVANCE(n) \
+	ADDQ $(n), SI
+
+#define KERNEL countlz8sse2<>
+#define LOAD(k, X) \
+	MOVOU (k)*16(SI), X \
+	MOVOA X, X10 \
+	PSRLW $1, X10 \
+	PAND onehot<>+0(SB), X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLW $2, X10 \
+	PAND onehot<>+16(SB), X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLW $4, X10 \
+	PAND onehot<>+32(SB), X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLW $1, X10 \
+	PAND onehot<>+0(SB), X10 \
+	PXOR X10, X
+#define LOADQ(R) HIGHESTQ8(R)
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL counttz8sse2<>
+#define LOAD(k, X) \
+	MOVOU (k)*16(SI), X \
+	PXOR X10, X10 \
+	PSUBB X, X10 \
+	PAND X10, X
+#define LOADQ(R) LOWESTQ8(R)
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL countlz16sse2<>
+#define LOAD(k, X) \
+	MOVOU (k)*16(SI), X \
+	MOVOA X, X10 \
+	PSRLW $1, X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLW $2, X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLW $4, X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLW $8, X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLW $1, X10 \
+	PXOR X10, X
+#define LOADQ(R) HIGHESTQ16(R)
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL counttz16sse2<>
+#define LOAD(k, X) \
+	MOVOU (k)*16(SI), X \
+	PXOR X10, X10 \
+	PSUBW X, X10 \
+	PAND X10, X
+#define LOADQ(R) LOWESTQ16(R)
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL countlz32sse2<>
+#define LOAD(k, X) \
+	MOVOU (k)*16(SI), X \
+	MOVOA X, X10 \
+	PSRLL $1, X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLL $2, X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLL $4, X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLL $8, X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLL $16, X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLL $1, X10 \
+	PXOR X10, X
+#define LOADQ(R) HIGHESTQ32(R)
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL counttz32sse2<>
+#define LOAD(k, X) \
+	MOVOU (k)*16(SI), X \
+	PXOR X10, X10 \
+	PSUBL X, X10 \
+	PAND X10, X
+#define LOADQ(R) LOWESTQ32(R)
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL countlz64sse2<>
+#define LOAD(k, X) \
+	MOVOU (k)*16(SI), X \
+	MOVOA X, X10 \
+	PSRLQ $1, X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLQ $2, X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLQ $4, X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLQ $8, X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLQ $16, X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLQ $32, X10 \
+	POR X10, X \
+	MOVOA X, X10 \
+	PSRLQ $1, X10 \
+	PXOR X10, X
+#define LOADQ(R) HIGHESTQ64(R)
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#define KERNEL counttz64sse2<>
+#define LOAD(k, X) \
+	MOVOU (k)*16(SI), X \
+	PXOR X10, X10 \
+	PSUBQ X, X10 \
+	PAND X10, X
+#define LOADQ(R) LOWESTQ64(R)
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+
+#undef ADVANCE
+
+// func count8sse2onehot(counts *[8]int, buf []uint8, leading bool)
+TEXT ·count8sse2onehot(SB), 0, $0-33
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum8<>(SB), BX
+	CMPB leading+32(FP), $0
+	JNE lz
+	CALL counttz8sse2<>(SB)
+	RET
+
+lz:	CALL countlz8sse2<>(SB)
+	RET
+
+// func count16sse2onehot(counts *[16]int, buf []uint16, leading bool)
+TEXT ·count16sse2onehot(SB), 0, $0-33
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum16<>(SB), BX
+	SHLQ $1, CX			// count in bytes
+	CMPB leading+32(FP), $0
+	JNE lz
+	CALL counttz16sse2<>(SB)
+	RET
+
+lz:	CALL countlz16sse2<>(SB)
+	RET
+
+// func count32sse2onehot(counts *[32]int, buf []uint32, leading bool)
+TEXT ·count32sse2onehot(SB), 0, $0-33
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum32<>(SB), BX
+	SHLQ $2, CX			// count in bytes
+	CMPB leading+32(FP), $0
+	JNE lz
+	CALL counttz32sse2<>(SB)
+	RET
+
+lz:	CALL countlz32sse2<>(SB)
+	RET
+
+// func count64sse2onehot(counts *[64]int, buf []uint64, leading bool)
+TEXT ·count64sse2onehot(SB), 0, $0-33
+	MOVQ counts+0(FP), DI
+	MOVQ buf_base+8(FP), SI		// SI = &buf[0]
+	MOVQ buf_len+16(FP), CX		// CX = len(buf)
+	MOVQ $accum64<>(SB), BX
+	SHLQ $3, CX			// count in bytes
+	CMPB leading+32(FP), $0
+	JNE lz
+	CALL counttz64sse2<>(SB)
+	RET
+
+lz:	CALL countlz64sse2<>(SB)
+	RET
+
+// Segmented counting.  The buffer in SI is split into segments of R8
+// bytes each, which are counted with a fused kernel using plain loads
+// into consecutive counter arrays at DI, flushing the accumulators at
+// the end of each segment.  As the kernel has no head processing, the
+// segments need not be aligned.
+
+#define KERNEL countsegsse2<>
+#define LOAD(k, X) \
+	MOVOU (k)*16(SI), X
+#define LOADQ(R) \
+	MOVQ (SI), R \
+	ADDQ $8, SI
+#define ADVANCE(n) \
+	ADDQ $(n), SI
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+// Count DX bytes at SI in segments of R8 bytes each into consecutive
+// counter arrays of R9 bytes each at DI.  DX must be a multiple of R8
+// and R8 a multiple of 8.
+TEXT segmentssse2<>(SB), NOSPLIT, $0-0
+	SUBQ R8, DX
+	JLT end
+
+loop:	MOVQ R8, CX
+	CALL countsegsse2<>(SB)
+	ADDQ R9, DI			// advance to the next counter array
+	SUBQ R8, DX
+	JGE loop
+
+end:	RET
+
+// func count8sse2segments(out [][8]int, buf []uint8, segLen int)
+TEXT ·count8sse2segments(SB), 0, $0-56
+	MOVQ out_base+0(FP), DI
+	MOVQ buf_base+24(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+32(FP), DX		// DX = len(buf)
+	MOVQ segLen+48(FP), R8		// R8 = segLen
+	MOVQ $8*8, R9			// size of a counter array
+	MOVQ $accum8<>(SB), BX
+	CALL segmentssse2<>(SB)
+	RET
+
+// func count16sse2segments(out [][16]int, buf []uint16, segLen int)
+TEXT ·count16sse2segments(SB), 0, $0-56
+	MOVQ out_base+0(FP), DI
+	MOVQ buf_base+24(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+32(FP), DX		// DX = len(buf)
+	MOVQ segLen+48(FP), R8		// R8 = segLen
+	MOVQ $16*8, R9			// size of a counter array
+	MOVQ $accum16<>(SB), BX
+	SHLQ $1, DX			// count in bytes
+	SHLQ $1, R8
+	CALL segmentssse2<>(SB)
+	RET
+
+// func count32sse2segments(out [][32]int, buf []uint32, segLen int)
+TEXT ·count32sse2segments(SB), 0, $0-56
+	MOVQ out_base+0(FP), DI
+	MOVQ buf_base+24(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+32(FP), DX		// DX = len(buf)
+	MOVQ segLen+48(FP), R8		// R8 = segLen
+	MOVQ $32*8, R9			// size of a counter array
+	MOVQ $accum32<>(SB), BX
+	SHLQ $2, DX			// count in bytes
+	SHLQ $2, R8
+	CALL segmentssse2<>(SB)
+	RET
+
+// func count64sse2segments(out [][64]int, buf []uint64, segLen int)
+TEXT ·count64sse2segments(SB), 0, $0-56
+	MOVQ out_base+0(FP), DI
+	MOVQ buf_base+24(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+32(FP), DX		// DX = len(buf)
+	MOVQ segLen+48(FP), R8		// R8 = segLen
+	MOVQ $64*8, R9			// size of a counter array
+	MOVQ $accum64<>(SB), BX
+	SHLQ $3, DX			// count in bytes
+	SHLQ $3, R8
+	CALL segmentssse2<>(SB)
+	RET
+
+// Fused kernels computing the popcount histogram of buf alongside the
+// positional counts.  The buffer is in SI and the histogram in R9.
+// Each block is histogrammed by the helpers from counthist_amd64.h as
+// the input stream is advanced past it.
+#include "counthist_amd64.h"
+
+#define KERNEL counthist8sse2<>
+#define LOAD(k, X) \
+	MOVOU (k)*16(SI), X
+#define LOADQ(R) \
+	MOVQ (SI), R \
+	ADVANCE(8)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	MOVQ $-(n), R11 \
+	CALL hist8<>(SB)
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+#define KERNEL counthist16sse2<>
+#define LOAD(k, X) \
+	MOVOU (k)*16(SI), X
+#define LOADQ(R) \
+	MOVQ (SI), R \
+	ADVANCE(8)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	MOVQ $-(n), R11 \
+	CALL hist16<>(SB)
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+#define KERNEL counthist32sse2<>
+#define LOAD(k, X) \
+	MOVOU (k)*16(SI), X
+#define LOADQ(R) \
+	MOVQ (SI), R \
+	ADVANCE(8)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	MOVQ $-(n), R11 \
+	CALL hist32<>(SB)
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+#define KERNEL counthist64sse2<>
+#define LOAD(k, X) \
+	MOVOU (k)*16(SI), X
+#define LOADQ(R) \
+	MOVQ (SI), R \
+	ADVANCE(8)
+#define ADVANCE(n) \
+	ADDQ $(n), SI \
+	MOVQ $-(n), R11 \
+	CALL hist64<>(SB)
+#include "countsse2fused_amd64.h"
+#undef KERNEL
+#undef LOAD
+#undef LOADQ
+#undef ADVANCE
+
+// func count8sse2hist(counts *[8]int, hist *[9]int, buf []uint8)
+TEXT ·count8sse2hist(SB), 0, $0-40
+	MOVQ counts+0(FP), DI
+	MOVQ hist+8(FP), R9
+	MOVQ buf_base+16(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+24(FP), CX		// CX = len(buf)
+	MOVQ $accum8<>(SB), BX
+	CALL counthist8sse2<>(SB)
+	RET
+
+// func count16sse2hist(counts *[16]int, hist *[17]int, buf []uint16)
+TEXT ·count16sse2hist(SB), 0, $0-40
+	MOVQ counts+0(FP), DI
+	MOVQ hist+8(FP), R9
+	MOVQ buf_base+16(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+24(FP), CX		// CX = len(buf)
+	MOVQ $accum16<>(SB), BX
+	SHLQ $1, CX			// count in bytes
+	CALL counthist16sse2<>(SB)
+	RET
+
+// func count32sse2hist(counts *[32]int, hist *[33]int, buf []uint32)
+TEXT ·count32sse2hist(SB), 0, $0-40
+	MOVQ counts+0(FP), DI
+	MOVQ hist+8(FP), R9
+	MOVQ buf_base+16(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+24(FP), CX		// CX = len(buf)
+	MOVQ $accum32<>(SB), BX
+	SHLQ $2, CX			// count in bytes
+	CALL counthist32sse2<>(SB)
+	RET
+
+// func count64sse2hist(counts *[64]int, hist *[65]int, buf []uint64)
+TEXT ·count64sse2hist(SB), 0, $0-40
+	MOVQ counts+0(FP), DI
+	MOVQ hist+8(FP), R9
+	MOVQ buf_base+16(FP), SI	// SI = &buf[0]
+	MOVQ buf_len+24(FP), CX		// CX = len(buf)
+	MOVQ $accum64<>(SB), BX
+	SHLQ $3, CX			// count in bytes
+	CALL counthist64sse2<>(SB)
+	RET
@@ -0,0 +1,336 @@
+// Fused SSE2 kernel template.  A fused kernel works like countsse2<>,
+// but computes each vector from one or more input streams as it loads
+// it, e.g. by combining two buffers with a bitwise operation.  As the
+// input streams may differ in alignment, all loads are unaligned and
+// there is no head processing.  Before including this file, define
+//
+//     KERNEL      the name of the kernel
+//     LOAD(k, X)  load the k-th 16 byte vector of the current block
+//                 into X, trashing at most X10 and R11
+//     LOADQ(R)    load the next 8 bytes into R and advance the input
+//                 streams, trashing at most R11 and R13
+//     ADVANCE(n)  advance the input streams by n bytes, trashing at
+//                 most R11 and R13
+//
+// This function expects a pointer to a width-specific accumulation
+// function in BX, counters in DI and the remaining length in CX.  The
+// length must be a multiple of 8 bytes.
+TEXT KERNEL(SB), NOSPLIT, $48-0
+	PXOR X0, X0			// initialise place-value vectors
+	PXOR X1, X1
+	PXOR X2, X2
+	PXOR X3, X3
+	PXOR X8, X8			// initialise counters
+	PXOR X9, X9
+	PXOR X10, X10
+	PXOR X11, X11
+	PXOR X12, X12
+	PXOR X13, X13
+	PXOR X14, X14
+	PXOR X15, X15
+
+	SUBQ $16*16, CX			// enough data left to process?
+	JLT endvec
+
+	MOVL $65535, AX			// space left til overflow could occur in X8--X15
+
+	// load 256 bytes, add them to X0..X3 into X0..X4
+vec:	MOVOU X8, X8save-48(SP)		// stash some counters to give us
+	MOVOU X9, X9save-32(SP)		// more registers to play with
+	MOVOU X10, X10save-16(SP)
+	LOAD(0, X4)
+	LOAD(1, X5)
+	LOAD(2, X6)
+	LOAD(3, X7)
+	LOAD(4, X8)
+	LOAD(5, X9)
+	CSA(X0, X5, X4)
+	LOAD(6, X4)
+	CSA(X6, X8, X7)
+	LOAD(7, X7)
+	CSA(X1, X8, X5)
+	LOAD(8, X5)
+	CSA(X0, X6, X9)
+	LOAD(9, X9)
+	CSA(X4, X5, X7)
+	LOAD(10, X7)
+	CSA(X1, X5, X6)
+	LOAD(11, X6)
+	CSA(X0, X4, X9)
+	LOAD(12, X9)
+	CSA(X2, X5, X8)
+	LOAD(13, X8)
+	CSA(X0, X6, X7)
+	LOAD(14, X7)
+	CSA(X1, X4, X6)
+	LOAD(15, X6)
+	CSA(X7, X8, X9)
+	MOVOU magic<>+8(SB), X9		// 55555555, aaaaaaaa, 33333333, cccccccc
+	CSA(X0, X6, X7)
+	ADVANCE(16*16)
+	CSA(X1, X6, X8)
+	CSA(X2, X4, X6)
+	CSA(X3, X4, X5)
+	MOVOU X10save-16(SP), X10
+
+	MOVQ magic<>+24(SB), X8		// 0f0f0f0f, 00ff00ff
+
+	// now X0..X4 hold counters; preserve X0..X4 for the next round
+	// and add X4 to the the counters.
+
+	// split into even/odd and reduce into crumbs
+	PSHUFD $0x00, X9, X7		// X7 = 55..55
+	MOVOA X4, X5
+	PAND X7, X5			// X5 = 02468ace x8
+	PANDN X4, X7			// X7 = 13579bdf x8
+	PSRLL $1, X7
+	MOVOA X5, X4
+	PUNPCKLQDQ X7, X4
+	PUNPCKHQDQ X7, X5
+	PADDL X5, X4			// X4 = 02468ace x4 13579bdf x4
+
+	// split again into nibbles
+	PSHUFD $0xaa, X9, X5		// X7 = 33..33
+	MOVOA X5, X7
+	PANDN X4, X5			// X5 = 26ae x4 37bf x4
+	PAND X7, X4			// X4 = 048c x4 159d x4
+	PSRLL $2, X5
+
+	// split into bytes and shuffle into order
+	PSHUFD $0x00, X8, X6		// X6 = 0f..0f
+	MOVOA X6, X7
+	PANDN X4, X6			// X6 = 4c x4 5d x4
+	PAND X7, X4			// X4 = 08 x4 19 x4
+	MOVOA X7, X9
+	PANDN X5, X7			// X7 = 6e x4 7f x4
+	PAND X9, X5			// X5 = 2a x4 3b x4
+	PSLLL $4, X4
+	PSLLL $4, X5
+
+	MOVOA X4, X9
+	PUNPCKLWL X5, X4		// X4 = 082a x4
+	PUNPCKHWL X5, X9		// X9 = 193b x4
+	MOVOA X6, X5
+	PUNPCKLWL X7, X5		// X5 = 4c6e x4
+	PUNPCKHWL X7, X6		// X6 = 5d7f x4
+	MOVOA X4, X7
+	PUNPCKLWL X9, X4		// X4 = 08192a3b[0:1]
+	PUNPCKHWL X9, X7		// X7 = 08192a3b[2:3]
+	MOVOA X5, X9
+	PUNPCKLWL X6, X5		// X5 = 4c5d6e7f[0:1]
+	PUNPCKHWL X6, X9		// X9 = 4c5d6e7f[2:3]
+	MOVOA X4, X6
+	PUNPCKLQDQ X5, X4		// X4 = 08192a3b4c5d6e7f[0]
+	PUNPCKHQDQ X5, X6		// X6 = 08192a3b4c5d6e7f[1]
+	MOVOA X7, X5
+	PUNPCKLQDQ X9, X5		// X5 = 08192a3b4c5d6e7f[2]
+	PUNPCKHQDQ X9, X7		// X7 = 08192a3b4c5d6e7f[3]
+
+	// split into words and add to counters
+	PSHUFD $0x55, X8, X8		// X8 = 00ff..00ff
+	MOVOA X6, X9
+	PAND X8, X6			// X6 = 01234678[1]
+	PSRLW $8, X9			// X9 = 89abcdef[1]
+	PADDW X6, X10
+	PADDW X9, X11
+
+	MOVOA X8, X6
+	MOVOU X8save-48(SP), X8
+	MOVOA X5, X9
+	PAND X6, X5			// X5 = 01234567[2]
+	PSRLW $8, X9			// X9 = 89abcdef[2]
+	PADDW X5, X12
+	PADDW X9, X13
+
+	MOVOU X9save-32(SP), X9
+	MOVOA X7, X5
+	PAND X6, X7			// X7 = 01234567[3]
+	PSRLW $8, X5			// X5 = 89abcdef[3]
+	PADDW X7, X14
+	PADDW X5, X15
+
+	MOVOA X4, X5
+	PAND X6, X4			// X4 = 01234567[0]
+	PSRLW $8, X5			// X5 = 89abcdef[0]
+	PADDW X4, X8
+	PADDW X5, X9
+
+	SUBL $16*2, AX			// account for possible overflow
+	CMPL AX, $(15+15)*2		// enough space left in the counters?
+	JGE have_space
+
+	PXOR X7, X7
+	CALL *BX			// call accumulation function
+	PXOR X8, X8			// clear counters for next round
+	PXOR X9, X9
+	PXOR X10, X10
+	PXOR X11, X11
+	PXOR X12, X12
+	PXOR X13, X13
+	PXOR X14, X14
+	PXOR X15, X15
+
+	MOVL $65535, AX			// space left til overflow could occur
+
+have_space:
+	SUBQ $16*16, CX			// account for bytes consumed
+	JGE vec
+
+	MOVQ magic<>+8(SB), X5		// load magic constants
+	PSHUFD $0x55, X5, X6		// 0xaaaaaaaa
+	PSHUFD $0x00, X5, X7		// 0x55555555
+
+	// group X0--X3 into nibbles in the same register
+	MOVOA X0, X5
+	PAND X6, X5
+	PSRLL $1, X5
+	MOVOA X1, X4
+	PAND X7, X4
+	PADDL X4, X4
+	PAND X7, X0
+	PAND X6, X1
+	POR X4, X0			// X0 = eca86420 (low crumbs)
+	POR X5, X1			// X1 = fdb97531 (high crumbs)
+
+	MOVOA X2, X5
+	PAND X6, X5
+	PSRLL $1, X5
+	MOVOA X3, X4
+	PAND X7, X4
+	PADDL X4, X4
+	PAND X7, X2
+	PAND X6, X3
+	POR X4, X2			// X0 = eca86420 (low crumbs)
+	POR X5, X3			// X1 = fdb97531 (high crumbs)
+
+	MOVQ magic<>+16(SB), X7
+	PSHUFD $0x55, X7, X6		// 0xcccccccc
+	PSHUFD $0x00, X7, X7		// 0x33333333
+
+	MOVOA X0, X5
+	PAND X6, X5
+	PSRLL $2, X5
+	MOVOA X2, X4
+	PAND X7, X4
+	PSLLL $2, X4
+	PAND X7, X0
+	PAND X6, X2
+	POR X4, X0			// X0 = c840
+	POR X5, X2			// X2 = ea62
+
+	MOVOA X1, X5
+	PAND X6, X5
+	PSRLL $2, X5
+	MOVOA X3, X4
+	PAND X7, X4
+	PSLLL $2, X4
+	PAND X7, X1
+	PAND X6, X3
+	POR X4, X1			// X1 = d951
+	POR X5, X3			// X3 = fb73
+
+	MOVD magic<>+24(SB), X7
+	PSHUFD $0x00, X7, X7		// 0x0f0f0f0f
+
+	// pre-shuffle nibbles
+	MOVOA X2, X5
+	PUNPCKLBW X3, X2		// X2 = fbea7362 (3:2:1:0)
+	PUNPCKHBW X3, X5		// X5 = fbea7362 (7:6:5:4)
+	MOVOA X0, X3
+	PUNPCKLBW X1, X0		// X0 = d9c85140 (3:2:1:0)
+	PUNPCKHBW X1, X3		// X4 = d9c85140 (7:6:5:4)
+	MOVOA X0, X1
+	PUNPCKLWL X2, X0		// X0 = fbead9c873625140 (1:0)
+	PUNPCKHWL X2, X1		// X1 = fbead9c873625140 (3:2)
+	MOVOA X3, X2
+	PUNPCKLWL X5, X2		// X2 = fbead9c873625140 (5:4)
+	PUNPCKHWL X5, X3		// X3 = fbead9c873625140 (7:6)
+
+	// pull high and low nibbles and reduce once
+	MOVOA X0, X4
+	PSRLL $4, X4
+	PAND X7, X0			// X0 = ba983210 (1:0)
+	PAND X7, X4			// X4 = fedc7654 (1:0)
+
+	MOVOA X2, X6
+	PSRLL $4, X2
+	PAND X7, X6			// X6 = ba983210 (5:4)
+	PAND X7, X2			// X2 = fedc7654 (5:4)
+
+	PADDB X6, X0			// X0 = ba983210 (1:0)
+	PADDB X4, X2			// X2 = fedc7654 (1:0)
+
+	MOVOA X1, X4
+	PSRLL $4, X4
+	PAND X7, X1			// X1 = ba983210 (3:2)
+	PAND X7, X4			// X4 = fedc7654 (3:2)
+
+	MOVOA X3, X6
+	PSRLL $4, X3
+	PAND X7, X6			// X6 = ba983210 (7:6)
+	PAND X7, X3			// X3 = fedc7654 (7:6)
+
+	PADDB X6, X1			// X1 = ba983210 (3:2)
+	PADDB X4, X3			// X3 = fedc7654 (3:2)
+
+	// unpack one last time
+	MOVOA X0, X4
+	PUNPCKLLQ X2, X0		// X0 = fedcba9876543210 (0)
+	PUNPCKHLQ X2, X4		// X4 = fedcba9876543210 (1)
+	MOVOA X1, X5
+	PUNPCKLLQ X3, X1		// X1 = fedcba9876543210 (2)
+	PUNPCKHLQ X3, X5		// X5 = fedcba9876543210 (3)
+
+	// add to counters
+	PXOR X7, X7			// zero register
+	ACCUM( X8,  X9, X0)
+	ACCUM(X10, X11, X4)
+	ACCUM(X12, X13, X1)
+	ACCUM(X14, X15, X5)
+
+	// constants for processing the tail
+endvec:	MOVQ magic<>+0(SB), X6		// bit position mask
+	PSHUFD $0x44, X6, X6		// broadcast into both qwords
+	PXOR X0, X0			// counter registers
+	PXOR X1, X1
+	PXOR X2, X2
+	PXOR X3, X3
+
+	// process tail, 8 bytes at a time
+	ADDQ $16*16, CX			// any bytes left to process?
+	JEQ end
+
+tail8:	LOADQ(R10)
+	MOVQ R10, X4
+	COUNT4(X0, X1)
+	SHRQ $32, R10
+	MOVQ R10, X4
+	COUNT4(X2, X3)
+	SUBQ $8, CX
+	JGT tail8
+
+	// add tail to counters
+end:	PXOR X7, X7			// zero register
+	MOVOA X0, X4
+	PUNPCKLBW X7, X0
+	PUNPCKHBW X7, X4
+	PADDW X0, X8
+	PADDW X4, X9
+	MOVOA X1, X4
+	PUNPCKLBW X7, X1
+	PUNPCKHBW X7, X4
+	PADDW X1, X10
+	PADDW X4, X11
+	MOVOA X2, X4
+	PUNPCKLBW X7, X2
+	PUNPCKHBW X7, X4
+	PADDW X2, X12
+	PADDW X4, X13
+	MOVOA X3, X4
+	PUNPCKLBW X7, X3
+	PUNPCKHBW X7, X4
+	PADDW X3, X14
+	PADDW X4, X15
+
+	CALL *BX
+	RET
@@ -141,3 +141,42 @@ func Count32(counts *[32]int, buf []uint32) {
 func Count64(counts *[64]int, buf []uint64) {
 	count64func(counts, buf)
 }
+
+// Element is the set of types accepted by Count.  It comprises all
+// integer and floating point types, including named types derived from
+// them.
+type Element interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Count the number of corresponding set bits of the values in buf and
+// add the results to counts.  The element width of T determines the
+// number of counters: counts must hold at least as many elements as T
+// has bits, i.e. 8 for int8 and uint8, 16 for int16 and uint16, 32 for
+// int32, uint32, and float32, and 64 for int64, uint64, and float64.
+// The width of int, uint, and uintptr depends on the platform.  Only
+// the leading counters are modified if counts is longer.  Signed
+// integers are counted in two's complement, floating point numbers in
+// their IEEE 754 representation.  Count panics if counts is too short.
+//
+// Count dispatches to the same implementation as Count8, Count16,
+// Count32, or Count64, according to the element width.
+func Count[T Element](counts []int, buf []T) {
+	var zero T
+
+	data := unsafe.Pointer(unsafe.SliceData(buf))
+	switch unsafe.Sizeof(zero) {
+	case 1:
+		count8func((*[8]int)(counts), unsafe.Slice((*uint8)(data), len(buf)))
+	case 2:
+		count16func((*[16]int)(counts), unsafe.Slice((*uint16)(data), len(buf)))
+	case 4:
+		count32func((*[32]int)(counts), unsafe.Slice((*uint32)(data), len(buf)))
+	case 8:
+		count64func((*[64]int)(counts), unsafe.Slice((*uint64)(data), len(buf)))
+	default:
+		panic("pospop: unsupported element size")
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import "unsafe"
+
+// each platform must provide arrays gather32funcs and gather64funcs of
+// type gather32impl and gather64impl listing the available gather
+// kernels, analogous to count8funcs and friends.  A gather kernel sets
+// dst[k] = buf[sel[k]] for k < len(sel).  The caller ensures that dst
+// is at least as long as sel and that all indices are in range.
+//
+// Likewise, arrays gatherStrided32funcs and gatherStrided64funcs list
+// the strided gather kernels.  These set dst[k] to the element at byte
+// offset k*stride from base for k < len(dst).  The caller ensures that
+// all these elements are valid and suitably aligned.
+
+type gather32impl struct {
+	gather32  func(dst, buf []uint32, sel []int32)
+	name      string
+	available bool
+}
+
+type gather64impl struct {
+	gather64  func(dst, buf []uint64, sel []int32)
+	name      string
+	available bool
+}
+
+type gatherStrided32impl struct {
+	gatherStrided32 func(dst []uint32, base unsafe.Pointer, stride uintptr)
+	name            string
+	available       bool
+}
+
+type gatherStrided64impl struct {
+	gatherStrided64 func(dst []uint64, base unsafe.Pointer, stride uintptr)
+	name            string
+	available       bool
+}
+
+// optimal gather32 implementation selected at runtime
+var gather32func = func() func(dst, buf []uint32, sel []int32) {
+	for _, f := range gather32funcs {
+		if f.available {
+			return f.gather32
+		}
+	}
+
+	panic("no implementation of gather32 available")
+}()
+
+// optimal gather64 implementation selected at runtime
+var gather64func = func() func(dst, buf []uint64, sel []int32) {
+	for _, f := range gather64funcs {
+		if f.available {
+			return f.gather64
+		}
+	}
+
+	panic("no implementation of gather64 available")
+}()
+
+// optimal gatherStrided32 implementation selected at runtime
+var gatherStrided32func = func() func(dst []uint32, base unsafe.Pointer, stride uintptr) {
+	for _, f := range gatherStrided32funcs {
+		if f.available {
+			return f.gatherStrided32
+		}
+	}
+
+	panic("no implementation of gatherStrided32 available")
+}()
+
+// optimal gatherStrided64 implementation selected at runtime
+var gatherStrided64func = func() func(dst []uint64, base unsafe.Pointer, stride uintptr) {
+	for _, f := range gatherStrided64funcs {
+		if f.available {
+			return f.gatherStrided64
+		}
+	}
+
+	panic("no implementation of gatherStrided64 available")
+}()
@@ -0,0 +1,163 @@
+#include "textflag.h"
+
+// AVX2 gather kernels.  The gather kernels load the elements selected
+// by a vector of 32 bit indices with VPGATHERDD and VPGATHERDQ,
+// processing 8 or 4 elements per iteration.  The strided gather kernels
+// load 4 elements per iteration with VPGATHERQD and VPGATHERQQ from a
+// vector of 64 bit byte offsets, which is advanced by 4*stride each
+// iteration.  The remaining elements are loaded one by one.  All
+// indices must be in range and non-negative.
+// Required CPU extension: AVX2.
+
+// func gather32avx2(dst, buf []uint32, sel []int32)
+TEXT ·gather32avx2(SB), NOSPLIT, $0-72
+	MOVQ dst_base+0(FP), DI		// DI = &dst[0]
+	MOVQ buf_base+24(FP), SI	// SI = &buf[0]
+	MOVQ sel_base+48(FP), BX	// BX = &sel[0]
+	MOVQ sel_len+56(FP), CX		// CX = len(sel)
+	MOVQ CX, DX
+	ANDQ $~7, DX			// DX = number of elements to gather
+	XORL AX, AX			// AX = k
+	CMPQ AX, DX
+	JGE tail32
+
+vec32:	VMOVDQU (BX)(AX*4), Y1		// Y1 = sel[k:k+8]
+	VPCMPEQD Y2, Y2, Y2		// Y2 = mask (cleared by the gather)
+	VPGATHERDD Y2, (SI)(Y1*4), Y0	// Y0 = buf[sel[k]], ..., buf[sel[k+7]]
+	VMOVDQU Y0, (DI)(AX*4)
+	ADDQ $8, AX
+	CMPQ AX, DX
+	JLT vec32
+
+	VZEROUPPER
+
+tail32:	CMPQ AX, CX
+	JGE end32
+	MOVLQSX (BX)(AX*4), R8
+	MOVL (SI)(R8*4), R9
+	MOVL R9, (DI)(AX*4)
+	INCQ AX
+	JMP tail32
+
+end32:	RET
+
+// func gather64avx2(dst, buf []uint64, sel []int32)
+TEXT ·gather64avx2(SB), NOSPLIT, $0-72
+	MOVQ dst_base+0(FP), DI		// DI = &dst[0]
+	MOVQ buf_base+24(FP), SI	// SI = &buf[0]
+	MOVQ sel_base+48(FP), BX	// BX = &sel[0]
+	MOVQ sel_len+56(FP), CX		// CX = len(sel)
+	MOVQ CX, DX
+	ANDQ $~3, DX			// DX = number of elements to gather
+	XORL AX, AX			// AX = k
+	CMPQ AX, DX
+	JGE tail64
+
+vec64:	VMOVDQU (BX)(AX*4), X1		// X1 = sel[k:k+4]
+	VPCMPEQQ Y2, Y2, Y2		// Y2 = mask (cleared by the gather)
+	VPGATHERDQ Y2, (SI)(X1*8), Y0	// Y0 = buf[sel[k]], ..., buf[sel[k+3]]
+	VMOVDQU Y0, (DI)(AX*8)
+	ADDQ $4, AX
+	CMPQ AX, DX
+	JLT vec64
+
+	VZEROUPPER
+
+tail64:	CMPQ AX, CX
+	JGE end64
+	MOVLQSX (BX)(AX*4), R8
+	MOVQ (SI)(R8*8), R9
+	MOVQ R9, (DI)(AX*8)
+	INCQ AX
+	JMP tail64
+
+end64:	RET
+
+// set up Y1 = (0, stride, 2*stride, 3*stride) as the byte offsets of the
+// first four elements and Y3 = 4*stride as the increment, using R10
+// and R11 for scratch space.  Expects stride in DX.
+#define STRIDES \
+	VMOVQ DX, X4 \
+	VPSLLDQ $8, X4, X1 \		// X1 = (0, stride)
+	LEAQ (DX)(DX*1), R10 \		// R10 = 2*stride
+	LEAQ (R10)(DX*1), R11 \	// R11 = 3*stride
+	VMOVQ R10, X5 \
+	VPINSRQ $1, R11, X5, X5 \	// X5 = (2*stride, 3*stride)
+	VINSERTI128 $1, X5, Y1, Y1 \
+	SHLQ $1, R10 \			// R10 = 4*stride
+	VMOVQ R10, X3 \
+	VPBROADCASTQ X3, Y3
+
+// func gatherStrided32avx2(dst []uint32, base unsafe.Pointer, stride uintptr)
+TEXT ·gatherStrided32avx2(SB), NOSPLIT, $0-40
+	MOVQ dst_base+0(FP), DI		// DI = &dst[0]
+	MOVQ dst_len+8(FP), CX		// CX = len(dst)
+	MOVQ base+24(FP), SI		// SI = base
+	MOVQ stride+32(FP), DX		// DX = stride
+	MOVQ CX, BX
+	ANDQ $~3, BX			// BX = number of elements to gather
+	XORL AX, AX			// AX = k
+	XORL R8, R8			// R8 = k*stride
+	CMPQ AX, BX
+	JGE tails32
+
+	STRIDES
+
+vecs32:	VPCMPEQD X2, X2, X2		// X2 = mask (cleared by the gather)
+	VPGATHERQD X2, (SI)(Y1*1), X0	// X0 = 4 elements at the offsets in Y1
+	VMOVDQU X0, (DI)(AX*4)
+	VPADDQ Y3, Y1, Y1		// advance offsets by 4*stride
+	ADDQ R10, R8
+	ADDQ $4, AX
+	CMPQ AX, BX
+	JLT vecs32
+
+	VZEROUPPER
+
+tails32:
+	CMPQ AX, CX
+	JGE ends32
+	MOVL (SI)(R8*1), R9
+	MOVL R9, (DI)(AX*4)
+	ADDQ DX, R8
+	INCQ AX
+	JMP tails32
+
+ends32:	RET
+
+// func gatherStrided64avx2(dst []uint64, base unsafe.Pointer, stride uintptr)
+TEXT ·gatherStrided64avx2(SB), NOSPLIT, $0-40
+	MOVQ dst_base+0(FP), DI		// DI = &dst[0]
+	MOVQ dst_len+8(FP), CX		// CX = len(dst)
+	MOVQ base+24(FP), SI		// SI = base
+	MOVQ stride+32(FP), DX		// DX = stride
+	MOVQ CX, BX
+	ANDQ $~3, BX			// BX = number of elements to gather
+	XORL AX, AX			// AX = k
+	XORL R8, R8			// R8 = k*stride
+	CMPQ AX, BX
+	JGE tails64
+
+	STRIDES
+
+vecs64:	VPCMPEQQ Y2, Y2, Y2		// Y2 = mask (cleared by the gather)
+	VPGATHERQQ Y2, (SI)(Y1*1), Y0	// Y0 = 4 elements at the offsets in Y1
+	VMOVDQU Y0, (DI)(AX*8)
+	VPADDQ Y3, Y1, Y1		// advance offsets by 4*stride
+	ADDQ R10, R8
+	ADDQ $4, AX
+	CMPQ AX, BX
+	JLT vecs64
+
+	VZEROUPPER
+
+tails64:
+	CMPQ AX, CX
+	JGE ends64
+	MOVQ (SI)(R8*1), R9
+	MOVQ R9, (DI)(AX*8)
+	ADDQ DX, R8
+	INCQ AX
+	JMP tails64
+
+ends64:	RET
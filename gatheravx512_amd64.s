@@ -0,0 +1,75 @@
+#include "textflag.h"
+
+// AVX-512 gather kernels.  The gather kernels load the elements selected
+// by a vector of 32 bit indices with VPGATHERDD and VPGATHERDQ,
+// processing 16 or 8 elements per iteration.  The remaining elements
+// are gathered in one final iteration with a partial mask, so indices
+// beyond the end of sel are neither loaded nor used.  All indices must
+// be in range and non-negative.
+// Required CPU extension: AVX-512 F.
+
+// func gather32avx512(dst, buf []uint32, sel []int32)
+TEXT ·gather32avx512(SB), NOSPLIT, $0-72
+	MOVQ dst_base+0(FP), DI		// DI = &dst[0]
+	MOVQ buf_base+24(FP), SI	// SI = &buf[0]
+	MOVQ sel_base+48(FP), BX	// BX = &sel[0]
+	MOVQ sel_len+56(FP), CX		// CX = len(sel)
+	XORL AX, AX			// AX = k
+	SUBQ $16, CX			// CX = len(sel) - 16
+	JLT tail32
+
+vec32:	VMOVDQU32 (BX)(AX*4), Z1	// Z1 = sel[k:k+16]
+	KXNORW K0, K0, K1		// K1 = mask (cleared by the gather)
+	VPGATHERDD (SI)(Z1*4), K1, Z0	// Z0 = buf[sel[k]], ..., buf[sel[k+15]]
+	VMOVDQU32 Z0, (DI)(AX*4)
+	ADDQ $16, AX
+	CMPQ AX, CX
+	JLE vec32
+
+tail32:	SUBQ AX, CX			// CX = remaining elements - 16
+	ADDQ $16, CX			// CX = remaining elements
+	JEQ end32
+	MOVL $1, DX
+	SHLL CX, DX
+	DECL DX				// DX = (1 << CX) - 1
+	KMOVW DX, K2			// K2 = mask of remaining elements
+	KMOVW K2, K1
+	VMOVDQU32 (BX)(AX*4), K1, Z1	// Z1 = sel[k:len(sel)]
+	VPGATHERDD (SI)(Z1*4), K1, Z0	// Z0 = buf[sel[k]], ..., buf[sel[len(sel)-1]]
+	VMOVDQU32 Z0, K2, (DI)(AX*4)
+
+end32:	VZEROUPPER
+	RET
+
+// func gather64avx512(dst, buf []uint64, sel []int32)
+TEXT ·gather64avx512(SB), NOSPLIT, $0-72
+	MOVQ dst_base+0(FP), DI		// DI = &dst[0]
+	MOVQ buf_base+24(FP), SI	// SI = &buf[0]
+	MOVQ sel_base+48(FP), BX	// BX = &sel[0]
+	MOVQ sel_len+56(FP), CX		// CX = len(sel)
+	XORL AX, AX			// AX = k
+	SUBQ $8, CX			// CX = len(sel) - 8
+	JLT tail64
+
+vec64:	VMOVDQU32 (BX)(AX*4), Y1	// Y1 = sel[k:k+8]
+	KXNORB K0, K0, K1		// K1 = mask (cleared by the gather)
+	VPGATHERDQ (SI)(Y1*8), K1, Z0	// Z0 = buf[sel[k]], ..., buf[sel[k+7]]
+	VMOVDQU64 Z0, (DI)(AX*8)
+	ADDQ $8, AX
+	CMPQ AX, CX
+	JLE vec64
+
+tail64:	SUBQ AX, CX			// CX = remaining elements - 8
+	ADDQ $8, CX			// CX = remaining elements
+	JEQ end64
+	MOVL $1, DX
+	SHLL CX, DX
+	DECL DX				// DX = (1 << CX) - 1
+	KMOVW DX, K2			// K2 = mask of remaining elements
+	KMOVW K2, K1
+	VMOVDQU32 (BX)(AX*4), K1, Y1	// Y1 = sel[k:len(sel)]
+	VPGATHERDQ (SI)(Y1*8), K1, Z0	// Z0 = buf[sel[k]], ..., buf[sel[len(sel)-1]]
+	VMOVDQU64 Z0, K2, (DI)(AX*8)
+
+end64:	VZEROUPPER
+	RET
@@ -2,6 +2,8 @@
 
 package pospop
 
+import "unsafe"
+
 // 8-bit full adder
 func csa8(a, b, c uint8) (c_out, s uint8) {
 	s_ab := a ^ b
@@ -344,3 +346,360 @@ func count64generic(counts *[64]int, buf []uint64) {
 		}
 	}
 }
+
+// gather32 generic implementation
+func gather32generic(dst, buf []uint32, sel []int32) {
+	for k, i := range sel {
+		dst[k] = buf[i]
+	}
+}
+
+// gather64 generic implementation
+func gather64generic(dst, buf []uint64, sel []int32) {
+	for k, i := range sel {
+		dst[k] = buf[i]
+	}
+}
+
+// gatherStrided32 generic implementation
+func gatherStrided32generic(dst []uint32, base unsafe.Pointer, stride uintptr) {
+	for k := range dst {
+		dst[k] = *(*uint32)(unsafe.Add(base, uintptr(k)*stride))
+	}
+}
+
+// gatherStrided64 generic implementation
+func gatherStrided64generic(dst []uint64, base unsafe.Pointer, stride uintptr) {
+	for k := range dst {
+		dst[k] = *(*uint64)(unsafe.Add(base, uintptr(k)*stride))
+	}
+}
+
+// Number of elements counted at a time by the generic kernels for
+// altCounter counters.  Chosen such that the intermediate int counters
+// cannot overflow even if int is only 32 bits wide.
+const altChunkLen = 1 << 30
+
+// count8alt generic implementation.  Counts buf into int counters
+// with count8generic in chunks short enough for them not to overflow.
+func count8altgeneric(counts *[8]altCounter, buf []uint8) {
+	var local [8]int
+
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > altChunkLen {
+			n = altChunkLen
+		}
+
+		local = [8]int{}
+		count8generic(&local, buf[:n])
+		for i := range counts {
+			counts[i] += altCounter(local[i])
+		}
+
+		buf = buf[n:]
+	}
+}
+
+// count16alt generic implementation.  Counts buf into int counters
+// with count16generic in chunks short enough for them not to overflow.
+func count16altgeneric(counts *[16]altCounter, buf []uint16) {
+	var local [16]int
+
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > altChunkLen {
+			n = altChunkLen
+		}
+
+		local = [16]int{}
+		count16generic(&local, buf[:n])
+		for i := range counts {
+			counts[i] += altCounter(local[i])
+		}
+
+		buf = buf[n:]
+	}
+}
+
+// count32alt generic implementation.  Counts buf into int counters
+// with count32generic in chunks short enough for them not to overflow.
+func count32altgeneric(counts *[32]altCounter, buf []uint32) {
+	var local [32]int
+
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > altChunkLen {
+			n = altChunkLen
+		}
+
+		local = [32]int{}
+		count32generic(&local, buf[:n])
+		for i := range counts {
+			counts[i] += altCounter(local[i])
+		}
+
+		buf = buf[n:]
+	}
+}
+
+// count64alt generic implementation.  Counts buf into int counters
+// with count64generic in chunks short enough for them not to overflow.
+func count64altgeneric(counts *[64]altCounter, buf []uint64) {
+	var local [64]int
+
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > altChunkLen {
+			n = altChunkLen
+		}
+
+		local = [64]int{}
+		count64generic(&local, buf[:n])
+		for i := range counts {
+			counts[i] += altCounter(local[i])
+		}
+
+		buf = buf[n:]
+	}
+}
+
+// count8binop generic implementation.  Combines a and b one block of
+// count8generic at a time and counts the result.
+func count8binopgeneric(counts *[8]int, a, b []uint8, op binop) {
+	var blk [15]uint8
+
+	for len(a) > 0 {
+		n := combine(blk[:], a, b, op)
+		count8generic(counts, blk[:n])
+		a, b = a[n:], b[n:]
+	}
+}
+
+// count16binop generic implementation.  Combines a and b one block of
+// count16generic at a time and counts the result.
+func count16binopgeneric(counts *[16]int, a, b []uint16, op binop) {
+	var blk [15]uint16
+
+	for len(a) > 0 {
+		n := combine(blk[:], a, b, op)
+		count16generic(counts, blk[:n])
+		a, b = a[n:], b[n:]
+	}
+}
+
+// count32binop generic implementation.  Combines a and b one block of
+// count32generic at a time and counts the result.
+func count32binopgeneric(counts *[32]int, a, b []uint32, op binop) {
+	var blk [15]uint32
+
+	for len(a) > 0 {
+		n := combine(blk[:], a, b, op)
+		count32generic(counts, blk[:n])
+		a, b = a[n:], b[n:]
+	}
+}
+
+// count64binop generic implementation.  Combines a and b one block of
+// count64generic at a time and counts the result.
+func count64binopgeneric(counts *[64]int, a, b []uint64, op binop) {
+	var blk [15]uint64
+
+	for len(a) > 0 {
+		n := combine(blk[:], a, b, op)
+		count64generic(counts, blk[:n])
+		a, b = a[n:], b[n:]
+	}
+}
+
+// count8masked generic implementation.  Masks buf two bytes of valid
+// at a time and counts the result with count8generic.
+func count8maskedgeneric(counts *[8]int, buf []uint8, valid []byte) {
+	var blk [16]uint8
+
+	for len(buf) > 0 {
+		n := mask(blk[:], buf, valid)
+		count8generic(counts, blk[:n])
+		buf, valid = buf[n:], valid[n/8:]
+	}
+}
+
+// count16masked generic implementation.  Masks buf two bytes of valid
+// at a time and counts the result with count16generic.
+func count16maskedgeneric(counts *[16]int, buf []uint16, valid []byte) {
+	var blk [16]uint16
+
+	for len(buf) > 0 {
+		n := mask(blk[:], buf, valid)
+		count16generic(counts, blk[:n])
+		buf, valid = buf[n:], valid[n/8:]
+	}
+}
+
+// count32masked generic implementation.  Masks buf two bytes of valid
+// at a time and counts the result with count32generic.
+func count32maskedgeneric(counts *[32]int, buf []uint32, valid []byte) {
+	var blk [16]uint32
+
+	for len(buf) > 0 {
+		n := mask(blk[:], buf, valid)
+		count32generic(counts, blk[:n])
+		buf, valid = buf[n:], valid[n/8:]
+	}
+}
+
+// count64masked generic implementation.  Masks buf two bytes of valid
+// at a time and counts the result with count64generic.
+func count64maskedgeneric(counts *[64]int, buf []uint64, valid []byte) {
+	var blk [16]uint64
+
+	for len(buf) > 0 {
+		n := mask(blk[:], buf, valid)
+		count64generic(counts, blk[:n])
+		buf, valid = buf[n:], valid[n/8:]
+	}
+}
+
+// count8onehot generic implementation.  Reduces buf one block of
+// count8generic at a time and counts the result.
+func count8onehotgeneric(counts *[8]int, buf []uint8, leading bool) {
+	var blk [15]uint8
+
+	for len(buf) > 0 {
+		n := onehot(blk[:], buf, leading)
+		count8generic(counts, blk[:n])
+		buf = buf[n:]
+	}
+}
+
+// count16onehot generic implementation.  Reduces buf one block of
+// count16generic at a time and counts the result.
+func count16onehotgeneric(counts *[16]int, buf []uint16, leading bool) {
+	var blk [15]uint16
+
+	for len(buf) > 0 {
+		n := onehot(blk[:], buf, leading)
+		count16generic(counts, blk[:n])
+		buf = buf[n:]
+	}
+}
+
+// count32onehot generic implementation.  Reduces buf one block of
+// count32generic at a time and counts the result.
+func count32onehotgeneric(counts *[32]int, buf []uint32, leading bool) {
+	var blk [15]uint32
+
+	for len(buf) > 0 {
+		n := onehot(blk[:], buf, leading)
+		count32generic(counts, blk[:n])
+		buf = buf[n:]
+	}
+}
+
+// count64onehot generic implementation.  Reduces buf one block of
+// count64generic at a time and counts the result.
+func count64onehotgeneric(counts *[64]int, buf []uint64, leading bool) {
+	var blk [15]uint64
+
+	for len(buf) > 0 {
+		n := onehot(blk[:], buf, leading)
+		count64generic(counts, blk[:n])
+		buf = buf[n:]
+	}
+}
+
+// count8segments generic implementation.  Counts one segment at a
+// time with the optimal count8 implementation.
+func count8segmentsgeneric(out [][8]int, buf []uint8, segLen int) {
+	for k := range out {
+		count8func(&out[k], buf[k*segLen:(k+1)*segLen])
+	}
+}
+
+// count16segments generic implementation.  Counts one segment at a
+// time with the optimal count16 implementation.
+func count16segmentsgeneric(out [][16]int, buf []uint16, segLen int) {
+	for k := range out {
+		count16func(&out[k], buf[k*segLen:(k+1)*segLen])
+	}
+}
+
+// count32segments generic implementation.  Counts one segment at a
+// time with the optimal count32 implementation.
+func count32segmentsgeneric(out [][32]int, buf []uint32, segLen int) {
+	for k := range out {
+		count32func(&out[k], buf[k*segLen:(k+1)*segLen])
+	}
+}
+
+// count64segments generic implementation.  Counts one segment at a
+// time with the optimal count64 implementation.
+func count64segmentsgeneric(out [][64]int, buf []uint64, segLen int) {
+	for k := range out {
+		count64func(&out[k], buf[k*segLen:(k+1)*segLen])
+	}
+}
+
+// count8hist generic implementation.  Counts buf one chunk of stageLen
+// elements at a time with the optimal count8 implementation and
+// histograms each chunk while it is still in the cache.
+func count8histgeneric(counts *[8]int, hist *[9]int, buf []uint8) {
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > stageLen {
+			n = stageLen
+		}
+
+		count8func(counts, buf[:n])
+		popcountHistogram(hist[:], buf[:n])
+		buf = buf[n:]
+	}
+}
+
+// count16hist generic implementation.  Counts buf one chunk of stageLen
+// elements at a time with the optimal count16 implementation and
+// histograms each chunk while it is still in the cache.
+func count16histgeneric(counts *[16]int, hist *[17]int, buf []uint16) {
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > stageLen {
+			n = stageLen
+		}
+
+		count16func(counts, buf[:n])
+		popcountHistogram(hist[:], buf[:n])
+		buf = buf[n:]
+	}
+}
+
+// count32hist generic implementation.  Counts buf one chunk of stageLen
+// elements at a time with the optimal count32 implementation and
+// histograms each chunk while it is still in the cache.
+func count32histgeneric(counts *[32]int, hist *[33]int, buf []uint32) {
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > stageLen {
+			n = stageLen
+		}
+
+		count32func(counts, buf[:n])
+		popcountHistogram(hist[:], buf[:n])
+		buf = buf[n:]
+	}
+}
+
+// count64hist generic implementation.  Counts buf one chunk of stageLen
+// elements at a time with the optimal count64 implementation and
+// histograms each chunk while it is still in the cache.
+func count64histgeneric(counts *[64]int, hist *[65]int, buf []uint64) {
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > stageLen {
+			n = stageLen
+		}
+
+		count64func(counts, buf[:n])
+		popcountHistogram(hist[:], buf[:n])
+		buf = buf[n:]
+	}
+}
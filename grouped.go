@@ -0,0 +1,228 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/bits"
+	"unsafe"
+)
+
+// GroupKey is the set of types usable as group ids with the
+// CountGrouped family of functions.
+type GroupKey interface {
+	~uint8 | ~uint16 | ~uint32
+}
+
+// Size limits of the staging buffers in bytes.  With few groups, the
+// elements of each group are collected in a staging buffer of at most
+// groupMaxStage bytes.  All staging buffers together take up at most
+// groupStageBudget bytes, so they stay in the L1 cache, and staging is
+// only used if each buffer can hold at least groupMinStage bytes.
+const (
+	groupStageBudget = 32 << 10
+	groupMinStage    = 512
+	groupMaxStage    = 4 << 10
+)
+
+// add the positional population count of each element of buf to the
+// counters of group groups[i].  The counters of group g are
+// counts[g*nbits:(g+1)*nbits].
+//
+// With few groups, the elements are staged per group and each staging
+// buffer is counted once full.  Otherwise, the elements are sorted by
+// group id with a counting sort, so the counters of each group are
+// visited once and in order.  If there are more groups than elements,
+// the elements are added to their counters directly.
+func countGrouped[T word, K GroupKey](counts []int, buf []T, groups []K) {
+	var zero T
+	nbits := 8 * int(unsafe.Sizeof(zero))
+	ngroups := len(counts) / nbits
+
+	if len(groups) != len(buf) {
+		panic("pospop: buffer and group ids differ in length")
+	}
+
+	switch {
+	case ngroups > len(buf):
+		for i, g := range groups {
+			checkGroup(g, ngroups)
+			countRun(counts[int(g)*nbits:(int(g)+1)*nbits], buf[i:i+1])
+		}
+
+	case groupStageBudget/ngroups >= groupMinStage:
+		stageGrouped(counts, buf, groups)
+
+	default:
+		sortGrouped(counts, buf, groups)
+	}
+}
+
+// countGrouped for few groups: collect the elements of each group in
+// a staging buffer whose length is a power of two and count the
+// staging buffers as they fill up.
+func stageGrouped[T word, K GroupKey](counts []int, buf []T, groups []K) {
+	var zero T
+	size := int(unsafe.Sizeof(zero))
+	nbits := 8 * size
+	ngroups := len(counts) / nbits
+
+	stageSize := groupStageBudget / ngroups
+	if stageSize > groupMaxStage {
+		stageSize = groupMaxStage
+	}
+
+	stageLen := 1 << (bits.Len(uint(stageSize/size)) - 1)
+	stage := make([]T, ngroups*stageLen)
+
+	// fill[g] is the index of the next free slot in the stage of group g
+	fill := make([]int, ngroups)
+	for g := range fill {
+		fill[g] = g * stageLen
+	}
+
+	for i, g := range groups {
+		checkGroup(g, ngroups)
+		pos := fill[g]
+		stage[pos] = buf[i]
+		pos++
+		if pos&(stageLen-1) == 0 {
+			pos -= stageLen
+			Count(counts[int(g)*nbits:(int(g)+1)*nbits], stage[pos:pos+stageLen])
+		}
+
+		fill[g] = pos
+	}
+
+	for g, pos := range fill {
+		countRun(counts[g*nbits:(g+1)*nbits], stage[g*stageLen:pos])
+	}
+}
+
+// countGrouped for many groups: sort the elements by group with a
+// counting sort and count the elements of each group in one go.
+func sortGrouped[T word, K GroupKey](counts []int, buf []T, groups []K) {
+	var zero T
+	nbits := 8 * int(unsafe.Sizeof(zero))
+	ngroups := len(counts) / nbits
+
+	// end[g] is the end of group g in sorted once the elements are sorted
+	end := make([]int, ngroups)
+	for _, g := range groups {
+		checkGroup(g, ngroups)
+		end[g]++
+	}
+
+	off := 0
+	for g, n := range end {
+		off += n
+		end[g] = off - n
+	}
+
+	sorted := make([]T, len(buf))
+	for i, g := range groups {
+		sorted[end[g]] = buf[i]
+		end[g]++
+	}
+
+	start := 0
+	for g, stop := range end {
+		countRun(counts[g*nbits:(g+1)*nbits], sorted[start:stop])
+		start = stop
+	}
+}
+
+// panic if g is not a valid group id
+func checkGroup[K GroupKey](g K, ngroups int) {
+	// compare as unsigned: int(g) may be negative on 386
+	if uint(g) >= uint(ngroups) {
+		panic("pospop: group id out of range")
+	}
+}
+
+// add the positional population count of the elements of one group
+// to its counters.  Runs shorter than groupMinRun elements are added
+// one element at a time instead of calling the kernels.
+func countRun[T word](counts []int, buf []T) {
+	switch {
+	case len(buf) == 0:
+		return
+
+	case len(buf) < groupMinRun:
+		addBits(counts, buf)
+
+	default:
+		Count(counts, buf)
+	}
+}
+
+// add the positional population count of each element of buf to
+// counts without calling the kernels.  The bits of each byte are
+// spread into the byte lanes of a word and summed there, so buf must
+// hold fewer than 256 elements.
+func addBits[T word](counts []int, buf []T) {
+	var acc [8]uint64 // byte lane l of acc[k] counts bit 8*k+l
+
+	for _, x := range buf {
+		for k := range acc[:len(counts)/8] {
+			b := uint64(x) >> (8 * k) & 0xff
+			lanes := b * 0x0101010101010101 & 0x8040201008040201
+			acc[k] += (lanes + 0x7f7f7f7f7f7f7f7f) >> 7 & 0x0101010101010101
+		}
+	}
+
+	for k, a := range acc[:len(counts)/8] {
+		c := (*[8]int)(counts[8*k:])
+		c[0] += int(a & 0xff)
+		c[1] += int(a >> 8 & 0xff)
+		c[2] += int(a >> 16 & 0xff)
+		c[3] += int(a >> 24 & 0xff)
+		c[4] += int(a >> 32 & 0xff)
+		c[5] += int(a >> 40 & 0xff)
+		c[6] += int(a >> 48 & 0xff)
+		c[7] += int(a >> 56)
+	}
+}
+
+// reinterpret counts as a flat slice of counters
+func flatCounts[A [8]int | [16]int | [32]int | [64]int](counts []A) []int {
+	var zero A
+
+	n := len(counts) * int(unsafe.Sizeof(zero)/unsafe.Sizeof(int(0)))
+	return unsafe.Slice((*int)(unsafe.Pointer(unsafe.SliceData(counts))), n)
+}
+
+// Count the number of corresponding set bits of the values in buf and
+// add the results for buf[i] to counts[groups[i]], as if by
+// Count8(&counts[groups[i]], buf[i:i+1]).  CountGrouped8 panics if buf
+// and groups differ in length or if a group id is out of range for
+// counts.
+func CountGrouped8[K GroupKey](counts [][8]int, buf []uint8, groups []K) {
+	countGrouped(flatCounts(counts), buf, groups)
+}
+
+// Count the number of corresponding set bits of the values in buf and
+// add the results for buf[i] to counts[groups[i]], as if by
+// Count16(&counts[groups[i]], buf[i:i+1]).  CountGrouped16 panics if buf
+// and groups differ in length or if a group id is out of range for
+// counts.
+func CountGrouped16[K GroupKey](counts [][16]int, buf []uint16, groups []K) {
+	countGrouped(flatCounts(counts), buf, groups)
+}
+
+// Count the number of corresponding set bits of the values in buf and
+// add the results for buf[i] to counts[groups[i]], as if by
+// Count32(&counts[groups[i]], buf[i:i+1]).  CountGrouped32 panics if buf
+// and groups differ in length or if a group id is out of range for
+// counts.
+func CountGrouped32[K GroupKey](counts [][32]int, buf []uint32, groups []K) {
+	countGrouped(flatCounts(counts), buf, groups)
+}
+
+// Count the number of corresponding set bits of the values in buf and
+// add the results for buf[i] to counts[groups[i]], as if by
+// Count64(&counts[groups[i]], buf[i:i+1]).  CountGrouped64 panics if buf
+// and groups differ in length or if a group id is out of range for
+// counts.
+func CountGrouped64[K GroupKey](counts [][64]int, buf []uint64, groups []K) {
+	countGrouped(flatCounts(counts), buf, groups)
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// test the correctness of CountGrouped16 with group ids of type K
+func testCountGrouped16[K GroupKey](t *testing.T, ngroups int) {
+	for _, len := range testLengths {
+		buf := make([]uint16, len)
+		groups := make([]K, len)
+		for i := range buf {
+			buf[i] = uint16(rand.Uint32())
+
+			// produce both runs and scattered group ids
+			if i > 0 && rand.Intn(4) == 0 {
+				groups[i] = groups[i-1]
+			} else {
+				groups[i] = K(rand.Intn(ngroups))
+			}
+		}
+
+		counts := make([][16]int, ngroups)
+		for g := range counts {
+			randomCounts(counts[g][:])
+		}
+
+		refCounts := append([][16]int(nil), counts...)
+		CountGrouped16(counts, buf, groups)
+		for i := range buf {
+			count16safe(&refCounts[groups[i]], buf[i:i+1])
+		}
+
+		for g := range counts {
+			if counts[g] != refCounts[g] {
+				t.Errorf("length %d, group %d: counts don't match: %v\n", len, g, countDiff(counts[g][:], refCounts[g][:]))
+			}
+		}
+	}
+}
+
+// test the correctness of CountGrouped16
+func TestCountGrouped16(t *testing.T) {
+	t.Run("uint8", func(tt *testing.T) { testCountGrouped16[uint8](tt, 256) })
+	t.Run("uint16", func(tt *testing.T) { testCountGrouped16[uint16](tt, 3) })
+	t.Run("uint32", func(tt *testing.T) { testCountGrouped16[uint32](tt, 5000) })
+}
+
+// test that CountGrouped64 rejects out of range group ids, including
+// those that do not fit into an int on 32 bit platforms
+func TestCountGroupedRange(t *testing.T) {
+	t.Run("small", func(tt *testing.T) {
+		defer func() {
+			if recover() == nil {
+				tt.Error("CountGrouped64 did not panic")
+			}
+		}()
+
+		CountGrouped64(make([][64]int, 2), make([]uint64, 3), []uint8{0, 1, 2})
+	})
+
+	t.Run("large", func(tt *testing.T) {
+		defer func() {
+			if recover() == nil {
+				tt.Error("CountGrouped64 did not panic")
+			}
+		}()
+
+		CountGrouped64(make([][64]int, 2), make([]uint64, 2), []uint32{0, 1 << 31})
+	})
+}
+
+// benchmark CountGrouped16 against scattering the elements into one
+// slice per group and calling Count16 on each
+func BenchmarkCountGrouped16(b *testing.B) {
+	const n = 100 * 1000
+
+	for _, ngroups := range []int{16, 256, 65536} {
+		buf := make([]uint16, n)
+		groups := make([]uint16, n)
+		for i := range buf {
+			buf[i] = uint16(rand.Uint32())
+			groups[i] = uint16(rand.Intn(ngroups))
+		}
+
+		counts := make([][16]int, ngroups)
+
+		b.Run(strconv.Itoa(ngroups)+"/grouped", func(b *testing.B) {
+			b.SetBytes(2 * n)
+			for i := 0; i < b.N; i++ {
+				CountGrouped16(counts, buf, groups)
+			}
+		})
+
+		b.Run(strconv.Itoa(ngroups)+"/scatter", func(b *testing.B) {
+			scattered := make([][]uint16, ngroups)
+			b.SetBytes(2 * n)
+			for i := 0; i < b.N; i++ {
+				for g := range scattered {
+					scattered[g] = scattered[g][:0]
+				}
+
+				for k, x := range buf {
+					scattered[groups[k]] = append(scattered[groups[k]], x)
+				}
+
+				for g := range scattered {
+					Count16(&counts[g], scattered[g])
+				}
+			}
+		})
+	}
+}
+
+// test addBits, which is only used by CountGrouped with the generic kernels
+func TestAddBits(t *testing.T) {
+	for _, len := range []int{0, 1, 2, 14, 255} {
+		buf := make([]uint64, len)
+		for i := range buf {
+			buf[i] = rand.Uint64()
+		}
+
+		var counts, refCounts [64]int
+		randomCounts(counts[:])
+		refCounts = counts
+		addBits(counts[:], buf)
+		count64safe(&refCounts, buf)
+		if counts != refCounts {
+			t.Errorf("length %d: counts don't match: %v\n", len, countDiff(counts[:], refCounts[:]))
+		}
+	}
+}
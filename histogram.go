@@ -0,0 +1,367 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/bits"
+	"unsafe"
+)
+
+// each platform must provide arrays count8histfuncs, count16histfuncs,
+// count32histfuncs, and count64histfuncs of type count8histimpl, ...
+// listing kernels analogous to count8funcs and friends that also add
+// the popcount histogram of buf to hist, histogramming each block of
+// buf as it is loaded.  The caller ensures that the length of buf in
+// bytes is a multiple of 8.
+
+type count8histimpl struct {
+	count8hist func(counts *[8]int, hist *[9]int, buf []uint8)
+	name       string
+	available  bool
+}
+
+type count16histimpl struct {
+	count16hist func(counts *[16]int, hist *[17]int, buf []uint16)
+	name        string
+	available   bool
+}
+
+type count32histimpl struct {
+	count32hist func(counts *[32]int, hist *[33]int, buf []uint32)
+	name        string
+	available   bool
+}
+
+type count64histimpl struct {
+	count64hist func(counts *[64]int, hist *[65]int, buf []uint64)
+	name        string
+	available   bool
+}
+
+// optimal count8hist implementation selected at runtime
+var count8histfunc = func() func(*[8]int, *[9]int, []uint8) {
+	for _, f := range count8histfuncs {
+		if f.available {
+			return f.count8hist
+		}
+	}
+
+	panic("no implementation of count8hist available")
+}()
+
+// optimal count16hist implementation selected at runtime
+var count16histfunc = func() func(*[16]int, *[17]int, []uint16) {
+	for _, f := range count16histfuncs {
+		if f.available {
+			return f.count16hist
+		}
+	}
+
+	panic("no implementation of count16hist available")
+}()
+
+// optimal count32hist implementation selected at runtime
+var count32histfunc = func() func(*[32]int, *[33]int, []uint32) {
+	for _, f := range count32histfuncs {
+		if f.available {
+			return f.count32hist
+		}
+	}
+
+	panic("no implementation of count32hist available")
+}()
+
+// optimal count64hist implementation selected at runtime
+var count64histfunc = func() func(*[64]int, *[65]int, []uint64) {
+	for _, f := range count64histfuncs {
+		if f.available {
+			return f.count64hist
+		}
+	}
+
+	panic("no implementation of count64hist available")
+}()
+
+// each platform must provide arrays count8onehotfuncs, count16onehotfuncs,
+// count32onehotfuncs, and count64onehotfuncs of type count8onehotimpl,
+// ... listing kernels analogous to count8funcs and friends that count
+// the highest (if leading is set) or lowest set bit of each element of
+// buf, reducing the elements as they are loaded.  The caller ensures
+// that the length of buf in bytes is a multiple of 8.
+
+type count8onehotimpl struct {
+	count8onehot func(counts *[8]int, buf []uint8, leading bool)
+	name         string
+	available    bool
+}
+
+type count16onehotimpl struct {
+	count16onehot func(counts *[16]int, buf []uint16, leading bool)
+	name          string
+	available     bool
+}
+
+type count32onehotimpl struct {
+	count32onehot func(counts *[32]int, buf []uint32, leading bool)
+	name          string
+	available     bool
+}
+
+type count64onehotimpl struct {
+	count64onehot func(counts *[64]int, buf []uint64, leading bool)
+	name          string
+	available     bool
+}
+
+// optimal count8onehot implementation selected at runtime
+var count8onehotfunc = func() func(*[8]int, []uint8, bool) {
+	for _, f := range count8onehotfuncs {
+		if f.available {
+			return f.count8onehot
+		}
+	}
+
+	panic("no implementation of count8onehot available")
+}()
+
+// optimal count16onehot implementation selected at runtime
+var count16onehotfunc = func() func(*[16]int, []uint16, bool) {
+	for _, f := range count16onehotfuncs {
+		if f.available {
+			return f.count16onehot
+		}
+	}
+
+	panic("no implementation of count16onehot available")
+}()
+
+// optimal count32onehot implementation selected at runtime
+var count32onehotfunc = func() func(*[32]int, []uint32, bool) {
+	for _, f := range count32onehotfuncs {
+		if f.available {
+			return f.count32onehot
+		}
+	}
+
+	panic("no implementation of count32onehot available")
+}()
+
+// optimal count64onehot implementation selected at runtime
+var count64onehotfunc = func() func(*[64]int, []uint64, bool) {
+	for _, f := range count64onehotfuncs {
+		if f.available {
+			return f.count64onehot
+		}
+	}
+
+	panic("no implementation of count64onehot available")
+}()
+
+// add the number of elements of buf with k bits set to hist[k]
+func popcountHistogram[T word](hist []int, buf []T) {
+	for _, x := range buf {
+		hist[bits.OnesCount64(uint64(x))]++
+	}
+}
+
+// Compute the positional population count and the popcount histogram
+// of buf in a single pass.  The kernels process the leading elements
+// making up a multiple of 8 bytes, histogramming each block as they
+// load it, the remaining elements are added one at a time.
+func countHistogram[T word](counts []int, hist []int, buf []T) {
+	var zero T
+
+	size := int(unsafe.Sizeof(zero))
+	n := len(buf) &^ (8/size - 1)
+	data := unsafe.Pointer(unsafe.SliceData(buf))
+	switch size {
+	case 1:
+		count8histfunc((*[8]int)(counts), (*[9]int)(hist), unsafe.Slice((*uint8)(data), n))
+	case 2:
+		count16histfunc((*[16]int)(counts), (*[17]int)(hist), unsafe.Slice((*uint16)(data), n))
+	case 4:
+		count32histfunc((*[32]int)(counts), (*[33]int)(hist), unsafe.Slice((*uint32)(data), n))
+	case 8:
+		count64histfunc((*[64]int)(counts), (*[65]int)(hist), unsafe.Slice((*uint64)(data), n))
+	}
+
+	addBits(counts, buf[n:])
+	popcountHistogram(hist, buf[n:])
+}
+
+// Compute the histogram of the number of leading (or if leading is
+// false, trailing) zeros of the elements of buf and add it to hist.
+// The kernels reduce each element to a one-hot word holding just its
+// highest (lowest) set bit as they load it, so the positional counts
+// of these words are the histogram.  Zero elements reduce to zero and
+// are accounted for at the end.
+func zerosHistogram[T word](hist []int, buf []T, leading bool) {
+	var zero T
+	var counts [64]int
+	var tail [7]T
+
+	size := int(unsafe.Sizeof(zero))
+	n := len(buf) &^ (8/size - 1)
+	data := unsafe.Pointer(unsafe.SliceData(buf))
+	switch size {
+	case 1:
+		count8onehotfunc((*[8]int)(counts[:]), unsafe.Slice((*uint8)(data), n), leading)
+	case 2:
+		count16onehotfunc((*[16]int)(counts[:]), unsafe.Slice((*uint16)(data), n), leading)
+	case 4:
+		count32onehotfunc((*[32]int)(counts[:]), unsafe.Slice((*uint32)(data), n), leading)
+	case 8:
+		count64onehotfunc((*[64]int)(counts[:]), unsafe.Slice((*uint64)(data), n), leading)
+	}
+
+	nbits := 8 * size
+	k := onehot(tail[:], buf[n:], leading)
+	addBits(counts[:nbits], tail[:k])
+
+	total := 0
+	for j := 0; j < nbits; j++ {
+		total += counts[j]
+		if leading {
+			hist[nbits-1-j] += counts[j]
+		} else {
+			hist[j] += counts[j]
+		}
+	}
+
+	hist[nbits] += len(buf) - total
+}
+
+// set dst[i] to the highest (if leading is set) or lowest set bit of
+// buf[i] for as many elements as fit into dst and return their number
+func onehot[T word](dst, buf []T, leading bool) int {
+	n := copy(dst, buf)
+	for i, x := range dst[:n] {
+		if leading {
+			dst[i] = T(uint64(1<<63) >> bits.LeadingZeros64(uint64(x)))
+		} else {
+			dst[i] = x & -x
+		}
+	}
+
+	return n
+}
+
+// Compute the histogram of the number of bits set in each value in
+// buf and add the results to hist: hist[k] is incremented for every
+// value with exactly k bits set.
+func PopcountHistogram8(hist *[9]int, buf []uint8) {
+	popcountHistogram(hist[:], buf)
+}
+
+// Like Count8, but also compute the popcount histogram of buf as with
+// PopcountHistogram8.  Each block of buf is histogrammed as the
+// kernels load it, so buf is read from memory only once.
+func CountHistogram8(counts *[8]int, hist *[9]int, buf []uint8) {
+	countHistogram(counts[:], hist[:], buf)
+}
+
+// Compute the histogram of the number of bits set in each value in
+// buf and add the results to hist: hist[k] is incremented for every
+// value with exactly k bits set.
+func PopcountHistogram16(hist *[17]int, buf []uint16) {
+	popcountHistogram(hist[:], buf)
+}
+
+// Like Count16, but also compute the popcount histogram of buf as with
+// PopcountHistogram16.  Each block of buf is histogrammed as the
+// kernels load it, so buf is read from memory only once.
+func CountHistogram16(counts *[16]int, hist *[17]int, buf []uint16) {
+	countHistogram(counts[:], hist[:], buf)
+}
+
+// Compute the histogram of the number of bits set in each value in
+// buf and add the results to hist: hist[k] is incremented for every
+// value with exactly k bits set.
+func PopcountHistogram32(hist *[33]int, buf []uint32) {
+	popcountHistogram(hist[:], buf)
+}
+
+// Like Count32, but also compute the popcount histogram of buf as with
+// PopcountHistogram32.  Each block of buf is histogrammed as the
+// kernels load it, so buf is read from memory only once.
+func CountHistogram32(counts *[32]int, hist *[33]int, buf []uint32) {
+	countHistogram(counts[:], hist[:], buf)
+}
+
+// Compute the histogram of the number of bits set in each value in
+// buf and add the results to hist: hist[k] is incremented for every
+// value with exactly k bits set.
+func PopcountHistogram64(hist *[65]int, buf []uint64) {
+	popcountHistogram(hist[:], buf)
+}
+
+// Like Count64, but also compute the popcount histogram of buf as with
+// PopcountHistogram64.  Each block of buf is histogrammed as the
+// kernels load it, so buf is read from memory only once.
+func CountHistogram64(counts *[64]int, hist *[65]int, buf []uint64) {
+	countHistogram(counts[:], hist[:], buf)
+}
+
+// Compute the histogram of the number of leading zeros of the values in
+// buf and add the results to hist: hist[k] is incremented for every
+// value x with bits.LeadingZeros8(x) == k.  Each value is reduced to a
+// one-hot word holding just its highest set bit as it is loaded.
+func LeadingZerosHistogram8(hist *[9]int, buf []uint8) {
+	zerosHistogram(hist[:], buf, true)
+}
+
+// Compute the histogram of the number of trailing zeros of the values in
+// buf and add the results to hist: hist[k] is incremented for every
+// value x with bits.TrailingZeros8(x) == k.  Each value is reduced to a
+// one-hot word holding just its lowest set bit as it is loaded.
+func TrailingZerosHistogram8(hist *[9]int, buf []uint8) {
+	zerosHistogram(hist[:], buf, false)
+}
+
+// Compute the histogram of the number of leading zeros of the values in
+// buf and add the results to hist: hist[k] is incremented for every
+// value x with bits.LeadingZeros16(x) == k.  Each value is reduced to a
+// one-hot word holding just its highest set bit as it is loaded.
+func LeadingZerosHistogram16(hist *[17]int, buf []uint16) {
+	zerosHistogram(hist[:], buf, true)
+}
+
+// Compute the histogram of the number of trailing zeros of the values in
+// buf and add the results to hist: hist[k] is incremented for every
+// value x with bits.TrailingZeros16(x) == k.  Each value is reduced to a
+// one-hot word holding just its lowest set bit as it is loaded.
+func TrailingZerosHistogram16(hist *[17]int, buf []uint16) {
+	zerosHistogram(hist[:], buf, false)
+}
+
+// Compute the histogram of the number of leading zeros of the values in
+// buf and add the results to hist: hist[k] is incremented for every
+// value x with bits.LeadingZeros32(x) == k.  Each value is reduced to a
+// one-hot word holding just its highest set bit as it is loaded.
+func LeadingZerosHistogram32(hist *[33]int, buf []uint32) {
+	zerosHistogram(hist[:], buf, true)
+}
+
+// Compute the histogram of the number of trailing zeros of the values in
+// buf and add the results to hist: hist[k] is incremented for every
+// value x with bits.TrailingZeros32(x) == k.  Each value is reduced to a
+// one-hot word holding just its lowest set bit as it is loaded.
+func TrailingZerosHistogram32(hist *[33]int, buf []uint32) {
+	zerosHistogram(hist[:], buf, false)
+}
+
+// Compute the histogram of the number of leading zeros of the values in
+// buf and add the results to hist: hist[k] is incremented for every
+// value x with bits.LeadingZeros64(x) == k.  Each value is reduced to a
+// one-hot word holding just its highest set bit as it is loaded.
+func LeadingZerosHistogram64(hist *[65]int, buf []uint64) {
+	zerosHistogram(hist[:], buf, true)
+}
+
+// Compute the histogram of the number of trailing zeros of the values in
+// buf and add the results to hist: hist[k] is incremented for every
+// value x with bits.TrailingZeros64(x) == k.  Each value is reduced to a
+// one-hot word holding just its lowest set bit as it is loaded.
+func TrailingZerosHistogram64(hist *[65]int, buf []uint64) {
+	zerosHistogram(hist[:], buf, false)
+}
@@ -0,0 +1,284 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/bits"
+	"math/rand"
+	"testing"
+	"unsafe"
+)
+
+// test the correctness of PopcountHistogram64 and CountHistogram64
+func TestCountHistogram64(t *testing.T) {
+	for _, len := range testLengths {
+		buf := make([]uint64, len)
+		for i := range buf {
+			buf[i] = rand.Uint64() & rand.Uint64()
+		}
+
+		var counts, refCounts [64]int
+		var hist, hist2, refHist [65]int
+		randomCounts(counts[:])
+		randomCounts(hist[:])
+		refCounts, refHist, hist2 = counts, hist, hist
+
+		CountHistogram64(&counts, &hist, buf)
+		PopcountHistogram64(&hist2, buf)
+		count64safe(&refCounts, buf)
+		for _, x := range buf {
+			refHist[bits.OnesCount64(x)]++
+		}
+
+		if counts != refCounts {
+			t.Errorf("length %d: counts don't match: %v\n", len, countDiff(counts[:], refCounts[:]))
+		}
+
+		if hist != refHist {
+			t.Errorf("length %d: histogram doesn't match: %v\n", len, countDiff(hist[:], refHist[:]))
+		}
+
+		if hist2 != refHist {
+			t.Errorf("length %d: PopcountHistogram64 doesn't match: %v\n", len, countDiff(hist2[:], refHist[:]))
+		}
+	}
+}
+
+// test PopcountHistogram8 on a simple example
+func TestPopcountHistogram8(t *testing.T) {
+	var hist [9]int
+	PopcountHistogram8(&hist, []uint8{0x00, 0x01, 0x03, 0x05, 0xff})
+	if hist != [9]int{1, 1, 2, 0, 0, 0, 0, 0, 1} {
+		t.Errorf("wrong histogram: %v", hist)
+	}
+}
+
+// test the correctness of LeadingZerosHistogram64 and
+// TrailingZerosHistogram64
+func TestZerosHistogram64(t *testing.T) {
+	for _, len := range testLengths {
+		buf := make([]uint64, len)
+		for i := range buf {
+			// geometric distribution of leading and trailing zeros
+			buf[i] = rand.Uint64() >> rand.Intn(65) << rand.Intn(65)
+		}
+
+		var lz, tz, refLz, refTz [65]int
+		randomCounts(lz[:])
+		randomCounts(tz[:])
+		refLz, refTz = lz, tz
+
+		LeadingZerosHistogram64(&lz, buf)
+		TrailingZerosHistogram64(&tz, buf)
+		for _, x := range buf {
+			refLz[bits.LeadingZeros64(x)]++
+			refTz[bits.TrailingZeros64(x)]++
+		}
+
+		if lz != refLz {
+			t.Errorf("length %d: leading zeros don't match: %v\n", len, countDiff(lz[:], refLz[:]))
+		}
+
+		if tz != refTz {
+			t.Errorf("length %d: trailing zeros don't match: %v\n", len, countDiff(tz[:], refTz[:]))
+		}
+	}
+}
+
+// test the correctness of LeadingZerosHistogram8 and
+// TrailingZerosHistogram8 for all inputs
+func TestZerosHistogram8(t *testing.T) {
+	buf := make([]uint8, 256)
+	for i := range buf {
+		buf[i] = uint8(i)
+	}
+
+	var lz, tz, refLz, refTz [9]int
+	LeadingZerosHistogram8(&lz, buf)
+	TrailingZerosHistogram8(&tz, buf)
+	for _, x := range buf {
+		refLz[bits.LeadingZeros8(x)]++
+		refTz[bits.TrailingZeros8(x)]++
+	}
+
+	if lz != refLz {
+		t.Errorf("leading zeros don't match: %v\n", countDiff(lz[:], refLz[:]))
+	}
+
+	if tz != refTz {
+		t.Errorf("trailing zeros don't match: %v\n", countDiff(tz[:], refTz[:]))
+	}
+}
+
+// test the correctness of a count#hist kernel on whole qwords
+func testCountHistKernel[T word](t *testing.T, count func(counts, hist []int, buf []T)) {
+	var zero T
+	nbits := 8 * int(unsafe.Sizeof(zero))
+
+	for _, len := range testLengths {
+		len &^= 8/int(unsafe.Sizeof(zero)) - 1 // whole qwords only
+		buf := make([]T, len+1)[1:]
+		for i := range buf {
+			buf[i] = T(rand.Uint64() >> rand.Intn(65) << rand.Intn(65))
+		}
+
+		counts := make([]int, nbits)
+		randomCounts(counts)
+		refCounts := append([]int(nil), counts...)
+		hist := make([]int, nbits+1)
+		randomCounts(hist)
+		refHist := append([]int(nil), hist...)
+
+		count(counts, hist, buf)
+		for _, x := range buf {
+			for j := range refCounts {
+				refCounts[j] += int(uint64(x) >> j & 1)
+			}
+
+			refHist[bits.OnesCount64(uint64(x))]++
+		}
+
+		if !equalCounts(counts, refCounts) {
+			t.Errorf("length %d: counts don't match: %v\n", len, countDiff(counts, refCounts))
+		}
+
+		if !equalCounts(hist, refHist) {
+			t.Errorf("length %d: histograms don't match: %v\n", len, countDiff(hist, refHist))
+		}
+	}
+}
+
+// test the correctness of all count#hist implementations
+func TestCountHistKernels(t *testing.T) {
+	for i := range count8histfuncs {
+		t.Run("8/"+count8histfuncs[i].name, func(tt *testing.T) {
+			if !count8histfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountHistKernel(tt, func(counts, hist []int, buf []uint8) {
+				count8histfuncs[i].count8hist((*[8]int)(counts), (*[9]int)(hist), buf)
+			})
+		})
+	}
+
+	for i := range count16histfuncs {
+		t.Run("16/"+count16histfuncs[i].name, func(tt *testing.T) {
+			if !count16histfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountHistKernel(tt, func(counts, hist []int, buf []uint16) {
+				count16histfuncs[i].count16hist((*[16]int)(counts), (*[17]int)(hist), buf)
+			})
+		})
+	}
+
+	for i := range count32histfuncs {
+		t.Run("32/"+count32histfuncs[i].name, func(tt *testing.T) {
+			if !count32histfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountHistKernel(tt, func(counts, hist []int, buf []uint32) {
+				count32histfuncs[i].count32hist((*[32]int)(counts), (*[33]int)(hist), buf)
+			})
+		})
+	}
+
+	for i := range count64histfuncs {
+		t.Run("64/"+count64histfuncs[i].name, func(tt *testing.T) {
+			if !count64histfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountHistKernel(tt, func(counts, hist []int, buf []uint64) {
+				count64histfuncs[i].count64hist((*[64]int)(counts), (*[65]int)(hist), buf)
+			})
+		})
+	}
+}
+
+// test the correctness of a count#onehot kernel on whole qwords
+func testCountOnehotKernel[T word](t *testing.T, count func(counts []int, buf []T, leading bool)) {
+	var zero T
+	nbits := 8 * int(unsafe.Sizeof(zero))
+
+	for _, leading := range []bool{false, true} {
+		for _, len := range testLengths {
+			len &^= 8/int(unsafe.Sizeof(zero)) - 1 // whole qwords only
+			buf := make([]T, len+1)[1:]
+			for i := range buf {
+				buf[i] = T(rand.Uint64() >> rand.Intn(65) << rand.Intn(65))
+			}
+
+			counts := make([]int, nbits)
+			randomCounts(counts)
+			refCounts := append([]int(nil), counts...)
+
+			c := make([]T, len)
+			onehot(c, buf, leading)
+			count(counts, buf, leading)
+			for _, x := range c {
+				for j := range refCounts {
+					refCounts[j] += int(uint64(x) >> j & 1)
+				}
+			}
+
+			if !equalCounts(counts, refCounts) {
+				t.Errorf("leading %v, length %d: counts don't match: %v\n", leading, len, countDiff(counts, refCounts))
+			}
+		}
+	}
+}
+
+// test the correctness of all count#onehot implementations
+func TestCountOnehotKernels(t *testing.T) {
+	for i := range count8onehotfuncs {
+		t.Run("8/"+count8onehotfuncs[i].name, func(tt *testing.T) {
+			if !count8onehotfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountOnehotKernel(tt, func(counts []int, buf []uint8, leading bool) {
+				count8onehotfuncs[i].count8onehot((*[8]int)(counts), buf, leading)
+			})
+		})
+	}
+
+	for i := range count16onehotfuncs {
+		t.Run("16/"+count16onehotfuncs[i].name, func(tt *testing.T) {
+			if !count16onehotfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountOnehotKernel(tt, func(counts []int, buf []uint16, leading bool) {
+				count16onehotfuncs[i].count16onehot((*[16]int)(counts), buf, leading)
+			})
+		})
+	}
+
+	for i := range count32onehotfuncs {
+		t.Run("32/"+count32onehotfuncs[i].name, func(tt *testing.T) {
+			if !count32onehotfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountOnehotKernel(tt, func(counts []int, buf []uint32, leading bool) {
+				count32onehotfuncs[i].count32onehot((*[32]int)(counts), buf, leading)
+			})
+		})
+	}
+
+	for i := range count64onehotfuncs {
+		t.Run("64/"+count64onehotfuncs[i].name, func(tt *testing.T) {
+			if !count64onehotfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountOnehotKernel(tt, func(counts []int, buf []uint64, leading bool) {
+				count64onehotfuncs[i].count64onehot((*[64]int)(counts), buf, leading)
+			})
+		})
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import "unsafe"
+
+// Size of the largest kernel block in bytes.  The checkpoints of an
+// index are placed at multiples of this size so the kernels never
+// have to process partial blocks between two checkpoints.
+const indexBlockSize = 960
+
+// Default distance between two checkpoints of an index, in kernel
+// blocks.  For uint64 elements, this is a memory overhead of about 3%.
+const indexDefaultBlocks = 16
+
+// index for fast positional population counts of subranges of buf.
+// Checkpoint k holds the positional population count of
+// buf[:k*stride], with the counters of all checkpoints stored
+// consecutively in checkpoints.
+type index[T Element] struct {
+	buf         []T
+	checkpoints []int
+	stride      int
+}
+
+func newIndex[T Element](buf []T, stride int) index[T] {
+	var zero T
+	size := int(unsafe.Sizeof(zero))
+	bits := 8 * size
+	block := indexBlockSize / size
+
+	if stride < 0 {
+		panic("pospop: negative index block length")
+	} else if stride == 0 {
+		stride = indexDefaultBlocks * block
+	} else {
+		stride = (stride + block - 1) / block * block
+	}
+
+	n := len(buf)/stride + 1
+	idx := index[T]{buf, make([]int, n*bits), stride}
+	for k := 1; k < n; k++ {
+		cp := idx.checkpoints[k*bits : (k+1)*bits]
+		copy(cp, idx.checkpoints[(k-1)*bits:k*bits])
+		Count(cp, buf[(k-1)*stride:k*stride])
+	}
+
+	return idx
+}
+
+// add the positional population count of buf[i:j] to counts
+func (idx *index[T]) count(counts []int, i, j int) {
+	if i < 0 || i > j || j > len(idx.buf) {
+		panic("pospop: index range out of bounds")
+	}
+
+	// short range?  Count directly.
+	if j-i <= idx.stride {
+		Count(counts, idx.buf[i:j])
+		return
+	}
+
+	// otherwise compute P(j) - P(i) where P(x) is the count of
+	// buf[:x], derived from the checkpoint closest to x
+	idx.prefix(counts, j, false)
+	idx.prefix(counts, i, true)
+}
+
+// add (or if negate is set, subtract) the positional population count
+// of buf[:x] to counts, using the checkpoint closest to x.
+func (idx *index[T]) prefix(counts []int, x int, negate bool) {
+	bits := len(counts)
+	k := (x + idx.stride/2) / idx.stride
+	if k >= len(idx.checkpoints)/bits {
+		k--
+	}
+
+	base := k * idx.stride
+	cp := idx.checkpoints[k*bits : (k+1)*bits]
+	if negate {
+		subCounts(counts, cp)
+	} else {
+		addCounts(counts, cp)
+	}
+
+	var seg []T
+	if base <= x {
+		seg = idx.buf[base:x]
+	} else {
+		seg = idx.buf[x:base]
+	}
+
+	if (base <= x) != negate {
+		Count(counts, seg)
+	} else {
+		uncount(counts, seg)
+	}
+}
+
+// memory used by the checkpoints in bytes
+func (idx *index[T]) overhead() int {
+	return len(idx.checkpoints) * int(unsafe.Sizeof(int(0)))
+}
+
+// Index8 is an index over an immutable buffer of uint8 values for
+// computing the positional population count of arbitrary subranges in
+// time proportional to the index block length, independent of the
+// range length.  The index stores the positional population count of
+// the buffer up to every multiple of the block length.
+type Index8 struct {
+	idx index[uint8]
+}
+
+// NewIndex8 builds an index over buf with checkpoints every blockLen
+// elements.  The block length trades query time for memory: each
+// checkpoint takes 8 ints.  It is rounded up to a multiple of the
+// kernel block size of 960 elements.  If blockLen is 0, a default of
+// 15360 elements is used.  The contents of buf must not be modified
+// while the index is in use.
+func NewIndex8(buf []uint8, blockLen int) *Index8 {
+	return &Index8{newIndex(buf, blockLen)}
+}
+
+// Count the number of corresponding set bits of the values in
+// buf[i:j] and add the results to counts, as if by Count8.  Count
+// panics if the range is out of bounds.
+func (x *Index8) Count(counts *[8]int, i, j int) {
+	x.idx.count(counts[:], i, j)
+}
+
+// Len returns the length of the indexed buffer.
+func (x *Index8) Len() int {
+	return len(x.idx.buf)
+}
+
+// BlockLen returns the distance between two checkpoints in elements.
+func (x *Index8) BlockLen() int {
+	return x.idx.stride
+}
+
+// Overhead returns the memory used by the index, not counting the
+// indexed buffer, in bytes.
+func (x *Index8) Overhead() int {
+	return x.idx.overhead()
+}
+
+// Index16 is an index over an immutable buffer of uint16 values for
+// computing the positional population count of arbitrary subranges in
+// time proportional to the index block length, independent of the
+// range length.  The index stores the positional population count of
+// the buffer up to every multiple of the block length.
+type Index16 struct {
+	idx index[uint16]
+}
+
+// NewIndex16 builds an index over buf with checkpoints every blockLen
+// elements.  The block length trades query time for memory: each
+// checkpoint takes 16 ints.  It is rounded up to a multiple of the
+// kernel block size of 480 elements.  If blockLen is 0, a default of
+// 7680 elements is used.  The contents of buf must not be modified
+// while the index is in use.
+func NewIndex16(buf []uint16, blockLen int) *Index16 {
+	return &Index16{newIndex(buf, blockLen)}
+}
+
+// Count the number of corresponding set bits of the values in
+// buf[i:j] and add the results to counts, as if by Count16.  Count
+// panics if the range is out of bounds.
+func (x *Index16) Count(counts *[16]int, i, j int) {
+	x.idx.count(counts[:], i, j)
+}
+
+// Len returns the length of the indexed buffer.
+func (x *Index16) Len() int {
+	return len(x.idx.buf)
+}
+
+// BlockLen returns the distance between two checkpoints in elements.
+func (x *Index16) BlockLen() int {
+	return x.idx.stride
+}
+
+// Overhead returns the memory used by the index, not counting the
+// indexed buffer, in bytes.
+func (x *Index16) Overhead() int {
+	return x.idx.overhead()
+}
+
+// Index32 is an index over an immutable buffer of uint32 values for
+// computing the positional population count of arbitrary subranges in
+// time proportional to the index block length, independent of the
+// range length.  The index stores the positional population count of
+// the buffer up to every multiple of the block length.
+type Index32 struct {
+	idx index[uint32]
+}
+
+// NewIndex32 builds an index over buf with checkpoints every blockLen
+// elements.  The block length trades query time for memory: each
+// checkpoint takes 32 ints.  It is rounded up to a multiple of the
+// kernel block size of 240 elements.  If blockLen is 0, a default of
+// 3840 elements is used.  The contents of buf must not be modified
+// while the index is in use.
+func NewIndex32(buf []uint32, blockLen int) *Index32 {
+	return &Index32{newIndex(buf, blockLen)}
+}
+
+// Count the number of corresponding set bits of the values in
+// buf[i:j] and add the results to counts, as if by Count32.  Count
+// panics if the range is out of bounds.
+func (x *Index32) Count(counts *[32]int, i, j int) {
+	x.idx.count(counts[:], i, j)
+}
+
+// Len returns the length of the indexed buffer.
+func (x *Index32) Len() int {
+	return len(x.idx.buf)
+}
+
+// BlockLen returns the distance between two checkpoints in elements.
+func (x *Index32) BlockLen() int {
+	return x.idx.stride
+}
+
+// Overhead returns the memory used by the index, not counting the
+// indexed buffer, in bytes.
+func (x *Index32) Overhead() int {
+	return x.idx.overhead()
+}
+
+// Index64 is an index over an immutable buffer of uint64 values for
+// computing the positional population count of arbitrary subranges in
+// time proportional to the index block length, independent of the
+// range length.  The index stores the positional population count of
+// the buffer up to every multiple of the block length.
+type Index64 struct {
+	idx index[uint64]
+}
+
+// NewIndex64 builds an index over buf with checkpoints every blockLen
+// elements.  The block length trades query time for memory: each
+// checkpoint takes 64 ints.  It is rounded up to a multiple of the
+// kernel block size of 120 elements.  If blockLen is 0, a default of
+// 1920 elements is used.  The contents of buf must not be modified
+// while the index is in use.
+func NewIndex64(buf []uint64, blockLen int) *Index64 {
+	return &Index64{newIndex(buf, blockLen)}
+}
+
+// Count the number of corresponding set bits of the values in
+// buf[i:j] and add the results to counts, as if by Count64.  Count
+// panics if the range is out of bounds.
+func (x *Index64) Count(counts *[64]int, i, j int) {
+	x.idx.count(counts[:], i, j)
+}
+
+// Len returns the length of the indexed buffer.
+func (x *Index64) Len() int {
+	return len(x.idx.buf)
+}
+
+// BlockLen returns the distance between two checkpoints in elements.
+func (x *Index64) BlockLen() int {
+	return x.idx.stride
+}
+
+// Overhead returns the memory used by the index, not counting the
+// indexed buffer, in bytes.
+func (x *Index64) Overhead() int {
+	return x.idx.overhead()
+}
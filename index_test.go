@@ -0,0 +1,61 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// test the correctness of Index64 queries over random ranges
+func TestIndex64(t *testing.T) {
+	buf := make([]uint64, 5000)
+	for i := range buf {
+		buf[i] = rand.Uint64()
+	}
+
+	for _, blockLen := range []int{0, 1, 120, 500} {
+		for _, n := range []int{0, 1, 119, 120, 121, 1919, 1920, 1921, len(buf)} {
+			idx := NewIndex64(buf[:n], blockLen)
+			if idx.Len() != n || idx.BlockLen()%120 != 0 || idx.Overhead() <= 0 {
+				t.Errorf("block length %d, length %d: inconsistent index", blockLen, n)
+			}
+
+			for q := 0; q < 100; q++ {
+				i, j := rand.Intn(n+1), rand.Intn(n+1)
+				if i > j {
+					i, j = j, i
+				}
+
+				var counts, refCounts [64]int
+				randomCounts(counts[:])
+				refCounts = counts
+
+				idx.Count(&counts, i, j)
+				count64safe(&refCounts, buf[i:j])
+				if counts != refCounts {
+					t.Errorf("block length %d, length %d, range [%d, %d): counts don't match: %v\n",
+						blockLen, n, i, j, countDiff(counts[:], refCounts[:]))
+				}
+			}
+		}
+	}
+}
+
+// test the correctness of Index8 at the boundaries
+func TestIndex8(t *testing.T) {
+	buf := make([]uint8, 4*960+17)
+	rand.Read(buf)
+
+	idx := NewIndex8(buf, 960)
+	for _, i := range []int{0, 1, 479, 480, 481, 959, 960, 961} {
+		for _, j := range []int{len(buf), len(buf) - 1, len(buf) - 17, len(buf) - 18, 2 * 960} {
+			var counts, refCounts [8]int
+			idx.Count(&counts, i, j)
+			count8safe(&refCounts, buf[i:j])
+			if counts != refCounts {
+				t.Errorf("range [%d, %d): counts don't match: %v\n", i, j, countDiff(counts[:], refCounts[:]))
+			}
+		}
+	}
+}
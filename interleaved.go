@@ -0,0 +1,93 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import "unsafe"
+
+// true if the host stores values in little endian byte order
+var littleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// count the interleaved channels of buf into per-channel counters
+// counts[c*bits:(c+1)*bits].  The bytes of buf are counted in place as
+// a stream of frames of channels*size bytes, which gives per-byte
+// counters for each byte of a frame.  On little endian hosts, these
+// are exactly the per-channel counters.  On big endian hosts, the
+// bytes of each element are in reverse order and the counters are
+// permuted accordingly.
+func countInterleaved[T Element](counts []int, buf []T, channels int) {
+	var zero T
+	size := int(unsafe.Sizeof(zero))
+	bits := 8 * size
+
+	if channels <= 0 {
+		panic("pospop: number of channels must be positive")
+	}
+
+	if len(counts) < channels*bits {
+		panic("pospop: too few channel counters")
+	}
+
+	data := unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(buf))), len(buf)*size)
+	if littleEndian {
+		countByteSlots(counts[:channels*bits], data, channels*size)
+		return
+	}
+
+	slots := make([]int, channels*bits)
+	countByteSlots(slots, data, channels*size)
+	for s := 0; s < channels*size; s++ {
+		c, b := s/size, size-1-s%size
+		addCounts(counts[c*bits+8*b:c*bits+8*b+8], slots[8*s:8*s+8])
+	}
+}
+
+// Count the number of corresponding set bits of the values in buf,
+// which holds the given number of interleaved channels, and add the
+// results for each channel c to counts[c] as with Count8.  Element i
+// of buf belongs to channel i % channels.  If len(buf) is not a
+// multiple of channels, the elements of the final partial frame are
+// counted into their respective channels.  CountInterleaved8 panics
+// if channels is not positive or if counts has fewer than channels
+// elements.
+func CountInterleaved8(counts [][8]int, buf []uint8, channels int) {
+	countInterleaved(flatCounts(counts), buf, channels)
+}
+
+// Count the number of corresponding set bits of the values in buf,
+// which holds the given number of interleaved channels, and add the
+// results for each channel c to counts[c] as with Count16.  Element i
+// of buf belongs to channel i % channels.  If len(buf) is not a
+// multiple of channels, the elements of the final partial frame are
+// counted into their respective channels.  CountInterleaved16 panics
+// if channels is not positive or if counts has fewer than channels
+// elements.
+func CountInterleaved16(counts [][16]int, buf []uint16, channels int) {
+	countInterleaved(flatCounts(counts), buf, channels)
+}
+
+// Count the number of corresponding set bits of the values in buf,
+// which holds the given number of interleaved channels, and add the
+// results for each channel c to counts[c] as with Count32.  Element i
+// of buf belongs to channel i % channels.  If len(buf) is not a
+// multiple of channels, the elements of the final partial frame are
+// counted into their respective channels.  CountInterleaved32 panics
+// if channels is not positive or if counts has fewer than channels
+// elements.
+func CountInterleaved32(counts [][32]int, buf []uint32, channels int) {
+	countInterleaved(flatCounts(counts), buf, channels)
+}
+
+// Count the number of corresponding set bits of the values in buf,
+// which holds the given number of interleaved channels, and add the
+// results for each channel c to counts[c] as with Count64.  Element i
+// of buf belongs to channel i % channels.  If len(buf) is not a
+// multiple of channels, the elements of the final partial frame are
+// counted into their respective channels.  CountInterleaved64 panics
+// if channels is not positive or if counts has fewer than channels
+// elements.
+func CountInterleaved64(counts [][64]int, buf []uint64, channels int) {
+	countInterleaved(flatCounts(counts), buf, channels)
+}
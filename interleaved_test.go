@@ -0,0 +1,64 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// test the correctness of CountInterleaved8 for various channel counts
+// and both aligned and misaligned buffers
+func TestCountInterleaved8(t *testing.T) {
+	for _, channels := range []int{1, 2, 3, 4, 6, 8, 9} {
+		for _, len := range testLengths {
+			for _, offset := range []int{0, 1} {
+				buf := make([]uint8, len+offset)
+				rand.Read(buf)
+				buf = buf[offset:]
+
+				counts := make([][8]int, channels)
+				for c := range counts {
+					randomCounts(counts[c][:])
+				}
+
+				refCounts := append([][8]int(nil), counts...)
+				CountInterleaved8(counts, buf, channels)
+				for i := range buf {
+					count8safe(&refCounts[i%channels], buf[i:i+1])
+				}
+
+				for c := range counts {
+					if counts[c] != refCounts[c] {
+						t.Errorf("%d channels, length %d, offset %d, channel %d: counts don't match: %v\n",
+							channels, len, offset, c, countDiff(counts[c][:], refCounts[c][:]))
+					}
+				}
+			}
+		}
+	}
+}
+
+// test the correctness of CountInterleaved16 for stereo and 5.1 data
+func TestCountInterleaved16(t *testing.T) {
+	for _, channels := range []int{2, 6} {
+		buf := make([]uint16, 6000+1)
+		for i := range buf {
+			buf[i] = uint16(rand.Int())
+		}
+
+		counts := make([][16]int, channels)
+		refCounts := make([][16]int, channels)
+		CountInterleaved16(counts, buf, channels)
+		for i := range buf {
+			count16safe(&refCounts[i%channels], buf[i:i+1])
+		}
+
+		for c := range counts {
+			if counts[c] != refCounts[c] {
+				t.Errorf("%d channels, channel %d: counts don't match: %v\n",
+					channels, c, countDiff(counts[c][:], refCounts[c][:]))
+			}
+		}
+	}
+}
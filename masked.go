@@ -0,0 +1,178 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import "unsafe"
+
+// each platform must provide arrays count8maskedfuncs,
+// count16maskedfuncs, count32maskedfuncs, and count64maskedfuncs of
+// type count8maskedimpl, ... listing kernels analogous to count8funcs
+// and friends that only count buf[i] if bit i of valid is set, zeroing
+// the other elements as they are loaded.  The caller ensures that
+// len(buf) is a multiple of 8 and that valid holds len(buf)/8 bytes.
+
+type count8maskedimpl struct {
+	count8masked func(counts *[8]int, buf []uint8, valid []byte)
+	name         string
+	available    bool
+}
+
+type count16maskedimpl struct {
+	count16masked func(counts *[16]int, buf []uint16, valid []byte)
+	name          string
+	available     bool
+}
+
+type count32maskedimpl struct {
+	count32masked func(counts *[32]int, buf []uint32, valid []byte)
+	name          string
+	available     bool
+}
+
+type count64maskedimpl struct {
+	count64masked func(counts *[64]int, buf []uint64, valid []byte)
+	name          string
+	available     bool
+}
+
+// optimal count8masked implementation selected at runtime
+var count8maskedfunc = func() func(*[8]int, []uint8, []byte) {
+	for _, f := range count8maskedfuncs {
+		if f.available {
+			return f.count8masked
+		}
+	}
+
+	panic("no implementation of count8masked available")
+}()
+
+// optimal count16masked implementation selected at runtime
+var count16maskedfunc = func() func(*[16]int, []uint16, []byte) {
+	for _, f := range count16maskedfuncs {
+		if f.available {
+			return f.count16masked
+		}
+	}
+
+	panic("no implementation of count16masked available")
+}()
+
+// optimal count32masked implementation selected at runtime
+var count32maskedfunc = func() func(*[32]int, []uint32, []byte) {
+	for _, f := range count32maskedfuncs {
+		if f.available {
+			return f.count32masked
+		}
+	}
+
+	panic("no implementation of count32masked available")
+}()
+
+// optimal count64masked implementation selected at runtime
+var count64maskedfunc = func() func(*[64]int, []uint64, []byte) {
+	for _, f := range count64maskedfuncs {
+		if f.available {
+			return f.count64masked
+		}
+	}
+
+	panic("no implementation of count64masked available")
+}()
+
+// count the elements buf[i] for which bit i of valid is set into
+// counts.  The kernels process the leading elements making up a
+// multiple of 8, the remaining elements are masked and added one at a
+// time.
+func countMasked[T Element](counts []int, buf []T, valid []byte) {
+	var zero T
+
+	if len(valid) < (len(buf)+7)/8 {
+		panic("pospop: validity bitmap too short")
+	}
+
+	n := len(buf) &^ 7
+	data := unsafe.Pointer(unsafe.SliceData(buf))
+	switch unsafe.Sizeof(zero) {
+	case 1:
+		b := unsafe.Slice((*uint8)(data), len(buf))
+		count8maskedfunc((*[8]int)(counts), b[:n], valid[:n/8])
+		addMasked(counts, b[n:], valid[n/8:])
+	case 2:
+		b := unsafe.Slice((*uint16)(data), len(buf))
+		count16maskedfunc((*[16]int)(counts), b[:n], valid[:n/8])
+		addMasked(counts, b[n:], valid[n/8:])
+	case 4:
+		b := unsafe.Slice((*uint32)(data), len(buf))
+		count32maskedfunc((*[32]int)(counts), b[:n], valid[:n/8])
+		addMasked(counts, b[n:], valid[n/8:])
+	case 8:
+		b := unsafe.Slice((*uint64)(data), len(buf))
+		count64maskedfunc((*[64]int)(counts), b[:n], valid[:n/8])
+		addMasked(counts, b[n:], valid[n/8:])
+	default:
+		panic("pospop: unsupported element size")
+	}
+}
+
+// add the fewer than 8 elements buf[i] for which bit i of valid is set
+// to counts one at a time
+func addMasked[T word](counts []int, buf []T, valid []byte) {
+	var tail [7]T
+
+	k := mask(tail[:], buf, valid)
+	addBits(counts, tail[:k])
+}
+
+// set dst[i] = buf[i] if bit i of valid is set and dst[i] = 0 otherwise
+// for as many elements as fit into dst and return their number
+func mask[T word](dst, buf []T, valid []byte) int {
+	n := copy(dst, buf)
+	for i := range dst[:n] {
+		dst[i] &= -T(valid[i/8] >> (i % 8) & 1)
+	}
+
+	return n
+}
+
+// Count the number of corresponding set bits of the bytes in str for
+// which the corresponding bit of valid is set, as with CountMasked8.
+func CountStringMasked(counts *[8]int, str string, valid []byte) {
+	buf := unsafe.Slice(unsafe.StringData(str), len(str))
+	countMasked(counts[:], buf, valid)
+}
+
+// Like Count8, but only count buf[i] if bit i of the validity bitmap
+// valid is set.  The bits of valid are numbered LSB first, i.e. bit i
+// is valid[i/8] >> (i%8) & 1, as in Apache Arrow.  CountMasked8
+// panics if valid holds fewer than len(buf) bits.  The mask is
+// applied as the kernels load buf.
+func CountMasked8(counts *[8]int, buf []uint8, valid []byte) {
+	countMasked(counts[:], buf, valid)
+}
+
+// Like Count16, but only count buf[i] if bit i of the validity bitmap
+// valid is set.  The bits of valid are numbered LSB first, i.e. bit i
+// is valid[i/8] >> (i%8) & 1, as in Apache Arrow.  CountMasked16
+// panics if valid holds fewer than len(buf) bits.  The mask is
+// applied as the kernels load buf.
+func CountMasked16(counts *[16]int, buf []uint16, valid []byte) {
+	countMasked(counts[:], buf, valid)
+}
+
+// Like Count32, but only count buf[i] if bit i of the validity bitmap
+// valid is set.  The bits of valid are numbered LSB first, i.e. bit i
+// is valid[i/8] >> (i%8) & 1, as in Apache Arrow.  CountMasked32
+// panics if valid holds fewer than len(buf) bits.  The mask is
+// applied as the kernels load buf.
+func CountMasked32(counts *[32]int, buf []uint32, valid []byte) {
+	countMasked(counts[:], buf, valid)
+}
+
+// Like Count64, but only count buf[i] if bit i of the validity bitmap
+// valid is set.  The bits of valid are numbered LSB first, i.e. bit i
+// is valid[i/8] >> (i%8) & 1, as in Apache Arrow.  CountMasked64
+// panics if valid holds fewer than len(buf) bits.  The mask is
+// applied as the kernels load buf.
+func CountMasked64(counts *[64]int, buf []uint64, valid []byte) {
+	countMasked(counts[:], buf, valid)
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/rand"
+	"testing"
+	"unsafe"
+)
+
+// generate a random validity bitmap for n elements with a mix of
+// fully valid, fully invalid, and partially valid bytes
+func randomValid(n int) []byte {
+	valid := make([]byte, (n+7)/8)
+	for i := range valid {
+		switch rand.Intn(4) {
+		case 0:
+			valid[i] = 0x00
+		case 1, 2:
+			valid[i] = 0xff
+		case 3:
+			valid[i] = byte(rand.Int())
+		}
+	}
+
+	return valid
+}
+
+// test the correctness of CountMasked64
+func TestCountMasked64(t *testing.T) {
+	for _, len := range testLengths {
+		buf := make([]uint64, len)
+		for i := range buf {
+			buf[i] = rand.Uint64()
+		}
+
+		valid := randomValid(len)
+
+		var counts, refCounts [64]int
+		randomCounts(counts[:])
+		refCounts = counts
+
+		CountMasked64(&counts, buf, valid)
+		for i := range buf {
+			if valid[i/8]>>(i%8)&1 != 0 {
+				count64safe(&refCounts, buf[i:i+1])
+			}
+		}
+
+		if counts != refCounts {
+			t.Errorf("length %d: counts don't match: %v\n", len, countDiff(counts[:], refCounts[:]))
+		}
+	}
+}
+
+// test the correctness of CountMasked8 and CountStringMasked
+func TestCountMasked8(t *testing.T) {
+	buf := make([]uint8, 1000)
+	rand.Read(buf)
+	valid := randomValid(len(buf))
+
+	// stray bits past the end must be ignored
+	valid[len(valid)-1] = 0xff
+
+	var counts, refCounts [8]int
+	CountMasked8(&counts, buf[:997], valid)
+	CountStringMasked(&counts, string(buf[:997]), valid)
+	for i := 0; i < 997; i++ {
+		if valid[i/8]>>(i%8)&1 != 0 {
+			count8safe(&refCounts, buf[i:i+1])
+			count8safe(&refCounts, buf[i:i+1])
+		}
+	}
+
+	if counts != refCounts {
+		t.Errorf("counts don't match: %v\n", countDiff(counts[:], refCounts[:]))
+	}
+}
+
+// test the correctness of a count#masked kernel on whole bytes of the
+// bitmap
+func testCountMaskedKernel[T word](t *testing.T, count func(counts []int, buf []T, valid []byte)) {
+	var zero T
+	nbits := 8 * int(unsafe.Sizeof(zero))
+
+	for _, len := range testLengths {
+		len &^= 7 // whole bytes of valid only
+		buf := make([]T, len+1)[1:]
+		for i := range buf {
+			buf[i] = T(rand.Uint64())
+		}
+
+		valid := randomValid(len)
+
+		counts := make([]int, nbits)
+		randomCounts(counts)
+		refCounts := append([]int(nil), counts...)
+
+		count(counts, buf, valid)
+		for i, x := range buf {
+			if valid[i/8]>>(i%8)&1 != 0 {
+				for j := range refCounts {
+					refCounts[j] += int(uint64(x) >> j & 1)
+				}
+			}
+		}
+
+		if !equalCounts(counts, refCounts) {
+			t.Errorf("length %d: counts don't match: %v\n", len, countDiff(counts, refCounts))
+		}
+	}
+}
+
+// test the correctness of all count#masked implementations
+func TestCountMaskedKernels(t *testing.T) {
+	for i := range count8maskedfuncs {
+		t.Run("8/"+count8maskedfuncs[i].name, func(tt *testing.T) {
+			if !count8maskedfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountMaskedKernel(tt, func(counts []int, buf []uint8, valid []byte) {
+				count8maskedfuncs[i].count8masked((*[8]int)(counts), buf, valid)
+			})
+		})
+	}
+
+	for i := range count16maskedfuncs {
+		t.Run("16/"+count16maskedfuncs[i].name, func(tt *testing.T) {
+			if !count16maskedfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountMaskedKernel(tt, func(counts []int, buf []uint16, valid []byte) {
+				count16maskedfuncs[i].count16masked((*[16]int)(counts), buf, valid)
+			})
+		})
+	}
+
+	for i := range count32maskedfuncs {
+		t.Run("32/"+count32maskedfuncs[i].name, func(tt *testing.T) {
+			if !count32maskedfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountMaskedKernel(tt, func(counts []int, buf []uint32, valid []byte) {
+				count32maskedfuncs[i].count32masked((*[32]int)(counts), buf, valid)
+			})
+		})
+	}
+
+	for i := range count64maskedfuncs {
+		t.Run("64/"+count64maskedfuncs[i].name, func(tt *testing.T) {
+			if !count64maskedfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountMaskedKernel(tt, func(counts []int, buf []uint64, valid []byte) {
+				count64maskedfuncs[i].count64masked((*[64]int)(counts), buf, valid)
+			})
+		})
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"unsafe"
+)
+
+// Number of words of each phase processed at a time by countPhases.
+// This keeps the part of the input being gathered from in cache.
+const phaseChunkLen = 128
+
+// Count words into per-phase counters, with word k counted into
+// phases[(k%period)*64:][:64].  With a period of 1, this is just
+// Count64.  Otherwise, the words of each phase are counted with
+// countStrided, phaseChunkLen words per phase at a time.
+func countPhases(phases []int, words []uint64, period int) {
+	if period == 1 {
+		Count(phases[:64], words)
+		return
+	}
+
+	chunkLen := period * phaseChunkLen
+	for len(words) > 0 {
+		n := len(words)
+		if n > chunkLen {
+			n = chunkLen
+		}
+
+		for r := 0; r < period && r < n; r++ {
+			nr := (n - r + period - 1) / period
+			countStrided[uint64](phases[r*64:(r+1)*64], unsafe.Pointer(&words[r]), uintptr(nr), uintptr(period)*8)
+		}
+
+		words = words[n:]
+	}
+}
+
+// Count the bytes of data as a stream of slots of period bytes each,
+// with byte i counted into slots[8*(i%period):][:8].  The bytes from
+// the first 8 byte aligned address onwards are counted in place as
+// words with countPhases and the counters of each byte lane are added
+// to the slot that lane falls into.  The unaligned head and the
+// partial word at the end are counted byte by byte.
+func countByteSlots(slots []int, data []byte, period int) {
+	head := int(-uintptr(unsafe.Pointer(unsafe.SliceData(data))) % 8)
+	if head > len(data) {
+		head = len(data)
+	}
+
+	nwords := (len(data) - head) / 8
+	tail := head + 8*nwords
+
+	for i := 0; i < head; i++ {
+		count8safe((*[8]int)(slots[8*(i%period):]), data[i:i+1])
+	}
+
+	if nwords > 0 {
+		// words after which the assignment of lanes to slots repeats
+		wperiod := period >> bits.TrailingZeros(uint(period)|8)
+		phases := make([]int, 64*wperiod)
+		words := unsafe.Slice((*uint64)(unsafe.Pointer(&data[head])), nwords)
+		countPhases(phases, words, wperiod)
+
+		for r := 0; r < wperiod; r++ {
+			for lane := 0; lane < 8; lane++ {
+				native := lane
+				if !littleEndian {
+					native = 7 - lane
+				}
+
+				slot := (head + 8*r + lane) % period
+				addCounts(slots[8*slot:8*slot+8], phases[64*r+8*native:64*r+8*native+8])
+			}
+		}
+	}
+
+	for i := tail; i < len(data); i++ {
+		count8safe((*[8]int)(slots[8*(i%period):]), data[i:i+1])
+	}
+}
+
+// Fold per-phase counters into counters for values of width w.  Bit p
+// of a word of phase r is bit 64*r + p of the period, which is bit
+// (64*r + p) % w of some value.
+func foldPhases(counts []int, phases []int, w int) {
+	for i, c := range phases {
+		counts[i%w] += c
+	}
+}
+
+// number of words after which the layout of a stream of w bit values
+// repeats, i.e. lcm(w, 64) / 64
+func packedPeriod(w int) int {
+	return w >> bits.TrailingZeros(uint(w)|64)
+}
+
+// Count the number of corresponding set bits of the first n values of
+// bitWidth bits each packed into data and add the results to counts.
+// The values are packed LSB first: value i occupies bits i*bitWidth to
+// (i+1)*bitWidth-1 of data, where bit b of data is bit b%64 of
+// data[b/64].  Each element of counts keeps track of a different place
+// of the values, with counts[0] for the least significant bit, such
+// that CountPacked(counts, data, 64, n) is equivalent to
+// Count64(counts, data[:n]).  Bits of data after the n values are
+// ignored.
+//
+// If bitWidth divides 64, the words of data are counted by Count64
+// and the counters folded afterwards.  Other bit widths repeat their
+// layout every bitWidth/gcd(bitWidth, 64) words; the words of each
+// phase of that period are gathered and counted separately.
+//
+// CountPacked panics if bitWidth is not between 1 and 64, if counts
+// has fewer than bitWidth elements, or if data holds fewer than n
+// values.
+func CountPacked(counts []int, data []uint64, bitWidth, n int) {
+	if bitWidth < 1 || bitWidth > 64 {
+		panic("pospop: bit width out of range")
+	}
+
+	if len(counts) < bitWidth {
+		panic("pospop: too few counters for bit width")
+	}
+
+	if n < 0 || len(data) < (n*bitWidth+63)/64 {
+		panic("pospop: too few values in data")
+	}
+
+	countPackedWords(counts[:bitWidth], data, n*bitWidth)
+}
+
+// count the first nbits bits of words as packed values of width
+// len(counts)
+func countPackedWords(counts []int, words []uint64, nbits int) {
+	w := len(counts)
+	period := packedPeriod(w)
+	phases := make([]int, 64*period)
+	full := nbits / 64
+
+	countPhases(phases, words[:full], period)
+
+	// partial word at the end
+	if rest := nbits % 64; rest != 0 {
+		r := full % period
+		tail := words[full] & (1<<rest - 1)
+		Count(phases[r*64:(r+1)*64], []uint64{tail})
+	}
+
+	foldPhases(counts, phases, w)
+}
+
+// Count the number of corresponding set bits of nElems elements of
+// elemBits bits each, starting at bit bitOffset of data, and add the
+// results to counts.  Bits are numbered LSB first, i.e. bit b of data
+// is data[b/8] >> (b%8) & 1, and element i occupies bits
+// bitOffset+i*elemBits to bitOffset+(i+1)*elemBits-1.  The counts are
+// the same as if the elements had been realigned to the start of data
+// and counted with CountPacked.
+//
+// The bit stream is realigned on the fly into a cache-sized buffer
+// which is then counted as with CountPacked; no realigned copy of the
+// whole stream is made.
+//
+// CountBitStream panics if elemBits is not between 1 and 64, if counts
+// has fewer than elemBits elements, or if data is too short to hold
+// the elements.
+func CountBitStream(counts []int, data []byte, bitOffset, nElems, elemBits int) {
+	if elemBits < 1 || elemBits > 64 {
+		panic("pospop: bit width out of range")
+	}
+
+	if len(counts) < elemBits {
+		panic("pospop: too few counters for bit width")
+	}
+
+	if bitOffset < 0 || nElems < 0 || len(data)*8-bitOffset < nElems*elemBits {
+		panic("pospop: too few elements in data")
+	}
+
+	counts = counts[:elemBits]
+	nbits := nElems * elemBits
+	period := packedPeriod(elemBits)
+	phases := make([]int, 64*period)
+	full := nbits / 64
+
+	chunkLen := period * phaseChunkLen
+	if chunkLen > full {
+		chunkLen = full
+	}
+
+	chunk := make([]uint64, chunkLen)
+	for k := 0; k < full; k += chunkLen {
+		n := full - k
+		if n > chunkLen {
+			n = chunkLen
+		}
+
+		for i := range chunk[:n] {
+			chunk[i] = streamWord(data, bitOffset+64*(k+i))
+		}
+
+		countPhases(phases, chunk[:n], period)
+	}
+
+	// partial word at the end
+	if rest := nbits % 64; rest != 0 {
+		r := full % period
+		tail := streamWord(data, bitOffset+64*full) & (1<<rest - 1)
+		Count(phases[r*64:(r+1)*64], []uint64{tail})
+	}
+
+	foldPhases(counts, phases, elemBits)
+}
+
+// return the 64 bits of data starting at bit b, LSB first.  Bits past
+// the end of data are returned as zero.
+func streamWord(data []byte, b int) uint64 {
+	i, s := b/8, uint(b%8)
+
+	if i+9 <= len(data) {
+		return binary.LittleEndian.Uint64(data[i:])>>s | uint64(data[i+8])<<(64-s)
+	}
+
+	var w uint64
+	for j := 0; j < 9 && i+j < len(data); j++ {
+		if j == 0 {
+			w |= uint64(data[i]) >> s
+		} else {
+			w |= uint64(data[i+j]) << (8*uint(j) - s)
+		}
+	}
+
+	return w
+}
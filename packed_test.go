@@ -0,0 +1,96 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// pack the low w bits of each value into a bit stream, LSB first
+func packValues(values []uint64, w int) []uint64 {
+	data := make([]uint64, (len(values)*w+63)/64)
+	for i, v := range values {
+		for j := 0; j < w; j++ {
+			b := i*w + j
+			data[b/64] |= (v >> j & 1) << (b % 64)
+		}
+	}
+
+	return data
+}
+
+// test the correctness of CountPacked for all bit widths
+func TestCountPacked(t *testing.T) {
+	for w := 1; w <= 64; w++ {
+		for _, n := range []int{0, 1, 63, 64, 65, 1000, 10000} {
+			values := make([]uint64, n)
+			for i := range values {
+				values[i] = rand.Uint64() & (1<<w - 1)
+			}
+
+			data := packValues(values, w)
+
+			// garbage past the end must be ignored
+			data = append(data, ^uint64(0))
+			if n*w%64 != 0 {
+				data[len(data)-2] |= ^uint64(0) << (n * w % 64)
+			}
+
+			counts := make([]int, w)
+			randomCounts(counts)
+			var refCounts [64]int
+			copy(refCounts[:], counts)
+
+			CountPacked(counts, data, w, n)
+			count64safe(&refCounts, values)
+
+			if !equalCounts(counts, refCounts[:w]) {
+				t.Errorf("width %d, length %d: counts don't match: %v\n", w, n, countDiff(counts, refCounts[:w]))
+			}
+		}
+	}
+}
+
+// test the correctness of CountBitStream for various bit offsets
+func TestCountBitStream(t *testing.T) {
+	for _, w := range []int{1, 3, 8, 11, 16, 37, 64} {
+		for _, offset := range []int{0, 1, 7, 8, 13, 64, 100} {
+			for _, n := range []int{0, 1, 100, 3000} {
+				values := make([]uint64, n)
+				for i := range values {
+					values[i] = rand.Uint64() & (1<<w - 1)
+				}
+
+				// pack the values at the given bit offset
+				words := packValues(values, w)
+				data := make([]byte, (offset+n*w+7)/8)
+				for b := 0; b < n*w; b++ {
+					bit := byte(words[b/64] >> (b % 64) & 1)
+					data[(offset+b)/8] |= bit << ((offset + b) % 8)
+				}
+
+				// garbage before and after the elements must be ignored
+				for b := 0; b < offset; b++ {
+					data[b/8] |= 1 << (b % 8)
+				}
+
+				for b := offset + n*w; b < len(data)*8; b++ {
+					data[b/8] |= 1 << (b % 8)
+				}
+
+				data = append(data, 0xff)
+
+				counts := make([]int, w)
+				var refCounts [64]int
+				CountBitStream(counts, data, offset, n, w)
+				count64safe(&refCounts, values)
+
+				if !equalCounts(counts, refCounts[:w]) {
+					t.Errorf("width %d, offset %d, length %d: counts don't match: %v\n",
+						w, offset, n, countDiff(counts, refCounts[:w]))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import "unsafe"
+
+// Count the number of corresponding set bits of the rows of rowWords
+// words each in data and add the results to counts.  Bit j of a row
+// is bit j%64 of word j/64 of that row, and counts[j] keeps track of
+// that bit, so counts must hold at least 64*rowWords elements.  With
+// a rowWords of 1, this is the same as Count64.  The words of each
+// column are gathered and counted with the regular kernels.  CountRows
+// panics if rowWords is not positive, if len(data) is not a multiple of
+// rowWords, or if counts is too short.
+func CountRows(counts []int, data []uint64, rowWords int) {
+	if rowWords <= 0 {
+		panic("pospop: row length must be positive")
+	}
+
+	if len(data)%rowWords != 0 {
+		panic("pospop: data is not a whole number of rows")
+	}
+
+	if len(counts) < 64*rowWords {
+		panic("pospop: too few counters for row length")
+	}
+
+	countPhases(counts, data, rowWords)
+}
+
+// count rows of rowWords little endian words each held in data.  Byte
+// k of a row holds bits 8*k to 8*k+7 of the row, so the per-byte slots
+// of countByteSlots are exactly the counters of the row.
+func countByteRows(counts []int, data []byte, rowWords int) {
+	countByteSlots(counts[:64*rowWords], data, 8*rowWords)
+}
+
+// Count the number of corresponding set bits of the 128 bit rows in
+// data, e.g. UUIDs, and add the results to counts.  Bits are numbered
+// LSB first, i.e. counts[j] keeps track of bit j%8 of byte j/8 of each
+// row.  The rows are counted in place regardless of their alignment.
+func CountRows128(counts *[128]int, data [][16]byte) {
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(data))), 16*len(data))
+	countByteRows(counts[:], buf, 2)
+}
+
+// Count the number of corresponding set bits of the 256 bit rows in
+// data, e.g. SHA-256 digests, and add the results to counts.  Bits are
+// numbered LSB first, i.e. counts[j] keeps track of bit j%8 of byte
+// j/8 of each row.  The rows are counted in place regardless of their
+// alignment.
+func CountRows256(counts *[256]int, data [][32]byte) {
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(data))), 32*len(data))
+	countByteRows(counts[:], buf, 4)
+}
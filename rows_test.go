@@ -0,0 +1,72 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/rand"
+	"testing"
+	"unsafe"
+)
+
+// test the correctness of CountRows for various row lengths
+func TestCountRows(t *testing.T) {
+	for _, rowWords := range []int{1, 2, 3, 16} {
+		for _, rows := range []int{0, 1, 100, 1000} {
+			data := make([]uint64, rows*rowWords)
+			for i := range data {
+				data[i] = rand.Uint64()
+			}
+
+			counts := make([]int, 64*rowWords)
+			refCounts := make([]int, 64*rowWords)
+			randomCounts(counts)
+			copy(refCounts, counts)
+
+			CountRows(counts, data, rowWords)
+			for i := range data {
+				count64safe((*[64]int)(refCounts[i%rowWords*64:]), data[i:i+1])
+			}
+
+			if !equalCounts(counts, refCounts) {
+				t.Errorf("row length %d, %d rows: counts don't match: %v\n", rowWords, rows, countDiff(counts, refCounts))
+			}
+		}
+	}
+}
+
+// reference implementation for CountRows128 and CountRows256
+func countByteRowsSafe(counts []int, data []byte) {
+	for i, b := range data {
+		for j := 0; j < 8; j++ {
+			counts[i%(len(counts)/8)*8+j] += int(b >> j & 1)
+		}
+	}
+}
+
+// test the correctness of CountRows128 and CountRows256, including
+// misaligned data
+func TestCountByteRows(t *testing.T) {
+	raw := make([]byte, 32*1001+1)
+	rand.Read(raw)
+
+	for _, offset := range []int{0, 1} {
+		buf := raw[offset : offset+32*1000]
+		rows128 := unsafe.Slice((*[16]byte)(unsafe.Pointer(&buf[0])), len(buf)/16)
+		rows256 := unsafe.Slice((*[32]byte)(unsafe.Pointer(&buf[0])), len(buf)/32)
+
+		var counts128, refCounts128 [128]int
+		var counts256, refCounts256 [256]int
+		CountRows128(&counts128, rows128)
+		CountRows256(&counts256, rows256)
+		countByteRowsSafe(refCounts128[:], buf)
+		countByteRowsSafe(refCounts256[:], buf)
+
+		if counts128 != refCounts128 {
+			t.Errorf("offset %d: CountRows128: counts don't match: %v\n", offset, countDiff(counts128[:], refCounts128[:]))
+		}
+
+		if counts256 != refCounts256 {
+			t.Errorf("offset %d: CountRows256: counts don't match: %v\n", offset, countDiff(counts256[:], refCounts256[:]))
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+// each platform must provide arrays count8segmentsfuncs,
+// count16segmentsfuncs, count32segmentsfuncs, and count64segmentsfuncs
+// of type count8segmentsimpl, ... listing kernels analogous to
+// count8funcs and friends that count consecutive segments of segLen
+// elements of buf into consecutive elements of out, flushing their
+// accumulators at the end of each segment.  The caller ensures that
+// len(buf) is a multiple of segLen, that segLen elements make up a
+// multiple of 8 bytes, and that out holds len(buf)/segLen elements.
+
+type count8segmentsimpl struct {
+	count8segments func(out [][8]int, buf []uint8, segLen int)
+	name           string
+	available      bool
+}
+
+type count16segmentsimpl struct {
+	count16segments func(out [][16]int, buf []uint16, segLen int)
+	name            string
+	available       bool
+}
+
+type count32segmentsimpl struct {
+	count32segments func(out [][32]int, buf []uint32, segLen int)
+	name            string
+	available       bool
+}
+
+type count64segmentsimpl struct {
+	count64segments func(out [][64]int, buf []uint64, segLen int)
+	name            string
+	available       bool
+}
+
+// optimal count8segments implementation selected at runtime
+var count8segmentsfunc = func() func([][8]int, []uint8, int) {
+	for _, f := range count8segmentsfuncs {
+		if f.available {
+			return f.count8segments
+		}
+	}
+
+	panic("no implementation of count8segments available")
+}()
+
+// optimal count16segments implementation selected at runtime
+var count16segmentsfunc = func() func([][16]int, []uint16, int) {
+	for _, f := range count16segmentsfuncs {
+		if f.available {
+			return f.count16segments
+		}
+	}
+
+	panic("no implementation of count16segments available")
+}()
+
+// optimal count32segments implementation selected at runtime
+var count32segmentsfunc = func() func([][32]int, []uint32, int) {
+	for _, f := range count32segmentsfuncs {
+		if f.available {
+			return f.count32segments
+		}
+	}
+
+	panic("no implementation of count32segments available")
+}()
+
+// optimal count64segments implementation selected at runtime
+var count64segmentsfunc = func() func([][64]int, []uint64, int) {
+	for _, f := range count64segmentsfuncs {
+		if f.available {
+			return f.count64segments
+		}
+	}
+
+	panic("no implementation of count64segments available")
+}()
+
+// number of segments of length segLen needed to cover n elements,
+// checking that out has room for at least that many
+func segments(n, segLen, outLen int) int {
+	if segLen <= 0 {
+		panic("pospop: segment length must be positive")
+	}
+
+	nseg := (n + segLen - 1) / segLen
+	if nseg > outLen {
+		panic("pospop: too few segment counters")
+	}
+
+	return nseg
+}
+
+// number of leading elements of a buffer of n elements of the given
+// size the segmented kernels can process: the whole segments if a
+// segment makes up a multiple of 8 bytes and none otherwise.
+func segmentPrefix(n, segLen, size int) int {
+	if segLen > n || segLen*size%8 != 0 {
+		return 0
+	}
+
+	return n - n%segLen
+}
+
+// Split buf into segments of segLen elements each and count the
+// number of corresponding set bits in each segment, adding the results
+// for segment k to out[k] as if by Count8(&out[k], segment).  The
+// last segment is shorter if len(buf) is not a multiple of segLen.
+// CountSegments8 panics if segLen is not positive or if out has fewer
+// elements than there are segments.
+//
+// If a segment makes up a multiple of 8 bytes, the whole segments are
+// counted in a single kernel call, flushing the accumulators into
+// out[k] at the end of each segment.  Other segments are counted one
+// call at a time.
+func CountSegments8(out [][8]int, buf []uint8, segLen int) {
+	nseg := segments(len(buf), segLen, len(out))
+	n := segmentPrefix(len(buf), segLen, 1)
+	if n > 0 {
+		count8segmentsfunc(out[:n/segLen], buf[:n], segLen)
+	}
+
+	for k := n / segLen; k < nseg; k++ {
+		end := (k + 1) * segLen
+		if end > len(buf) {
+			end = len(buf)
+		}
+
+		count8func(&out[k], buf[k*segLen:end])
+	}
+}
+
+// Split buf into segments of segLen elements each and count the
+// number of corresponding set bits in each segment, adding the results
+// for segment k to out[k] as if by Count16(&out[k], segment).  The
+// last segment is shorter if len(buf) is not a multiple of segLen.
+// CountSegments16 panics if segLen is not positive or if out has fewer
+// elements than there are segments.
+//
+// If a segment makes up a multiple of 8 bytes, the whole segments are
+// counted in a single kernel call, flushing the accumulators into
+// out[k] at the end of each segment.  Other segments are counted one
+// call at a time.
+func CountSegments16(out [][16]int, buf []uint16, segLen int) {
+	nseg := segments(len(buf), segLen, len(out))
+	n := segmentPrefix(len(buf), segLen, 2)
+	if n > 0 {
+		count16segmentsfunc(out[:n/segLen], buf[:n], segLen)
+	}
+
+	for k := n / segLen; k < nseg; k++ {
+		end := (k + 1) * segLen
+		if end > len(buf) {
+			end = len(buf)
+		}
+
+		count16func(&out[k], buf[k*segLen:end])
+	}
+}
+
+// Split buf into segments of segLen elements each and count the
+// number of corresponding set bits in each segment, adding the results
+// for segment k to out[k] as if by Count32(&out[k], segment).  The
+// last segment is shorter if len(buf) is not a multiple of segLen.
+// CountSegments32 panics if segLen is not positive or if out has fewer
+// elements than there are segments.
+//
+// If a segment makes up a multiple of 8 bytes, the whole segments are
+// counted in a single kernel call, flushing the accumulators into
+// out[k] at the end of each segment.  Other segments are counted one
+// call at a time.
+func CountSegments32(out [][32]int, buf []uint32, segLen int) {
+	nseg := segments(len(buf), segLen, len(out))
+	n := segmentPrefix(len(buf), segLen, 4)
+	if n > 0 {
+		count32segmentsfunc(out[:n/segLen], buf[:n], segLen)
+	}
+
+	for k := n / segLen; k < nseg; k++ {
+		end := (k + 1) * segLen
+		if end > len(buf) {
+			end = len(buf)
+		}
+
+		count32func(&out[k], buf[k*segLen:end])
+	}
+}
+
+// Split buf into segments of segLen elements each and count the
+// number of corresponding set bits in each segment, adding the results
+// for segment k to out[k] as if by Count64(&out[k], segment).  The
+// last segment is shorter if len(buf) is not a multiple of segLen.
+// CountSegments64 panics if segLen is not positive or if out has fewer
+// elements than there are segments.
+//
+// If a segment makes up a multiple of 8 bytes, the whole segments are
+// counted in a single kernel call, flushing the accumulators into
+// out[k] at the end of each segment.  Other segments are counted one
+// call at a time.
+func CountSegments64(out [][64]int, buf []uint64, segLen int) {
+	nseg := segments(len(buf), segLen, len(out))
+	n := segmentPrefix(len(buf), segLen, 8)
+	if n > 0 {
+		count64segmentsfunc(out[:n/segLen], buf[:n], segLen)
+	}
+
+	for k := n / segLen; k < nseg; k++ {
+		end := (k + 1) * segLen
+		if end > len(buf) {
+			end = len(buf)
+		}
+
+		count64func(&out[k], buf[k*segLen:end])
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/rand"
+	"testing"
+	"unsafe"
+)
+
+// test the correctness of CountSegments32
+func TestCountSegments32(t *testing.T) {
+	buf := make([]uint32, 4*1024+100)
+	for i := range buf {
+		buf[i] = rand.Uint32()
+	}
+
+	for _, segLen := range []int{1, 15, 240, 1024, len(buf), len(buf) + 1} {
+		for _, n := range []int{0, 1, 1024, 4 * 1024, len(buf)} {
+			nseg := (n + segLen - 1) / segLen
+			out := make([][32]int, nseg)
+			for k := range out {
+				randomCounts(out[k][:])
+			}
+
+			ref := append([][32]int(nil), out...)
+			CountSegments32(out, buf[:n], segLen)
+			for k := range ref {
+				end := (k + 1) * segLen
+				if end > n {
+					end = n
+				}
+
+				count32safe(&ref[k], buf[k*segLen:end])
+				if out[k] != ref[k] {
+					t.Errorf("segment length %d, length %d, segment %d: counts don't match: %v\n",
+						segLen, n, k, countDiff(out[k][:], ref[k][:]))
+				}
+			}
+		}
+	}
+}
+
+// test that CountSegments8 rejects too short out slices
+func TestCountSegmentsShort(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("CountSegments8 did not panic")
+		}
+	}()
+
+	CountSegments8(make([][8]int, 2), make([]uint8, 21), 10)
+}
+
+// test the correctness of a count#segments implementation.  counts
+// holds the counters of all segments one after another.
+func testCountSegmentsKernel[T word](t *testing.T, count func(counts []int, buf []T, segLen int)) {
+	var zero T
+	nbits := 8 * int(unsafe.Sizeof(zero))
+
+	// segments of multiples of 8 elements make up multiples of 8 bytes
+	for _, segLen := range []int{8, 24, 512, 1000} {
+		for _, nseg := range []int{1, 2, 5} {
+			buf := make([]T, nseg*segLen+1)[1:]
+			for i := range buf {
+				buf[i] = T(rand.Uint64())
+			}
+
+			counts := make([]int, nseg*nbits)
+			randomCounts(counts)
+			refCounts := append([]int(nil), counts...)
+
+			count(counts, buf, segLen)
+			for i, x := range buf {
+				seg := refCounts[i/segLen*nbits:]
+				for j := 0; j < nbits; j++ {
+					seg[j] += int(uint64(x) >> j & 1)
+				}
+			}
+
+			if !equalCounts(counts, refCounts) {
+				t.Errorf("segment length %d, %d segments: counts don't match: %v\n",
+					segLen, nseg, countDiff(counts, refCounts))
+			}
+		}
+	}
+}
+
+// test the correctness of all count#segments implementations
+func TestCountSegmentsKernels(t *testing.T) {
+	for i := range count8segmentsfuncs {
+		t.Run("8/"+count8segmentsfuncs[i].name, func(tt *testing.T) {
+			if !count8segmentsfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountSegmentsKernel(tt, func(counts []int, buf []uint8, segLen int) {
+				out := unsafe.Slice((*[8]int)(counts), len(counts)/8)
+				count8segmentsfuncs[i].count8segments(out, buf, segLen)
+			})
+		})
+	}
+
+	for i := range count16segmentsfuncs {
+		t.Run("16/"+count16segmentsfuncs[i].name, func(tt *testing.T) {
+			if !count16segmentsfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountSegmentsKernel(tt, func(counts []int, buf []uint16, segLen int) {
+				out := unsafe.Slice((*[16]int)(counts), len(counts)/16)
+				count16segmentsfuncs[i].count16segments(out, buf, segLen)
+			})
+		})
+	}
+
+	for i := range count32segmentsfuncs {
+		t.Run("32/"+count32segmentsfuncs[i].name, func(tt *testing.T) {
+			if !count32segmentsfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountSegmentsKernel(tt, func(counts []int, buf []uint32, segLen int) {
+				out := unsafe.Slice((*[32]int)(counts), len(counts)/32)
+				count32segmentsfuncs[i].count32segments(out, buf, segLen)
+			})
+		})
+	}
+
+	for i := range count64segmentsfuncs {
+		t.Run("64/"+count64segmentsfuncs[i].name, func(tt *testing.T) {
+			if !count64segmentsfuncs[i].available {
+				tt.SkipNow()
+			}
+
+			testCountSegmentsKernel(tt, func(counts []int, buf []uint64, segLen int) {
+				out := unsafe.Slice((*[64]int)(counts), len(counts)/64)
+				count64segmentsfuncs[i].count64segments(out, buf, segLen)
+			})
+		})
+	}
+}
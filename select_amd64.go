@@ -2,7 +2,11 @@
 
 package pospop
 
-import "golang.org/x/sys/cpu"
+import (
+	"unsafe"
+
+	"golang.org/x/sys/cpu"
+)
 
 func count8avx512(counts *[8]int, buf []byte)
 func count8avx2(counts *[8]int, buf []byte)
@@ -20,6 +24,106 @@ func count64avx512(counts *[64]int, buf []uint64)
 func count64avx2(counts *[64]int, buf []uint64)
 func count64sse2(counts *[64]int, buf []uint64)
 
+func count8avx512u32(counts *[8]uint32, buf []byte)
+func count8avx2u32(counts *[8]uint32, buf []byte)
+func count8sse2u32(counts *[8]uint32, buf []byte)
+
+func count16avx512u32(counts *[16]uint32, buf []uint16)
+func count16avx2u32(counts *[16]uint32, buf []uint16)
+func count16sse2u32(counts *[16]uint32, buf []uint16)
+
+func count32avx512u32(counts *[32]uint32, buf []uint32)
+func count32avx2u32(counts *[32]uint32, buf []uint32)
+func count32sse2u32(counts *[32]uint32, buf []uint32)
+
+func count64avx512u32(counts *[64]uint32, buf []uint64)
+func count64avx2u32(counts *[64]uint32, buf []uint64)
+func count64sse2u32(counts *[64]uint32, buf []uint64)
+
+func gather32avx512(dst, buf []uint32, sel []int32)
+func gather64avx512(dst, buf []uint64, sel []int32)
+
+func gather32avx2(dst, buf []uint32, sel []int32)
+func gather64avx2(dst, buf []uint64, sel []int32)
+
+func gatherStrided32avx2(dst []uint32, base unsafe.Pointer, stride uintptr)
+func gatherStrided64avx2(dst []uint64, base unsafe.Pointer, stride uintptr)
+
+func count8avx512binop(counts *[8]int, a, b []uint8, op binop)
+func count16avx512binop(counts *[16]int, a, b []uint16, op binop)
+func count32avx512binop(counts *[32]int, a, b []uint32, op binop)
+func count64avx512binop(counts *[64]int, a, b []uint64, op binop)
+
+func count8avx2binop(counts *[8]int, a, b []uint8, op binop)
+func count16avx2binop(counts *[16]int, a, b []uint16, op binop)
+func count32avx2binop(counts *[32]int, a, b []uint32, op binop)
+func count64avx2binop(counts *[64]int, a, b []uint64, op binop)
+
+func count8sse2binop(counts *[8]int, a, b []uint8, op binop)
+func count16sse2binop(counts *[16]int, a, b []uint16, op binop)
+func count32sse2binop(counts *[32]int, a, b []uint32, op binop)
+func count64sse2binop(counts *[64]int, a, b []uint64, op binop)
+
+func count8avx512masked(counts *[8]int, buf []uint8, valid []byte)
+func count16avx512masked(counts *[16]int, buf []uint16, valid []byte)
+func count32avx512masked(counts *[32]int, buf []uint32, valid []byte)
+func count64avx512masked(counts *[64]int, buf []uint64, valid []byte)
+
+func count8avx2masked(counts *[8]int, buf []uint8, valid []byte)
+func count16avx2masked(counts *[16]int, buf []uint16, valid []byte)
+func count32avx2masked(counts *[32]int, buf []uint32, valid []byte)
+func count64avx2masked(counts *[64]int, buf []uint64, valid []byte)
+
+func count8sse2masked(counts *[8]int, buf []uint8, valid []byte)
+func count16sse2masked(counts *[16]int, buf []uint16, valid []byte)
+func count32sse2masked(counts *[32]int, buf []uint32, valid []byte)
+func count64sse2masked(counts *[64]int, buf []uint64, valid []byte)
+
+func count8avx512onehot(counts *[8]int, buf []uint8, leading bool)
+func count16avx512onehot(counts *[16]int, buf []uint16, leading bool)
+func count32avx512onehot(counts *[32]int, buf []uint32, leading bool)
+func count64avx512onehot(counts *[64]int, buf []uint64, leading bool)
+
+func count8avx2onehot(counts *[8]int, buf []uint8, leading bool)
+func count16avx2onehot(counts *[16]int, buf []uint16, leading bool)
+func count32avx2onehot(counts *[32]int, buf []uint32, leading bool)
+func count64avx2onehot(counts *[64]int, buf []uint64, leading bool)
+
+func count8sse2onehot(counts *[8]int, buf []uint8, leading bool)
+func count16sse2onehot(counts *[16]int, buf []uint16, leading bool)
+func count32sse2onehot(counts *[32]int, buf []uint32, leading bool)
+func count64sse2onehot(counts *[64]int, buf []uint64, leading bool)
+
+func count8avx512segments(out [][8]int, buf []uint8, segLen int)
+func count16avx512segments(out [][16]int, buf []uint16, segLen int)
+func count32avx512segments(out [][32]int, buf []uint32, segLen int)
+func count64avx512segments(out [][64]int, buf []uint64, segLen int)
+
+func count8avx2segments(out [][8]int, buf []uint8, segLen int)
+func count16avx2segments(out [][16]int, buf []uint16, segLen int)
+func count32avx2segments(out [][32]int, buf []uint32, segLen int)
+func count64avx2segments(out [][64]int, buf []uint64, segLen int)
+
+func count8sse2segments(out [][8]int, buf []uint8, segLen int)
+func count16sse2segments(out [][16]int, buf []uint16, segLen int)
+func count32sse2segments(out [][32]int, buf []uint32, segLen int)
+func count64sse2segments(out [][64]int, buf []uint64, segLen int)
+
+func count8avx512hist(counts *[8]int, hist *[9]int, buf []uint8)
+func count16avx512hist(counts *[16]int, hist *[17]int, buf []uint16)
+func count32avx512hist(counts *[32]int, hist *[33]int, buf []uint32)
+func count64avx512hist(counts *[64]int, hist *[65]int, buf []uint64)
+
+func count8avx2hist(counts *[8]int, hist *[9]int, buf []uint8)
+func count16avx2hist(counts *[16]int, hist *[17]int, buf []uint16)
+func count32avx2hist(counts *[32]int, hist *[33]int, buf []uint32)
+func count64avx2hist(counts *[64]int, hist *[65]int, buf []uint64)
+
+func count8sse2hist(counts *[8]int, hist *[9]int, buf []uint8)
+func count16sse2hist(counts *[16]int, hist *[17]int, buf []uint16)
+func count32sse2hist(counts *[32]int, hist *[33]int, buf []uint32)
+func count64sse2hist(counts *[64]int, hist *[65]int, buf []uint64)
+
 var count8funcs = []count8impl{
 	{count8avx512, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
 	{count8avx2, "avx2", cpu.X86.HasBMI2 && cpu.X86.HasAVX2},
@@ -47,3 +151,197 @@ var count64funcs = []count64impl{
 	{count64sse2, "sse2", cpu.X86.HasSSE2},
 	{count64generic, "generic", true},
 }
+
+var count8altfuncs = []count8altimpl{
+	{count8avx512u32, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count8avx2u32, "avx2", cpu.X86.HasBMI2 && cpu.X86.HasAVX2},
+	{count8sse2u32, "sse2", cpu.X86.HasSSE2},
+	{count8altgeneric, "generic", true},
+}
+
+var count16altfuncs = []count16altimpl{
+	{count16avx512u32, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count16avx2u32, "avx2", cpu.X86.HasBMI2 && cpu.X86.HasAVX2},
+	{count16sse2u32, "sse2", cpu.X86.HasSSE2},
+	{count16altgeneric, "generic", true},
+}
+
+var count32altfuncs = []count32altimpl{
+	{count32avx512u32, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count32avx2u32, "avx2", cpu.X86.HasBMI2 && cpu.X86.HasAVX2},
+	{count32sse2u32, "sse2", cpu.X86.HasSSE2},
+	{count32altgeneric, "generic", true},
+}
+
+var count64altfuncs = []count64altimpl{
+	{count64avx512u32, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count64avx2u32, "avx2", cpu.X86.HasBMI2 && cpu.X86.HasAVX2},
+	{count64sse2u32, "sse2", cpu.X86.HasSSE2},
+	{count64altgeneric, "generic", true},
+}
+
+var count8binopfuncs = []count8binopimpl{
+	{count8avx512binop, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count8avx2binop, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2},
+	{count8sse2binop, "sse2", cpu.X86.HasSSE2},
+	{count8binopgeneric, "generic", true},
+}
+
+var count16binopfuncs = []count16binopimpl{
+	{count16avx512binop, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count16avx2binop, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2},
+	{count16sse2binop, "sse2", cpu.X86.HasSSE2},
+	{count16binopgeneric, "generic", true},
+}
+
+var count32binopfuncs = []count32binopimpl{
+	{count32avx512binop, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count32avx2binop, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2},
+	{count32sse2binop, "sse2", cpu.X86.HasSSE2},
+	{count32binopgeneric, "generic", true},
+}
+
+var count64binopfuncs = []count64binopimpl{
+	{count64avx512binop, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count64avx2binop, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2},
+	{count64sse2binop, "sse2", cpu.X86.HasSSE2},
+	{count64binopgeneric, "generic", true},
+}
+
+var count8maskedfuncs = []count8maskedimpl{
+	{count8avx512masked, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count8avx2masked, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2},
+	{count8sse2masked, "sse2", cpu.X86.HasSSE2},
+	{count8maskedgeneric, "generic", true},
+}
+
+var count16maskedfuncs = []count16maskedimpl{
+	{count16avx512masked, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count16avx2masked, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2},
+	{count16sse2masked, "sse2", cpu.X86.HasSSE2},
+	{count16maskedgeneric, "generic", true},
+}
+
+var count32maskedfuncs = []count32maskedimpl{
+	{count32avx512masked, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count32avx2masked, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2},
+	{count32sse2masked, "sse2", cpu.X86.HasSSE2},
+	{count32maskedgeneric, "generic", true},
+}
+
+var count64maskedfuncs = []count64maskedimpl{
+	{count64avx512masked, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count64avx2masked, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2},
+	{count64sse2masked, "sse2", cpu.X86.HasSSE2},
+	{count64maskedgeneric, "generic", true},
+}
+
+var count8onehotfuncs = []count8onehotimpl{
+	{count8avx512onehot, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count8avx2onehot, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2},
+	{count8sse2onehot, "sse2", cpu.X86.HasSSE2},
+	{count8onehotgeneric, "generic", true},
+}
+
+var count16onehotfuncs = []count16onehotimpl{
+	{count16avx512onehot, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count16avx2onehot, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2},
+	{count16sse2onehot, "sse2", cpu.X86.HasSSE2},
+	{count16onehotgeneric, "generic", true},
+}
+
+var count32onehotfuncs = []count32onehotimpl{
+	{count32avx512onehot, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count32avx2onehot, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2},
+	{count32sse2onehot, "sse2", cpu.X86.HasSSE2},
+	{count32onehotgeneric, "generic", true},
+}
+
+var count64onehotfuncs = []count64onehotimpl{
+	{count64avx512onehot, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count64avx2onehot, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2},
+	{count64sse2onehot, "sse2", cpu.X86.HasSSE2},
+	{count64onehotgeneric, "generic", true},
+}
+
+var count8segmentsfuncs = []count8segmentsimpl{
+	{count8avx512segments, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count8avx2segments, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2},
+	{count8sse2segments, "sse2", cpu.X86.HasSSE2},
+	{count8segmentsgeneric, "generic", true},
+}
+
+var count16segmentsfuncs = []count16segmentsimpl{
+	{count16avx512segments, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count16avx2segments, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2},
+	{count16sse2segments, "sse2", cpu.X86.HasSSE2},
+	{count16segmentsgeneric, "generic", true},
+}
+
+var count32segmentsfuncs = []count32segmentsimpl{
+	{count32avx512segments, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count32avx2segments, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2},
+	{count32sse2segments, "sse2", cpu.X86.HasSSE2},
+	{count32segmentsgeneric, "generic", true},
+}
+
+var count64segmentsfuncs = []count64segmentsimpl{
+	{count64avx512segments, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW},
+	{count64avx2segments, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2},
+	{count64sse2segments, "sse2", cpu.X86.HasSSE2},
+	{count64segmentsgeneric, "generic", true},
+}
+
+var count8histfuncs = []count8histimpl{
+	{count8avx512hist, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW && cpu.X86.HasPOPCNT},
+	{count8avx2hist, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2 && cpu.X86.HasPOPCNT},
+	{count8sse2hist, "sse2", cpu.X86.HasSSE2 && cpu.X86.HasPOPCNT},
+	{count8histgeneric, "generic", true},
+}
+
+var count16histfuncs = []count16histimpl{
+	{count16avx512hist, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW && cpu.X86.HasPOPCNT},
+	{count16avx2hist, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2 && cpu.X86.HasPOPCNT},
+	{count16sse2hist, "sse2", cpu.X86.HasSSE2 && cpu.X86.HasPOPCNT},
+	{count16histgeneric, "generic", true},
+}
+
+var count32histfuncs = []count32histimpl{
+	{count32avx512hist, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW && cpu.X86.HasPOPCNT},
+	{count32avx2hist, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2 && cpu.X86.HasPOPCNT},
+	{count32sse2hist, "sse2", cpu.X86.HasSSE2 && cpu.X86.HasPOPCNT},
+	{count32histgeneric, "generic", true},
+}
+
+var count64histfuncs = []count64histimpl{
+	{count64avx512hist, "avx512", cpu.X86.HasBMI2 && cpu.X86.HasAVX512BW && cpu.X86.HasPOPCNT},
+	{count64avx2hist, "avx2", cpu.X86.HasAVX2 && cpu.X86.HasBMI2 && cpu.X86.HasPOPCNT},
+	{count64sse2hist, "sse2", cpu.X86.HasSSE2 && cpu.X86.HasPOPCNT},
+	{count64histgeneric, "generic", true},
+}
+
+var gather32funcs = []gather32impl{
+	{gather32avx512, "avx512", cpu.X86.HasAVX512F},
+	{gather32avx2, "avx2", cpu.X86.HasAVX2},
+	{gather32generic, "generic", true},
+}
+
+var gather64funcs = []gather64impl{
+	{gather64avx512, "avx512", cpu.X86.HasAVX512F},
+	{gather64avx2, "avx2", cpu.X86.HasAVX2},
+	{gather64generic, "generic", true},
+}
+
+var gatherStrided32funcs = []gatherStrided32impl{
+	{gatherStrided32avx2, "avx2", cpu.X86.HasAVX2},
+	{gatherStrided32generic, "generic", true},
+}
+
+var gatherStrided64funcs = []gatherStrided64impl{
+	{gatherStrided64avx2, "avx2", cpu.X86.HasAVX2},
+	{gatherStrided64generic, "generic", true},
+}
+
+// The assembly kernels count short runs faster than CountGrouped could
+// add their elements one at a time.
+const groupMinRun = 1
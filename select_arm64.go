@@ -7,6 +7,36 @@ func count16neon(counts *[16]int, buf []uint16)
 func count32neon(counts *[32]int, buf []uint32)
 func count64neon(counts *[64]int, buf []uint64)
 
+func count8neonu32(counts *[8]uint32, buf []uint8)
+func count16neonu32(counts *[16]uint32, buf []uint16)
+func count32neonu32(counts *[32]uint32, buf []uint32)
+func count64neonu32(counts *[64]uint32, buf []uint64)
+
+func count8neonbinop(counts *[8]int, a, b []uint8, op binop)
+func count16neonbinop(counts *[16]int, a, b []uint16, op binop)
+func count32neonbinop(counts *[32]int, a, b []uint32, op binop)
+func count64neonbinop(counts *[64]int, a, b []uint64, op binop)
+
+func count8neonmasked(counts *[8]int, buf []uint8, valid []byte)
+func count16neonmasked(counts *[16]int, buf []uint16, valid []byte)
+func count32neonmasked(counts *[32]int, buf []uint32, valid []byte)
+func count64neonmasked(counts *[64]int, buf []uint64, valid []byte)
+
+func count8neononehot(counts *[8]int, buf []uint8, leading bool)
+func count16neononehot(counts *[16]int, buf []uint16, leading bool)
+func count32neononehot(counts *[32]int, buf []uint32, leading bool)
+func count64neononehot(counts *[64]int, buf []uint64, leading bool)
+
+func count8neonsegments(out [][8]int, buf []uint8, segLen int)
+func count16neonsegments(out [][16]int, buf []uint16, segLen int)
+func count32neonsegments(out [][32]int, buf []uint32, segLen int)
+func count64neonsegments(out [][64]int, buf []uint64, segLen int)
+
+func count8neonhist(counts *[8]int, hist *[9]int, buf []uint8)
+func count16neonhist(counts *[16]int, hist *[17]int, buf []uint16)
+func count32neonhist(counts *[32]int, hist *[33]int, buf []uint32)
+func count64neonhist(counts *[64]int, hist *[65]int, buf []uint64)
+
 var count8funcs = []count8impl{
 	{count8neon, "neon", true},
 	{count8generic, "generic", true},
@@ -26,3 +56,143 @@ var count64funcs = []count64impl{
 	{count64neon, "neon", true},
 	{count64generic, "generic", true},
 }
+
+var count8altfuncs = []count8altimpl{
+	{count8neonu32, "neon", true},
+	{count8altgeneric, "generic", true},
+}
+
+var count16altfuncs = []count16altimpl{
+	{count16neonu32, "neon", true},
+	{count16altgeneric, "generic", true},
+}
+
+var count32altfuncs = []count32altimpl{
+	{count32neonu32, "neon", true},
+	{count32altgeneric, "generic", true},
+}
+
+var count64altfuncs = []count64altimpl{
+	{count64neonu32, "neon", true},
+	{count64altgeneric, "generic", true},
+}
+
+var count8binopfuncs = []count8binopimpl{
+	{count8neonbinop, "neon", true},
+	{count8binopgeneric, "generic", true},
+}
+
+var count16binopfuncs = []count16binopimpl{
+	{count16neonbinop, "neon", true},
+	{count16binopgeneric, "generic", true},
+}
+
+var count32binopfuncs = []count32binopimpl{
+	{count32neonbinop, "neon", true},
+	{count32binopgeneric, "generic", true},
+}
+
+var count64binopfuncs = []count64binopimpl{
+	{count64neonbinop, "neon", true},
+	{count64binopgeneric, "generic", true},
+}
+
+var count8maskedfuncs = []count8maskedimpl{
+	{count8neonmasked, "neon", true},
+	{count8maskedgeneric, "generic", true},
+}
+
+var count16maskedfuncs = []count16maskedimpl{
+	{count16neonmasked, "neon", true},
+	{count16maskedgeneric, "generic", true},
+}
+
+var count32maskedfuncs = []count32maskedimpl{
+	{count32neonmasked, "neon", true},
+	{count32maskedgeneric, "generic", true},
+}
+
+var count64maskedfuncs = []count64maskedimpl{
+	{count64neonmasked, "neon", true},
+	{count64maskedgeneric, "generic", true},
+}
+
+var count8onehotfuncs = []count8onehotimpl{
+	{count8neononehot, "neon", true},
+	{count8onehotgeneric, "generic", true},
+}
+
+var count16onehotfuncs = []count16onehotimpl{
+	{count16neononehot, "neon", true},
+	{count16onehotgeneric, "generic", true},
+}
+
+var count32onehotfuncs = []count32onehotimpl{
+	{count32neononehot, "neon", true},
+	{count32onehotgeneric, "generic", true},
+}
+
+var count64onehotfuncs = []count64onehotimpl{
+	{count64neononehot, "neon", true},
+	{count64onehotgeneric, "generic", true},
+}
+
+var count8segmentsfuncs = []count8segmentsimpl{
+	{count8neonsegments, "neon", true},
+	{count8segmentsgeneric, "generic", true},
+}
+
+var count16segmentsfuncs = []count16segmentsimpl{
+	{count16neonsegments, "neon", true},
+	{count16segmentsgeneric, "generic", true},
+}
+
+var count32segmentsfuncs = []count32segmentsimpl{
+	{count32neonsegments, "neon", true},
+	{count32segmentsgeneric, "generic", true},
+}
+
+var count64segmentsfuncs = []count64segmentsimpl{
+	{count64neonsegments, "neon", true},
+	{count64segmentsgeneric, "generic", true},
+}
+
+var count8histfuncs = []count8histimpl{
+	{count8neonhist, "neon", true},
+	{count8histgeneric, "generic", true},
+}
+
+var count16histfuncs = []count16histimpl{
+	{count16neonhist, "neon", true},
+	{count16histgeneric, "generic", true},
+}
+
+var count32histfuncs = []count32histimpl{
+	{count32neonhist, "neon", true},
+	{count32histgeneric, "generic", true},
+}
+
+var count64histfuncs = []count64histimpl{
+	{count64neonhist, "neon", true},
+	{count64histgeneric, "generic", true},
+}
+
+var gather32funcs = []gather32impl{
+	{gather32generic, "generic", true},
+}
+
+var gather64funcs = []gather64impl{
+	{gather64generic, "generic", true},
+}
+
+var gatherStrided32funcs = []gatherStrided32impl{
+	{gatherStrided32generic, "generic", true},
+}
+
+var gatherStrided64funcs = []gatherStrided64impl{
+	{gatherStrided64generic, "generic", true},
+}
+
+// The assembly kernels count short runs faster than CountGrouped could
+// add their elements one at a time.
+const groupMinRun = 1
@@ -9,3 +9,35 @@ var count8funcs = []count8impl{{count8generic, "generic", true}}
 var count16funcs = []count16impl{{count16generic, "generic", true}}
 var count32funcs = []count32impl{{count32generic, "generic", true}}
 var count64funcs = []count64impl{{count64generic, "generic", true}}
+var count8altfuncs = []count8altimpl{{count8altgeneric, "generic", true}}
+var count16altfuncs = []count16altimpl{{count16altgeneric, "generic", true}}
+var count32altfuncs = []count32altimpl{{count32altgeneric, "generic", true}}
+var count64altfuncs = []count64altimpl{{count64altgeneric, "generic", true}}
+var count8binopfuncs = []count8binopimpl{{count8binopgeneric, "generic", true}}
+var count16binopfuncs = []count16binopimpl{{count16binopgeneric, "generic", true}}
+var count32binopfuncs = []count32binopimpl{{count32binopgeneric, "generic", true}}
+var count64binopfuncs = []count64binopimpl{{count64binopgeneric, "generic", true}}
+var count8maskedfuncs = []count8maskedimpl{{count8maskedgeneric, "generic", true}}
+var count16maskedfuncs = []count16maskedimpl{{count16maskedgeneric, "generic", true}}
+var count32maskedfuncs = []count32maskedimpl{{count32maskedgeneric, "generic", true}}
+var count64maskedfuncs = []count64maskedimpl{{count64maskedgeneric, "generic", true}}
+var count8onehotfuncs = []count8onehotimpl{{count8onehotgeneric, "generic", true}}
+var count16onehotfuncs = []count16onehotimpl{{count16onehotgeneric, "generic", true}}
+var count32onehotfuncs = []count32onehotimpl{{count32onehotgeneric, "generic", true}}
+var count64onehotfuncs = []count64onehotimpl{{count64onehotgeneric, "generic", true}}
+var count8segmentsfuncs = []count8segmentsimpl{{count8segmentsgeneric, "generic", true}}
+var count16segmentsfuncs = []count16segmentsimpl{{count16segmentsgeneric, "generic", true}}
+var count32segmentsfuncs = []count32segmentsimpl{{count32segmentsgeneric, "generic", true}}
+var count64segmentsfuncs = []count64segmentsimpl{{count64segmentsgeneric, "generic", true}}
+var count8histfuncs = []count8histimpl{{count8histgeneric, "generic", true}}
+var count16histfuncs = []count16histimpl{{count16histgeneric, "generic", true}}
+var count32histfuncs = []count32histimpl{{count32histgeneric, "generic", true}}
+var count64histfuncs = []count64histimpl{{count64histgeneric, "generic", true}}
+var gather32funcs = []gather32impl{{gather32generic, "generic", true}}
+var gather64funcs = []gather64impl{{gather64generic, "generic", true}}
+var gatherStrided32funcs = []gatherStrided32impl{{gatherStrided32generic, "generic", true}}
+var gatherStrided64funcs = []gatherStrided64impl{{gatherStrided64generic, "generic", true}}
+
+// Runs of fewer elements than one block of the generic kernels are
+// added one element at a time by CountGrouped.
+const groupMinRun = 15
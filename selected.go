@@ -0,0 +1,88 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import "unsafe"
+
+// count the elements buf[sel[k]] into counts by copying them onto
+// a stage one by one
+func countSelected[T Element](counts []int, buf []T, sel []int32) {
+	var s stage[T]
+
+	for _, i := range sel {
+		s.add(counts, buf[i])
+	}
+
+	s.flush(counts)
+}
+
+// count the elements buf[sel[k]] into counts by gathering them onto
+// a stage with the gather kernel, one stage worth at a time
+func countGathered[T uint32 | uint64](counts []int, buf []T, sel []int32, gather func(dst, buf []T, sel []int32)) {
+	var s stage[T]
+
+	for len(sel) > 0 {
+		chunk := sel
+		if len(chunk) > stageLen {
+			chunk = chunk[:stageLen]
+		}
+
+		// the gather kernels do not check bounds
+		for _, i := range chunk {
+			if i < 0 || int(i) >= len(buf) {
+				panic("pospop: selection index out of range")
+			}
+		}
+
+		gather(s.buf[:], buf, chunk)
+		Count(counts, s.buf[:len(chunk)])
+		sel = sel[len(chunk):]
+	}
+}
+
+// Count the number of corresponding set bits of the bytes str[sel[k]],
+// as with CountSelected8.
+func CountStringSelected(counts *[8]int, str string, sel []int32) {
+	buf := unsafe.Slice(unsafe.StringData(str), len(str))
+	countSelected(counts[:], buf, sel)
+}
+
+// Like Count8, but only count the elements buf[sel[k]] selected by
+// the selection vector sel.  Indices may occur more than once and in
+// any order; each occurrence is counted.  CountSelected8 panics if an
+// index is out of range.  There is no gather instruction for bytes, so
+// the elements are copied to a small buffer one by one and counted from
+// there.
+func CountSelected8(counts *[8]int, buf []uint8, sel []int32) {
+	countSelected(counts[:], buf, sel)
+}
+
+// Like Count16, but only count the elements buf[sel[k]] selected by
+// the selection vector sel.  Indices may occur more than once and in
+// any order; each occurrence is counted.  CountSelected16 panics if an
+// index is out of range.  There is no gather instruction for 16 bit
+// words, so the elements are copied to a small buffer one by one and
+// counted from there.
+func CountSelected16(counts *[16]int, buf []uint16, sel []int32) {
+	countSelected(counts[:], buf, sel)
+}
+
+// Like Count32, but only count the elements buf[sel[k]] selected by
+// the selection vector sel.  Indices may occur more than once and in
+// any order; each occurrence is counted.  CountSelected32 panics if an
+// index is out of range.  The elements are gathered into a small buffer
+// using vector gather instructions where available and then counted
+// from there.
+func CountSelected32(counts *[32]int, buf []uint32, sel []int32) {
+	countGathered(counts[:], buf, sel, gather32func)
+}
+
+// Like Count64, but only count the elements buf[sel[k]] selected by
+// the selection vector sel.  Indices may occur more than once and in
+// any order; each occurrence is counted.  CountSelected64 panics if an
+// index is out of range.  The elements are gathered into a small buffer
+// using vector gather instructions where available and then counted
+// from there.
+func CountSelected64(counts *[64]int, buf []uint64, sel []int32) {
+	countGathered(counts[:], buf, sel, gather64func)
+}
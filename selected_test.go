@@ -0,0 +1,113 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// test the correctness of CountSelected64
+func TestCountSelected64(t *testing.T) {
+	buf := make([]uint64, 10000)
+	for i := range buf {
+		buf[i] = rand.Uint64()
+	}
+
+	for _, len := range testLengths {
+		sel := make([]int32, len)
+		gathered := make([]uint64, len)
+		for k := range sel {
+			sel[k] = int32(rand.Intn(cap(buf)))
+			gathered[k] = buf[sel[k]]
+		}
+
+		var counts, refCounts [64]int
+		randomCounts(counts[:])
+		refCounts = counts
+
+		CountSelected64(&counts, buf, sel)
+		count64safe(&refCounts, gathered)
+
+		if counts != refCounts {
+			t.Errorf("length %d: counts don't match: %v\n", len, countDiff(counts[:], refCounts[:]))
+		}
+	}
+}
+
+// test the correctness of CountSelected8 and CountStringSelected
+func TestCountSelected8(t *testing.T) {
+	buf := []uint8{1, 2, 3, 5, 6, 9}
+	sel := []int32{5, 0, 0, 3}
+
+	var counts [8]int
+	CountSelected8(&counts, buf, sel)
+	CountStringSelected(&counts, string(buf), sel[:1])
+	if counts != [8]int{5, 0, 1, 2, 0, 0, 0, 0} {
+		t.Errorf("wrong counts: %v", counts)
+	}
+}
+
+// test the correctness of all available gather32 and gather64
+// implementations
+func TestGather(t *testing.T) {
+	buf32 := make([]uint32, 1000)
+	buf64 := make([]uint64, 1000)
+	for i := range buf64 {
+		buf64[i] = rand.Uint64()
+		buf32[i] = uint32(buf64[i])
+	}
+
+	for _, len := range testLengths {
+		sel := make([]int32, len)
+		for k := range sel {
+			sel[k] = int32(rand.Intn(cap(buf64)))
+		}
+
+		for _, impl := range gather32funcs {
+			if !impl.available {
+				continue
+			}
+
+			dst := make([]uint32, len)
+			impl.gather32(dst, buf32, sel)
+			for k, i := range sel {
+				if dst[k] != buf32[i] {
+					t.Errorf("gather32%s, length %d: wrong element at %d", impl.name, len, k)
+					break
+				}
+			}
+		}
+
+		for _, impl := range gather64funcs {
+			if !impl.available {
+				continue
+			}
+
+			dst := make([]uint64, len)
+			impl.gather64(dst, buf64, sel)
+			for k, i := range sel {
+				if dst[k] != buf64[i] {
+					t.Errorf("gather64%s, length %d: wrong element at %d", impl.name, len, k)
+					break
+				}
+			}
+		}
+	}
+}
+
+// test that CountSelected32 rejects out of range indices
+func TestCountSelectedRange(t *testing.T) {
+	for _, i := range []int32{-1, 10} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("index %d: CountSelected32 did not panic", i)
+				}
+			}()
+
+			var counts [32]int
+			CountSelected32(&counts, make([]uint32, 10), []int32{0, i})
+		}()
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+// SimHash fingerprints.
+//
+// This package computes SimHash fingerprints for near-duplicate
+// detection.  A fingerprint is built from the 64 bit hashes of the
+// features of a document, each with an integer weight: bit j of the
+// fingerprint is set if the weights of the hashes with bit j set
+// outweigh those of the hashes with bit j clear.  Similar documents
+// have fingerprints with a small Hamming distance.  The accumulation
+// is done with the positional population count kernels of package
+// pospop.
+package simhash
+
+import "github.com/clausecker/pospop"
+
+// A Builder accumulates weighted feature hashes into a SimHash
+// fingerprint.  The zero value is an empty builder ready to use.
+type Builder struct {
+	v [64]int64
+}
+
+// Add the feature hash hash with weight weight.
+func (b *Builder) Add(hash uint64, weight int) {
+	for j := range b.v {
+		if hash>>j&1 != 0 {
+			b.v[j] += int64(weight)
+		} else {
+			b.v[j] -= int64(weight)
+		}
+	}
+}
+
+// Add the feature hashes hashes, weighting hashes[i] with weights[i].
+// If weights is nil, all hashes are given a weight of 1.  AddAll
+// panics if weights is not nil and differs from hashes in length.
+func (b *Builder) AddAll(hashes []uint64, weights []int) {
+	if weights != nil {
+		pospop.CountSigned64(&b.v, hashes, weights)
+		return
+	}
+
+	var counts [64]int
+	pospop.Count64(&counts, hashes)
+	for j := range b.v {
+		b.v[j] += 2*int64(counts[j]) - int64(len(hashes))
+	}
+}
+
+// Sum64 returns the fingerprint of the hashes added so far.  Bit j of
+// the fingerprint is set if the total weight for bit j is positive.
+func (b *Builder) Sum64() uint64 {
+	var sum uint64
+
+	for j := range b.v {
+		if b.v[j] > 0 {
+			sum |= 1 << j
+		}
+	}
+
+	return sum
+}
+
+// Reset the builder to the empty state.
+func (b *Builder) Reset() {
+	b.v = [64]int64{}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package simhash
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// test that AddAll gives the same fingerprint as Add
+func TestAddAll(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000, 10000} {
+		hashes := make([]uint64, n)
+		weights := make([]int, n)
+		for i := range hashes {
+			hashes[i] = rand.Uint64()
+			weights[i] = rand.Intn(201) - 100
+		}
+
+		var b, ref Builder
+		b.AddAll(hashes, weights)
+		b.AddAll(hashes, nil)
+		for i := range hashes {
+			ref.Add(hashes[i], weights[i])
+			ref.Add(hashes[i], 1)
+		}
+
+		if b != ref {
+			t.Errorf("length %d: builders don't match: %v, %v", n, b.v, ref.v)
+		}
+
+		if b.Sum64() != ref.Sum64() {
+			t.Errorf("length %d: fingerprints don't match: %#016x, %#016x", n, b.Sum64(), ref.Sum64())
+		}
+	}
+}
+
+// test the fingerprint of a simple example
+func TestSum64(t *testing.T) {
+	var b Builder
+
+	b.Add(0x0f, 3)
+	b.Add(0x3c, 2)
+	b.Add(0xf0, 1)
+
+	// bits 0, 1: +3 -2 -1 = 0; bits 2, 3: +3 +2 -1 = 4;
+	// bits 4, 5: -3 +2 +1 = 0; bits 6, 7: -3 -2 +1 = -4
+	if sum := b.Sum64(); sum != 0x0c {
+		t.Errorf("wrong fingerprint %#x", sum)
+	}
+
+	b.Reset()
+	if sum := b.Sum64(); sum != 0 {
+		t.Errorf("wrong fingerprint after Reset %#x", sum)
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+// Number of elements collected in a staging buffer before they are
+// counted with the kernels.  Large enough to amortise the overhead of
+// calling the kernels, small enough to stay in the L1 cache.
+const stageLen = 960
+
+// A stage collects elements that are computed or selected on the fly
+// and counts them with the regular kernels in batches of stageLen
+// elements.  This way the elements are read from memory only once and
+// the kernels operate on cache-hot data.
+type stage[T Element] struct {
+	buf [stageLen]T
+	n   int
+}
+
+// add x to the stage, counting the stage into counts once full
+func (s *stage[T]) add(counts []int, x T) {
+	s.buf[s.n] = x
+	s.n++
+	if s.n == stageLen {
+		s.flush(counts)
+	}
+}
+
+// count the elements on the stage into counts and clear it
+func (s *stage[T]) flush(counts []int) {
+	Count(counts, s.buf[:s.n])
+	s.n = 0
+}
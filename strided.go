@@ -0,0 +1,160 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import "unsafe"
+
+// count n elements of type T located at base, base+stride,
+// base+2*stride, ... into counts.  32 and 64 bit elements are gathered
+// onto a stage with the strided gather kernels, narrower elements are
+// copied onto the stage one by one.
+func countStrided[T Element](counts []int, base unsafe.Pointer, n, stride uintptr) {
+	var s stage[T]
+	var zero T
+
+	// contiguous elements need not be gathered
+	if stride == unsafe.Sizeof(zero) {
+		Count(counts, unsafe.Slice((*T)(base), n))
+		return
+	}
+
+	switch unsafe.Sizeof(zero) {
+	case 4:
+		countStridedGathered(counts, base, n, stride, gatherStrided32func)
+	case 8:
+		countStridedGathered(counts, base, n, stride, gatherStrided64func)
+	default:
+		for i := uintptr(0); i < n; i++ {
+			s.add(counts, *(*T)(unsafe.Add(base, i*stride)))
+		}
+
+		s.flush(counts)
+	}
+}
+
+// count n elements of type T located at base, base+stride, ... into
+// counts, gathering one stage worth at a time with gather
+func countStridedGathered[T uint32 | uint64](counts []int, base unsafe.Pointer, n, stride uintptr, gather func([]T, unsafe.Pointer, uintptr)) {
+	var s stage[T]
+
+	for n > 0 {
+		m := n
+		if m > stageLen {
+			m = stageLen
+		}
+
+		gather(s.buf[:m], base, stride)
+		Count(counts, s.buf[:m])
+		n -= m
+
+		// do not form a pointer past the last element
+		if n > 0 {
+			base = unsafe.Add(base, m*stride)
+		}
+	}
+}
+
+// count the field of type T at byte offset offset of each record
+// in recs into counts
+func countField[T Element, S any](counts []int, recs []S, offset uintptr) {
+	var rec S
+	var field T
+
+	if offset > unsafe.Sizeof(rec) || unsafe.Sizeof(field) > unsafe.Sizeof(rec)-offset {
+		panic("pospop: field offset out of range")
+	}
+
+	if offset%unsafe.Alignof(field) != 0 {
+		panic("pospop: field offset misaligned")
+	}
+
+	if len(recs) == 0 {
+		return
+	}
+
+	base := unsafe.Add(unsafe.Pointer(unsafe.SliceData(recs)), offset)
+	countStrided[T](counts, base, uintptr(len(recs)), unsafe.Sizeof(rec))
+}
+
+// Count the number of corresponding set bits of the n values of type
+// uint8 located at base, base+stride, base+2*stride, and so on, and
+// add the results to counts as with Count8.  The caller must ensure
+// that all n values lie within the same allocation and are suitably
+// aligned for the platform.  Prefer CountField8 where possible.  The
+// values are copied to a small buffer one by one and counted from
+// there.
+func CountStrided8(counts *[8]int, base unsafe.Pointer, n, stride uintptr) {
+	countStrided[uint8](counts[:], base, n, stride)
+}
+
+// Count the number of corresponding set bits of a 8 bit field of
+// each record in recs and add the results to counts as with Count8.
+// The field is located at byte offset offset into the record type S,
+// as returned by unsafe.Offsetof, and may be of any 8 bit integer
+// type.  CountField8 panics if the field does not fit the record.
+func CountField8[S any](counts *[8]int, recs []S, offset uintptr) {
+	countField[uint8](counts[:], recs, offset)
+}
+
+// Count the number of corresponding set bits of the n values of type
+// uint16 located at base, base+stride, base+2*stride, and so on, and
+// add the results to counts as with Count16.  The caller must ensure
+// that all n values lie within the same allocation and are suitably
+// aligned for the platform.  Prefer CountField16 where possible.  The
+// values are copied to a small buffer one by one and counted from
+// there.
+func CountStrided16(counts *[16]int, base unsafe.Pointer, n, stride uintptr) {
+	countStrided[uint16](counts[:], base, n, stride)
+}
+
+// Count the number of corresponding set bits of a 16 bit field of
+// each record in recs and add the results to counts as with Count16.
+// The field is located at byte offset offset into the record type S,
+// as returned by unsafe.Offsetof, and may be of any 16 bit integer
+// type.  CountField16 panics if the field does not fit the record
+// or if offset is not aligned as required for a 16 bit integer.
+func CountField16[S any](counts *[16]int, recs []S, offset uintptr) {
+	countField[uint16](counts[:], recs, offset)
+}
+
+// Count the number of corresponding set bits of the n values of type
+// uint32 located at base, base+stride, base+2*stride, and so on, and
+// add the results to counts as with Count32.  The caller must ensure
+// that all n values lie within the same allocation and are suitably
+// aligned for the platform.  Prefer CountField32 where possible.  The
+// values are collected with vector gather instructions where available
+// and then counted with the regular kernels.
+func CountStrided32(counts *[32]int, base unsafe.Pointer, n, stride uintptr) {
+	countStrided[uint32](counts[:], base, n, stride)
+}
+
+// Count the number of corresponding set bits of a 32 bit field of
+// each record in recs and add the results to counts as with Count32.
+// The field is located at byte offset offset into the record type S,
+// as returned by unsafe.Offsetof, and may be of any 32 bit integer
+// type.  CountField32 panics if the field does not fit the record
+// or if offset is not aligned as required for a 32 bit integer.
+func CountField32[S any](counts *[32]int, recs []S, offset uintptr) {
+	countField[uint32](counts[:], recs, offset)
+}
+
+// Count the number of corresponding set bits of the n values of type
+// uint64 located at base, base+stride, base+2*stride, and so on, and
+// add the results to counts as with Count64.  The caller must ensure
+// that all n values lie within the same allocation and are suitably
+// aligned for the platform.  Prefer CountField64 where possible.  The
+// values are collected with vector gather instructions where available
+// and then counted with the regular kernels.
+func CountStrided64(counts *[64]int, base unsafe.Pointer, n, stride uintptr) {
+	countStrided[uint64](counts[:], base, n, stride)
+}
+
+// Count the number of corresponding set bits of a 64 bit field of
+// each record in recs and add the results to counts as with Count64.
+// The field is located at byte offset offset into the record type S,
+// as returned by unsafe.Offsetof, and may be of any 64 bit integer
+// type.  CountField64 panics if the field does not fit the record
+// or if offset is not aligned as required for a 64 bit integer.
+func CountField64[S any](counts *[64]int, recs []S, offset uintptr) {
+	countField[uint64](counts[:], recs, offset)
+}
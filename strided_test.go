@@ -0,0 +1,164 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/rand"
+	"testing"
+	"unsafe"
+)
+
+type testRecord struct {
+	ID    uint64
+	Flags uint32
+	Pad   uint32
+	Tag   int16
+}
+
+// test the correctness of CountField32 and CountField16
+func TestCountField(t *testing.T) {
+	for _, len := range testLengths {
+		recs := make([]testRecord, len)
+		flags := make([]uint32, len)
+		tags := make([]uint16, len)
+		for i := range recs {
+			recs[i] = testRecord{rand.Uint64(), rand.Uint32(), rand.Uint32(), int16(rand.Int())}
+			flags[i] = recs[i].Flags
+			tags[i] = uint16(recs[i].Tag)
+		}
+
+		var counts32, refCounts32 [32]int
+		var counts16, refCounts16 [16]int
+		randomCounts(counts32[:])
+		randomCounts(counts16[:])
+		refCounts32, refCounts16 = counts32, counts16
+
+		CountField32(&counts32, recs, unsafe.Offsetof(testRecord{}.Flags))
+		CountField16(&counts16, recs, unsafe.Offsetof(testRecord{}.Tag))
+		count32safe(&refCounts32, flags)
+		count16safe(&refCounts16, tags)
+
+		if counts32 != refCounts32 {
+			t.Errorf("length %d: Flags counts don't match: %v\n", len, countDiff(counts32[:], refCounts32[:]))
+		}
+
+		if counts16 != refCounts16 {
+			t.Errorf("length %d: Tag counts don't match: %v\n", len, countDiff(counts16[:], refCounts16[:]))
+		}
+	}
+}
+
+// test CountStrided64 with a contiguous buffer and with a stride
+func TestCountStrided64(t *testing.T) {
+	buf := make([]uint64, 3001)
+	for i := range buf {
+		buf[i] = rand.Uint64()
+	}
+
+	var counts, refCounts [64]int
+	CountStrided64(&counts, unsafe.Pointer(&buf[0]), uintptr(len(buf)), 8)
+	CountStrided64(&counts, unsafe.Pointer(&buf[1]), 1000, 24)
+	count64safe(&refCounts, buf)
+	for i := 1; i < len(buf); i += 3 {
+		count64safe(&refCounts, buf[i:i+1])
+	}
+
+	if counts != refCounts {
+		t.Errorf("counts don't match: %v\n", countDiff(counts[:], refCounts[:]))
+	}
+}
+
+// test that CountField64 rejects fields that do not fit the record
+func TestCountFieldRange(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("CountField64 did not panic")
+		}
+	}()
+
+	var counts [64]int
+	CountField64(&counts, make([]testRecord, 1), unsafe.Sizeof(testRecord{})-4)
+}
+
+// test that CountField32 rejects misaligned field offsets
+func TestCountFieldAlignment(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("CountField32 did not panic")
+		}
+	}()
+
+	var counts [32]int
+	CountField32(&counts, make([]testRecord, 1), 2)
+}
+
+// test the correctness of all available gatherStrided32 and
+// gatherStrided64 implementations
+func TestGatherStrided(t *testing.T) {
+	buf := make([]uint64, 5000)
+	for i := range buf {
+		buf[i] = rand.Uint64()
+	}
+
+	for _, len := range testLengths {
+		// stride 5 words, 32 bit elements at the upper half
+		base := unsafe.Pointer(&buf[1])
+		n := (cap(buf) - 1 + 4) / 5
+		if len < n {
+			n = len
+		}
+
+		for _, impl := range gatherStrided32funcs {
+			if !impl.available {
+				continue
+			}
+
+			dst := make([]uint32, n)
+			impl.gatherStrided32(dst, unsafe.Add(base, 4), 40)
+			for k := range dst {
+				if dst[k] != *(*uint32)(unsafe.Add(unsafe.Pointer(&buf[1+5*k]), 4)) {
+					t.Errorf("gatherStrided32%s, length %d: wrong element at %d", impl.name, n, k)
+					break
+				}
+			}
+		}
+
+		for _, impl := range gatherStrided64funcs {
+			if !impl.available {
+				continue
+			}
+
+			dst := make([]uint64, n)
+			impl.gatherStrided64(dst, base, 40)
+			for k := range dst {
+				if dst[k] != buf[1+5*k] {
+					t.Errorf("gatherStrided64%s, length %d: wrong element at %d", impl.name, n, k)
+					break
+				}
+			}
+		}
+	}
+}
+
+// test CountField64 on a field that is only 4 byte aligned on 32 bit
+// platforms
+func TestCountFieldOffset(t *testing.T) {
+	type rec struct {
+		ID    uint32
+		Flags uint64
+	}
+
+	recs := make([]rec, 100)
+	flags := make([]uint64, len(recs))
+	for i := range recs {
+		recs[i] = rec{rand.Uint32(), rand.Uint64()}
+		flags[i] = recs[i].Flags
+	}
+
+	var counts, refCounts [64]int
+	CountField64(&counts, recs, unsafe.Offsetof(rec{}.Flags))
+	count64safe(&refCounts, flags)
+	if counts != refCounts {
+		t.Errorf("counts don't match: %v\n", countDiff(counts[:], refCounts[:]))
+	}
+}
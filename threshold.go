@@ -0,0 +1,115 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import "unsafe"
+
+// Number of elements counted before checking whether the outcome of
+// a threshold vote is already decided.
+const thresholdChunkLen = 16 * stageLen
+
+// Return the word whose bit j is set iff at least k elements of buf
+// have bit j set.  The buffer is counted in chunks.  After each chunk,
+// a bit is decided if its count has reached k or if it cannot reach
+// k anymore with the elements remaining.  Once all bits are decided,
+// the rest of the buffer is skipped.
+func threshold[T word](buf []T, k int) T {
+	var counts [64]int
+	var zero T
+	bits := 8 * int(unsafe.Sizeof(zero))
+	all := ^T(0)
+
+	if k <= 0 {
+		return all
+	} else if k > len(buf) {
+		return 0
+	}
+
+	var result T
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > thresholdChunkLen {
+			n = thresholdChunkLen
+		}
+
+		Count(counts[:bits], buf[:n])
+		buf = buf[n:]
+
+		var decided T
+		result = 0
+		for j := 0; j < bits; j++ {
+			if counts[j] >= k {
+				result |= 1 << j
+				decided |= 1 << j
+			} else if counts[j]+len(buf) < k {
+				decided |= 1 << j
+			}
+		}
+
+		if decided == all {
+			break
+		}
+	}
+
+	return result
+}
+
+// Return the bitwise majority of the values in buf: bit j of the
+// result is set iff more than half of the values have bit j set.  This
+// is the same as Threshold8(buf, len(buf)/2+1).
+func Majority8(buf []uint8) uint8 {
+	return threshold(buf, len(buf)/2+1)
+}
+
+// Return the bitwise threshold vote of the values in buf: bit j of the
+// result is set iff at least k of the values have bit j set, i.e. iff
+// counts[j] >= k after Count8(&counts, buf).  The counting stops
+// early once the outcome is decided for every bit.
+func Threshold8(buf []uint8, k int) uint8 {
+	return threshold(buf, k)
+}
+
+// Return the bitwise majority of the values in buf: bit j of the
+// result is set iff more than half of the values have bit j set.  This
+// is the same as Threshold16(buf, len(buf)/2+1).
+func Majority16(buf []uint16) uint16 {
+	return threshold(buf, len(buf)/2+1)
+}
+
+// Return the bitwise threshold vote of the values in buf: bit j of the
+// result is set iff at least k of the values have bit j set, i.e. iff
+// counts[j] >= k after Count16(&counts, buf).  The counting stops
+// early once the outcome is decided for every bit.
+func Threshold16(buf []uint16, k int) uint16 {
+	return threshold(buf, k)
+}
+
+// Return the bitwise majority of the values in buf: bit j of the
+// result is set iff more than half of the values have bit j set.  This
+// is the same as Threshold32(buf, len(buf)/2+1).
+func Majority32(buf []uint32) uint32 {
+	return threshold(buf, len(buf)/2+1)
+}
+
+// Return the bitwise threshold vote of the values in buf: bit j of the
+// result is set iff at least k of the values have bit j set, i.e. iff
+// counts[j] >= k after Count32(&counts, buf).  The counting stops
+// early once the outcome is decided for every bit.
+func Threshold32(buf []uint32, k int) uint32 {
+	return threshold(buf, k)
+}
+
+// Return the bitwise majority of the values in buf: bit j of the
+// result is set iff more than half of the values have bit j set.  This
+// is the same as Threshold64(buf, len(buf)/2+1).
+func Majority64(buf []uint64) uint64 {
+	return threshold(buf, len(buf)/2+1)
+}
+
+// Return the bitwise threshold vote of the values in buf: bit j of the
+// result is set iff at least k of the values have bit j set, i.e. iff
+// counts[j] >= k after Count64(&counts, buf).  The counting stops
+// early once the outcome is decided for every bit.
+func Threshold64(buf []uint64, k int) uint64 {
+	return threshold(buf, k)
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// compute the threshold vote from the output of count64safe
+func threshold64safe(buf []uint64, k int) uint64 {
+	var counts [64]int
+	var result uint64
+
+	count64safe(&counts, buf)
+	for j := range counts {
+		if counts[j] >= k {
+			result |= 1 << j
+		}
+	}
+
+	return result
+}
+
+// test the correctness of Threshold64 and Majority64
+func TestThreshold64(t *testing.T) {
+	for _, len := range testLengths {
+		buf := make([]uint64, len)
+		for i := range buf {
+			// bias some bits so they are decided early
+			buf[i] = rand.Uint64() | 0xff&rand.Uint64() | 0xff00
+		}
+
+		for _, k := range []int{-1, 0, 1, len / 4, len / 2, len/2 + 1, len, len + 1} {
+			if got, want := Threshold64(buf, k), threshold64safe(buf, k); got != want {
+				t.Errorf("length %d, k = %d: got %#016x, expected %#016x", len, k, got, want)
+			}
+		}
+
+		if got, want := Majority64(buf), threshold64safe(buf, len/2+1); got != want {
+			t.Errorf("length %d: majority %#016x, expected %#016x", len, got, want)
+		}
+	}
+}
+
+// test Majority8 on a simple example
+func TestMajority8(t *testing.T) {
+	if m := Majority8([]uint8{0x03, 0x05, 0x06, 0x0f}); m != 0x07 {
+		t.Errorf("got %#02x, expected 0x07", m)
+	}
+
+	if m := Majority8([]uint8{0x03, 0x05}); m != 0x01 {
+		t.Errorf("got %#02x, expected 0x01", m)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+// count the bits toggled between consecutive elements of buf, with
+// prev preceding buf[0], and return the last element.  The fused XOR
+// kernel combines buf[1:] with buf[:len(buf)-1], i.e. each element
+// with its predecessor as it is loaded.
+func countToggles[T word](counts []int, buf []T, prev T) T {
+	if len(buf) == 0 {
+		return prev
+	}
+
+	first := [1]T{prev ^ buf[0]}
+	addBits(counts, first[:])
+	countBinop(counts, buf[1:], buf[:len(buf)-1], opXor)
+
+	return buf[len(buf)-1]
+}
+
+// Count how often each bit changes between consecutive values in buf
+// and add the results to counts as with Count8.  The value prev is
+// taken to precede buf[0], so the changes from prev to buf[0] are
+// counted, too.  The last value of buf (or prev if buf is empty) is
+// returned so a stream can be processed in several calls.
+func CountToggles8(counts *[8]int, buf []uint8, prev uint8) uint8 {
+	return countToggles(counts[:], buf, prev)
+}
+
+// Count how often each bit changes between consecutive values in buf
+// and add the results to counts as with Count16.  The value prev is
+// taken to precede buf[0], so the changes from prev to buf[0] are
+// counted, too.  The last value of buf (or prev if buf is empty) is
+// returned so a stream can be processed in several calls.
+func CountToggles16(counts *[16]int, buf []uint16, prev uint16) uint16 {
+	return countToggles(counts[:], buf, prev)
+}
+
+// Count how often each bit changes between consecutive values in buf
+// and add the results to counts as with Count32.  The value prev is
+// taken to precede buf[0], so the changes from prev to buf[0] are
+// counted, too.  The last value of buf (or prev if buf is empty) is
+// returned so a stream can be processed in several calls.
+func CountToggles32(counts *[32]int, buf []uint32, prev uint32) uint32 {
+	return countToggles(counts[:], buf, prev)
+}
+
+// Count how often each bit changes between consecutive values in buf
+// and add the results to counts as with Count64.  The value prev is
+// taken to precede buf[0], so the changes from prev to buf[0] are
+// counted, too.  The last value of buf (or prev if buf is empty) is
+// returned so a stream can be processed in several calls.
+func CountToggles64(counts *[64]int, buf []uint64, prev uint64) uint64 {
+	return countToggles(counts[:], buf, prev)
+}
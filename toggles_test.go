@@ -0,0 +1,56 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// test the correctness of CountToggles32, including chained calls
+func TestCountToggles32(t *testing.T) {
+	for _, len := range testLengths {
+		buf := make([]uint32, len)
+		delta := make([]uint32, len)
+		prev := rand.Uint32()
+		for i := range buf {
+			buf[i] = rand.Uint32()
+			if i == 0 {
+				delta[i] = buf[i] ^ prev
+			} else {
+				delta[i] = buf[i] ^ buf[i-1]
+			}
+		}
+
+		var counts, refCounts [32]int
+		randomCounts(counts[:])
+		refCounts = counts
+
+		split := len / 3
+		last := CountToggles32(&counts, buf[:split], prev)
+		last = CountToggles32(&counts, buf[split:], last)
+		count32safe(&refCounts, delta)
+
+		if counts != refCounts {
+			t.Errorf("length %d: counts don't match: %v\n", len, countDiff(counts[:], refCounts[:]))
+		}
+
+		want := prev
+		if len > 0 {
+			want = buf[len-1]
+		}
+
+		if last != want {
+			t.Errorf("length %d: returned %#x, expected %#x", len, last, want)
+		}
+	}
+}
+
+// test CountToggles8 on a simple example
+func TestCountToggles8(t *testing.T) {
+	var counts [8]int
+	last := CountToggles8(&counts, []uint8{0x01, 0x03, 0x02}, 0x00)
+	if counts != [8]int{2, 1, 0, 0, 0, 0, 0, 0} || last != 0x02 {
+		t.Errorf("wrong counts %v or last value %#x", counts, last)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import "unsafe"
+
+// Subtract the positional population count of buf from counts.  As
+// -(-c + x) = c - x holds in two's complement arithmetic even if
+// intermediate results wrap around, this is done by negating the
+// counters before and after counting with the regular kernels.  This
+// costs a few instructions per call, but nothing per element.
+func uncount[T Element](counts []int, buf []T) {
+	for i := range counts {
+		counts[i] = -counts[i]
+	}
+
+	Count(counts, buf)
+
+	for i := range counts {
+		counts[i] = -counts[i]
+	}
+}
+
+// Count the number of corresponding set bits of the bytes in str and
+// subtract the results from counts.  This is the inverse of
+// CountString.
+func UncountString(counts *[8]int, str string) {
+	buf := unsafe.Slice(unsafe.StringData(str), len(str))
+	uncount(counts[:], buf)
+}
+
+// Count the number of corresponding set bits of the bytes in buf and
+// subtract the results from counts.  This is the inverse of Count8.
+func Uncount8(counts *[8]int, buf []uint8) {
+	uncount(counts[:], buf)
+}
+
+// Count the number of corresponding set bits of the values in buf and
+// subtract the results from counts.  This is the inverse of Count16.
+func Uncount16(counts *[16]int, buf []uint16) {
+	uncount(counts[:], buf)
+}
+
+// Count the number of corresponding set bits of the values in buf and
+// subtract the results from counts.  This is the inverse of Count32.
+func Uncount32(counts *[32]int, buf []uint32) {
+	uncount(counts[:], buf)
+}
+
+// Count the number of corresponding set bits of the values in buf and
+// subtract the results from counts.  This is the inverse of Count64.
+func Uncount64(counts *[64]int, buf []uint64) {
+	uncount(counts[:], buf)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// test the correctness of Uncount64
+func TestUncount64(t *testing.T) {
+	for _, len := range testLengths {
+		buf := make([]uint64, len)
+		for i := range buf {
+			buf[i] = rand.Uint64()
+		}
+
+		var counts, refCounts, delta [64]int
+		randomCounts(counts[:])
+		count64safe(&delta, buf)
+		for i := range refCounts {
+			refCounts[i] = counts[i] - delta[i]
+		}
+
+		Uncount64(&counts, buf)
+		if counts != refCounts {
+			t.Errorf("length %d: counts don't match: %v\n", len, countDiff(counts[:], refCounts[:]))
+		}
+	}
+}
+
+// test that the other Uncount functions undo their Count counterparts
+func TestUncount(t *testing.T) {
+	buf := make([]uint32, 1025)
+	for i := range buf {
+		buf[i] = rand.Uint32()
+	}
+
+	b8 := make([]uint8, len(buf))
+	b16 := make([]uint16, len(buf))
+	for i, x := range buf {
+		b8[i], b16[i] = uint8(x), uint16(x)
+	}
+
+	var counts8, ref8 [8]int
+	var counts16, ref16 [16]int
+	var counts32, ref32 [32]int
+	randomCounts(counts8[:])
+	randomCounts(counts16[:])
+	randomCounts(counts32[:])
+	ref8, ref16, ref32 = counts8, counts16, counts32
+
+	Count8(&counts8, b8)
+	UncountString(&counts8, string(b8))
+	Count8(&counts8, b8)
+	Uncount8(&counts8, b8)
+	Count16(&counts16, b16)
+	Uncount16(&counts16, b16)
+	Count32(&counts32, buf)
+	Uncount32(&counts32, buf)
+
+	if counts8 != ref8 {
+		t.Errorf("Uncount8: counts don't match: %v\n", countDiff(counts8[:], ref8[:]))
+	}
+
+	if counts16 != ref16 {
+		t.Errorf("Uncount16: counts don't match: %v\n", countDiff(counts16[:], ref16[:]))
+	}
+
+	if counts32 != ref32 {
+		t.Errorf("Uncount32: counts don't match: %v\n", countDiff(counts32[:], ref32[:]))
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+// Weighted positional population counts are computed by slicing the
+// weights into bits: with w[i] = sum(w_k[i] << k), the weighted count
+// of bit j is sum(count_j(buf[i] for which w_k[i] is set) << k) summed
+// over all weight bits k.  For each weight bit, the elements whose
+// weight has that bit clear are masked out and the rest is counted
+// with the regular kernels.  The buffer is processed in chunks of
+// stageLen elements, and weight bits that are clear in all weights of
+// a chunk are skipped.
+
+// add (or if sub is set, subtract) sum(mag[i] * bit_j(chunk[i])) to
+// counts[j] for each j, using s as scratch space.
+func addWeightedChunk[T word, M uint32 | uint64](counts []int64, chunk []T, mag []M, sub bool, s *stage[T]) {
+	var local [64]int
+
+	// weight bits set in any weight of the chunk
+	var seen M
+	for _, m := range mag {
+		seen |= m
+	}
+
+	for k := 0; seen>>k != 0; k++ {
+		if seen>>k&1 == 0 {
+			continue
+		}
+
+		masked := s.buf[:len(chunk)]
+		for i, x := range chunk {
+			masked[i] = x & -T(mag[i]>>k&1)
+		}
+
+		for j := range counts {
+			local[j] = 0
+		}
+
+		Count(local[:len(counts)], masked)
+		for j := range counts {
+			if sub {
+				counts[j] -= int64(local[j]) << k
+			} else {
+				counts[j] += int64(local[j]) << k
+			}
+		}
+	}
+}
+
+// add sum(w[i] * bit_j(buf[i])) to counts[j] for each j
+func countWeighted[T word](counts []int64, buf []T, w []uint32) {
+	var s stage[T]
+
+	if len(buf) != len(w) {
+		panic("pospop: buffer and weights differ in length")
+	}
+
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > stageLen {
+			n = stageLen
+		}
+
+		addWeightedChunk(counts, buf[:n], w[:n], false, &s)
+		buf, w = buf[n:], w[n:]
+	}
+}
+
+// Count the number of corresponding set bits of the values in buf,
+// weighting each value buf[i] with w[i], and add the results to counts.
+// That is, counts[j] is incremented by the sum of w[i] over all i for
+// which bit j of buf[i] is set.  The counters are as with Count8.
+// CountWeighted8 panics if buf and w differ in length.
+func CountWeighted8(counts *[8]int64, buf []uint8, w []uint32) {
+	countWeighted(counts[:], buf, w)
+}
+
+// Count the number of corresponding set bits of the values in buf,
+// weighting each value buf[i] with w[i], and add the results to counts.
+// That is, counts[j] is incremented by the sum of w[i] over all i for
+// which bit j of buf[i] is set.  The counters are as with Count16.
+// CountWeighted16 panics if buf and w differ in length.
+func CountWeighted16(counts *[16]int64, buf []uint16, w []uint32) {
+	countWeighted(counts[:], buf, w)
+}
+
+// Count the number of corresponding set bits of the values in buf,
+// weighting each value buf[i] with w[i], and add the results to counts.
+// That is, counts[j] is incremented by the sum of w[i] over all i for
+// which bit j of buf[i] is set.  The counters are as with Count32.
+// CountWeighted32 panics if buf and w differ in length.
+func CountWeighted32(counts *[32]int64, buf []uint32, w []uint32) {
+	countWeighted(counts[:], buf, w)
+}
+
+// Count the number of corresponding set bits of the values in buf,
+// weighting each value buf[i] with w[i], and add the results to counts.
+// That is, counts[j] is incremented by the sum of w[i] over all i for
+// which bit j of buf[i] is set.  The counters are as with Count64.
+// CountWeighted64 panics if buf and w differ in length.
+func CountWeighted64(counts *[64]int64, buf []uint64, w []uint32) {
+	countWeighted(counts[:], buf, w)
+}
+
+// add sum(w[i] * (2*bit_j(buf[i]) - 1)) to counts[j] for each j.  This
+// is 2*S_j - W where S_j is the weighted count of bit j and W is the
+// sum of all weights.  Positive and negative weights are sliced into
+// bits separately so small negative weights stay cheap.
+func countSigned[T word](counts []int64, buf []T, w []int) {
+	var s stage[T]
+	var pos, neg [stageLen]uint64
+	var sum [64]int64
+	var total int64
+
+	if len(buf) != len(w) {
+		panic("pospop: buffer and weights differ in length")
+	}
+
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > stageLen {
+			n = stageLen
+		}
+
+		for i, x := range w[:n] {
+			if x >= 0 {
+				pos[i], neg[i] = uint64(x), 0
+			} else {
+				pos[i], neg[i] = 0, -uint64(x)
+			}
+
+			total += int64(x)
+		}
+
+		addWeightedChunk(sum[:len(counts)], buf[:n], pos[:n], false, &s)
+		addWeightedChunk(sum[:len(counts)], buf[:n], neg[:n], true, &s)
+		buf, w = buf[n:], w[n:]
+	}
+
+	for j := range counts {
+		counts[j] += 2*sum[j] - total
+	}
+}
+
+// Count the values in buf with signed weights w and add the results
+// to counts: for each value buf[i], counts[j] is incremented by w[i]
+// if bit j of buf[i] is set and decremented by w[i] if it is clear.
+// The counters are as with Count8.  This is the accumulation step of
+// SimHash.  CountSigned8 panics if buf and w differ in length.
+func CountSigned8(counts *[8]int64, buf []uint8, w []int) {
+	countSigned(counts[:], buf, w)
+}
+
+// Count the values in buf with signed weights w and add the results
+// to counts: for each value buf[i], counts[j] is incremented by w[i]
+// if bit j of buf[i] is set and decremented by w[i] if it is clear.
+// The counters are as with Count16.  This is the accumulation step of
+// SimHash.  CountSigned16 panics if buf and w differ in length.
+func CountSigned16(counts *[16]int64, buf []uint16, w []int) {
+	countSigned(counts[:], buf, w)
+}
+
+// Count the values in buf with signed weights w and add the results
+// to counts: for each value buf[i], counts[j] is incremented by w[i]
+// if bit j of buf[i] is set and decremented by w[i] if it is clear.
+// The counters are as with Count32.  This is the accumulation step of
+// SimHash.  CountSigned32 panics if buf and w differ in length.
+func CountSigned32(counts *[32]int64, buf []uint32, w []int) {
+	countSigned(counts[:], buf, w)
+}
+
+// Count the values in buf with signed weights w and add the results
+// to counts: for each value buf[i], counts[j] is incremented by w[i]
+// if bit j of buf[i] is set and decremented by w[i] if it is clear.
+// The counters are as with Count64.  This is the accumulation step of
+// SimHash.  CountSigned64 panics if buf and w differ in length.
+func CountSigned64(counts *[64]int64, buf []uint64, w []int) {
+	countSigned(counts[:], buf, w)
+}
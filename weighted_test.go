@@ -0,0 +1,91 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// test the correctness of CountWeighted16 with small and large weights
+func TestCountWeighted16(t *testing.T) {
+	for _, wmax := range []uint32{1, 1500, 1<<32 - 1} {
+		for _, len := range testLengths {
+			buf := make([]uint16, len)
+			w := make([]uint32, len)
+			for i := range buf {
+				buf[i] = uint16(rand.Int())
+				w[i] = uint32(rand.Int63n(int64(wmax) + 1))
+			}
+
+			var counts, refCounts [16]int64
+			for i := range counts {
+				counts[i] = rand.Int63n(1 << 40)
+			}
+
+			refCounts = counts
+			CountWeighted16(&counts, buf, w)
+			for i, x := range buf {
+				for j := range refCounts {
+					refCounts[j] += int64(x>>j&1) * int64(w[i])
+				}
+			}
+
+			if counts != refCounts {
+				t.Errorf("maximum weight %d, length %d: counts don't match: %v, %v\n", wmax, len, counts, refCounts)
+			}
+		}
+	}
+}
+
+// test the correctness of CountWeighted64
+func TestCountWeighted64(t *testing.T) {
+	buf := make([]uint64, 3000)
+	w := make([]uint32, len(buf))
+	for i := range buf {
+		buf[i] = rand.Uint64()
+		w[i] = rand.Uint32()
+	}
+
+	var counts, refCounts [64]int64
+	CountWeighted64(&counts, buf, w)
+	for i, x := range buf {
+		for j := range refCounts {
+			refCounts[j] += int64(x>>j&1) * int64(w[i])
+		}
+	}
+
+	if counts != refCounts {
+		t.Errorf("counts don't match: %v, %v\n", counts, refCounts)
+	}
+}
+
+// test the correctness of CountSigned64
+func TestCountSigned64(t *testing.T) {
+	for _, wmax := range []int{1, 100, 1<<31 - 1, int(^uint(0) >> 20)} {
+		for _, len := range testLengths {
+			buf := make([]uint64, len)
+			w := make([]int, len)
+			for i := range buf {
+				buf[i] = rand.Uint64()
+				w[i] = int(rand.Int63n(2*int64(wmax)+2) - int64(wmax) - 1)
+			}
+
+			var counts, refCounts [64]int64
+			CountSigned64(&counts, buf, w)
+			for i, x := range buf {
+				for j := range refCounts {
+					if x>>j&1 != 0 {
+						refCounts[j] += int64(w[i])
+					} else {
+						refCounts[j] -= int64(w[i])
+					}
+				}
+			}
+
+			if counts != refCounts {
+				t.Errorf("maximum weight %d, length %d: counts don't match: %v, %v\n", wmax, len, counts, refCounts)
+			}
+		}
+	}
+}
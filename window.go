@@ -0,0 +1,244 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import "unsafe"
+
+// sliding window over the last len(ring) elements pushed, keeping
+// track of their positional population count.  The elements are kept
+// in a ring buffer so expiring elements can be uncounted.
+type window[T Element] struct {
+	counts [64]int
+	ring   []T
+	pos    int // position of next element to write to
+	n      int // number of elements in the window
+}
+
+func newWindow[T Element](size int) window[T] {
+	if size < 0 {
+		panic("pospop: negative window size")
+	}
+
+	return window[T]{ring: make([]T, size)}
+}
+
+// number of counters used for elements of type T
+func (w *window[T]) bits() int {
+	var zero T
+
+	return 8 * int(unsafe.Sizeof(zero))
+}
+
+// add batch to the window, expiring the oldest elements as needed
+func (w *window[T]) push(batch []T) {
+	size := len(w.ring)
+	counts := w.counts[:w.bits()]
+
+	// whole window replaced?  Start from scratch.
+	if len(batch) >= size {
+		w.reset()
+		copy(w.ring, batch[len(batch)-size:])
+		w.n = size
+		Count(counts, w.ring)
+
+		return
+	}
+
+	// write batch in at most two segments.  As long as the window
+	// has not yet filled up, the ring buffer has not wrapped around
+	// and all slots from pos onwards are empty.
+	for len(batch) > 0 {
+		k := size - w.pos
+		if k > len(batch) {
+			k = len(batch)
+		}
+
+		seg := w.ring[w.pos : w.pos+k]
+		if w.n == size {
+			uncount(counts, seg)
+		} else {
+			w.n += k
+		}
+
+		copy(seg, batch[:k])
+		Count(counts, seg)
+
+		w.pos += k
+		if w.pos == size {
+			w.pos = 0
+		}
+
+		batch = batch[k:]
+	}
+}
+
+// remove all elements from the window
+func (w *window[T]) reset() {
+	w.counts = [64]int{}
+	w.pos = 0
+	w.n = 0
+}
+
+// Window8 tracks the positional population count of the most recent
+// elements of a stream of uint8 values, up to a fixed window size.
+// The counters are as with Count8.  The zero value is a window of
+// size 0.
+type Window8 struct {
+	w window[uint8]
+}
+
+// NewWindow8 returns a new, empty window holding up to size elements.
+func NewWindow8(size int) *Window8 {
+	return &Window8{newWindow[uint8](size)}
+}
+
+// Push adds the elements of batch to the window.  If the window
+// overflows, the oldest elements are dropped and their contribution to
+// the counts is removed.
+func (w *Window8) Push(batch []uint8) {
+	w.w.push(batch)
+}
+
+// Counts returns the positional population count of the elements
+// currently in the window.
+func (w *Window8) Counts() Counts8 {
+	return Counts8(w.w.counts[:8])
+}
+
+// Len returns the number of elements currently in the window.
+func (w *Window8) Len() int {
+	return w.w.n
+}
+
+// Size returns the maximum number of elements in the window.
+func (w *Window8) Size() int {
+	return len(w.w.ring)
+}
+
+// Reset removes all elements from the window.
+func (w *Window8) Reset() {
+	w.w.reset()
+}
+
+// Window16 tracks the positional population count of the most recent
+// elements of a stream of uint16 values, up to a fixed window size.
+// The counters are as with Count16.  The zero value is a window of
+// size 0.
+type Window16 struct {
+	w window[uint16]
+}
+
+// NewWindow16 returns a new, empty window holding up to size elements.
+func NewWindow16(size int) *Window16 {
+	return &Window16{newWindow[uint16](size)}
+}
+
+// Push adds the elements of batch to the window.  If the window
+// overflows, the oldest elements are dropped and their contribution to
+// the counts is removed.
+func (w *Window16) Push(batch []uint16) {
+	w.w.push(batch)
+}
+
+// Counts returns the positional population count of the elements
+// currently in the window.
+func (w *Window16) Counts() Counts16 {
+	return Counts16(w.w.counts[:16])
+}
+
+// Len returns the number of elements currently in the window.
+func (w *Window16) Len() int {
+	return w.w.n
+}
+
+// Size returns the maximum number of elements in the window.
+func (w *Window16) Size() int {
+	return len(w.w.ring)
+}
+
+// Reset removes all elements from the window.
+func (w *Window16) Reset() {
+	w.w.reset()
+}
+
+// Window32 tracks the positional population count of the most recent
+// elements of a stream of uint32 values, up to a fixed window size.
+// The counters are as with Count32.  The zero value is a window of
+// size 0.
+type Window32 struct {
+	w window[uint32]
+}
+
+// NewWindow32 returns a new, empty window holding up to size elements.
+func NewWindow32(size int) *Window32 {
+	return &Window32{newWindow[uint32](size)}
+}
+
+// Push adds the elements of batch to the window.  If the window
+// overflows, the oldest elements are dropped and their contribution to
+// the counts is removed.
+func (w *Window32) Push(batch []uint32) {
+	w.w.push(batch)
+}
+
+// Counts returns the positional population count of the elements
+// currently in the window.
+func (w *Window32) Counts() Counts32 {
+	return Counts32(w.w.counts[:32])
+}
+
+// Len returns the number of elements currently in the window.
+func (w *Window32) Len() int {
+	return w.w.n
+}
+
+// Size returns the maximum number of elements in the window.
+func (w *Window32) Size() int {
+	return len(w.w.ring)
+}
+
+// Reset removes all elements from the window.
+func (w *Window32) Reset() {
+	w.w.reset()
+}
+
+// Window64 tracks the positional population count of the most recent
+// elements of a stream of uint64 values, up to a fixed window size.
+// The counters are as with Count64.  The zero value is a window of
+// size 0.
+type Window64 struct {
+	w window[uint64]
+}
+
+// NewWindow64 returns a new, empty window holding up to size elements.
+func NewWindow64(size int) *Window64 {
+	return &Window64{newWindow[uint64](size)}
+}
+
+// Push adds the elements of batch to the window.  If the window
+// overflows, the oldest elements are dropped and their contribution to
+// the counts is removed.
+func (w *Window64) Push(batch []uint64) {
+	w.w.push(batch)
+}
+
+// Counts returns the positional population count of the elements
+// currently in the window.
+func (w *Window64) Counts() Counts64 {
+	return Counts64(w.w.counts[:64])
+}
+
+// Len returns the number of elements currently in the window.
+func (w *Window64) Len() int {
+	return w.w.n
+}
+
+// Size returns the maximum number of elements in the window.
+func (w *Window64) Size() int {
+	return len(w.w.ring)
+}
+
+// Reset removes all elements from the window.
+func (w *Window64) Reset() {
+	w.w.reset()
+}
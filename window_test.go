@@ -0,0 +1,49 @@
+// Copyright (c) 2026 Robert Clausecker <fuz@fuz.su>
+
+package pospop
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// test the correctness of Window16 by pushing batches of random size
+// and comparing the counts with those of the most recent elements
+func TestWindow16(t *testing.T) {
+	for _, size := range []int{0, 1, 7, 240, 1000} {
+		w := NewWindow16(size)
+		var history []uint16
+
+		for i := 0; i < 100; i++ {
+			batch := make([]uint16, rand.Intn(2*size+2))
+			for j := range batch {
+				batch[j] = uint16(rand.Uint32())
+			}
+
+			w.Push(batch)
+			history = append(history, batch...)
+
+			first := len(history) - size
+			if first < 0 {
+				first = 0
+			}
+
+			var refCounts [16]int
+			count16safe(&refCounts, history[first:])
+
+			counts := w.Counts()
+			if [16]int(counts) != refCounts {
+				t.Fatalf("size %d, push %d: counts don't match: %v\n", size, i, countDiff(counts[:], refCounts[:]))
+			}
+
+			if w.Len() != len(history)-first {
+				t.Fatalf("size %d, push %d: Len() = %d, expected %d", size, i, w.Len(), len(history)-first)
+			}
+		}
+
+		w.Reset()
+		if w.Len() != 0 || w.Counts() != (Counts16{}) || w.Size() != size {
+			t.Errorf("size %d: window not empty after Reset", size)
+		}
+	}
+}